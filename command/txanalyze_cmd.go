@@ -0,0 +1,141 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/urfave/cli"
+
+	"github.com/ontio/txreplay/utils"
+)
+
+var TxAnalyzeCommand = cli.Command{
+	Name:      "txanalyze",
+	Usage:     "Analyze the txs of an export file",
+	ArgsUsage: "",
+	Action:    analyzeTxs,
+	Flags: []cli.Flag{
+		TxExportFileFlag,
+		AnalyzeRangeFlag,
+		AnalyzeTopFlag,
+		AnalyzeJsonFlag,
+	},
+	Description: "Count the txs of an export file by tx type, contract, native method and payer, and summarize gas prices and gas limits per block range",
+}
+
+func analyzeTxs(ctx *cli.Context) error {
+	txFile := ctx.String(GetFlagName(TxExportFileFlag))
+	if txFile == "" {
+		fmt.Println("Missing file argument")
+		cli.ShowSubcommandHelp(ctx)
+		return nil
+	}
+	ifile, err := os.OpenFile(txFile, os.O_RDONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("Open file:%s error:%s", txFile, err)
+	}
+	defer ifile.Close()
+
+	reader, err := utils.NewExportReader(ifile)
+	if err != nil {
+		return fmt.Errorf("Read file:%s error:%s", txFile, err)
+	}
+	defer reader.Close()
+
+	analysis := utils.NewTxAnalysis(uint32(ctx.Uint(GetFlagName(AnalyzeRangeFlag))))
+	errNum := 0
+	for {
+		block, err := reader.ReadBlock()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("Read file:%s error:%s", txFile, err)
+		}
+		analysis.AddBlock(block.Height)
+		for _, etx := range block.Txs {
+			if etx.Err != nil {
+				errNum++
+				continue
+			}
+			analysis.AddTx(block.Height, etx.Tx)
+		}
+	}
+	analysis.Finish()
+
+	if ctx.Bool(GetFlagName(AnalyzeJsonFlag)) {
+		data, err := json.MarshalIndent(analysis, "", "  ")
+		if err != nil {
+			return fmt.Errorf("json.Marshal analysis error:%s", err)
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+	printAnalysis(analysis, int(ctx.Uint(GetFlagName(AnalyzeTopFlag))))
+	if errNum != 0 {
+		fmt.Printf("\n%d undecodable txs are not counted, use txinspect to find them\n", errNum)
+	}
+	return nil
+}
+
+func printAnalysis(analysis *utils.TxAnalysis, top int) {
+	fmt.Printf("Blocks:%d from block %d to block %d\n", analysis.Blocks, analysis.FirstHeight, analysis.LastHeight)
+	fmt.Printf("Total txs:%d\n", analysis.Txs)
+	if analysis.Unparsed != 0 {
+		fmt.Printf("Invoke codes without a known contract call:%d\n", analysis.Unparsed)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	tables := []struct {
+		title  string
+		counts map[string]uint64
+	}{
+		{"TX TYPE", analysis.TxTypes},
+		{"CONTRACT", analysis.Contracts},
+		{"NATIVE METHOD", analysis.NativeMethods},
+		{"PAYER", analysis.Payers},
+	}
+	for _, table := range tables {
+		entries := utils.SortCounts(table.counts)
+		fmt.Fprintf(w, "\n%s\tTXS\tPERCENT\n", table.title)
+		for i, entry := range entries {
+			if top > 0 && i == top {
+				fmt.Fprintf(w, "... %d more\t\t\n", len(entries)-top)
+				break
+			}
+			fmt.Fprintf(w, "%s\t%d\t%.2f%%\n", entry.Key, entry.Count, float64(entry.Count)*100/float64(analysis.Txs))
+		}
+	}
+
+	fmt.Fprintf(w, "\nBLOCKS\tTXS\tGAS PRICE MIN/AVG/P50/P90/P99/MAX\tGAS LIMIT MIN/AVG/P50/P90/P99/MAX\n")
+	for _, gasRange := range analysis.GasRanges {
+		fmt.Fprintf(w, "%d-%d\t%d\t%s\t%s\n", gasRange.StartHeight, gasRange.EndHeight, gasRange.Txs,
+			formatDistribution(gasRange.GasPrice), formatDistribution(gasRange.GasLimit))
+	}
+	w.Flush()
+}
+
+func formatDistribution(dist *utils.Distribution) string {
+	return fmt.Sprintf("%d/%.0f/%d/%d/%d/%d", dist.Min, dist.Avg, dist.P50, dist.P90, dist.P99, dist.Max)
+}
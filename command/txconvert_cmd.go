@@ -0,0 +1,192 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package command
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/gosuri/uiprogress"
+	"github.com/urfave/cli"
+
+	"github.com/ontio/ontology/common"
+	"github.com/ontio/ontology/core/types"
+	"github.com/ontio/txreplay/utils"
+)
+
+var TxConvertCommand = cli.Command{
+	Name:      "txconvert",
+	Usage:     "Convert a block.dat file of ontology to an export file",
+	ArgsUsage: "",
+	Action:    convertBlocks,
+	Flags: []cli.Flag{
+		BlockFileFlag,
+		TxExportFileFlag,
+		TxExportHeightFlag,
+		TxExportEndHeightFlag,
+		TxExportFormatFlag,
+		TxExportCompressFlag,
+		NetworkIdFlag,
+	},
+	Description: "Read the blocks of a file written by the --export of ontology and write their txs the same way as txexport",
+}
+
+func convertBlocks(ctx *cli.Context) error {
+	blockFile := ctx.String(GetFlagName(BlockFileFlag))
+	txFile := ctx.String(GetFlagName(TxExportFileFlag))
+	if blockFile == "" || txFile == "" {
+		fmt.Println("Missing file argument")
+		cli.ShowSubcommandHelp(ctx)
+		return nil
+	}
+	format := ctx.String(GetFlagName(TxExportFormatFlag))
+	err := utils.CheckExportFormat(format)
+	if err != nil {
+		return err
+	}
+	compression := ctx.String(GetFlagName(TxExportCompressFlag))
+	if compression == "" {
+		compression = utils.CompressionByFileName(txFile)
+	}
+	err = utils.CheckCompression(compression)
+	if err != nil {
+		return err
+	}
+	if common.FileExisted(txFile) {
+		return fmt.Errorf("File:%s has already exist", txFile)
+	}
+
+	bf, err := os.OpenFile(blockFile, os.O_RDONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("Open file:%s error:%s", blockFile, err)
+	}
+	defer bf.Close()
+	reader, err := utils.NewBlockDatReader(bf)
+	if err != nil {
+		return fmt.Errorf("Read file:%s error:%s", blockFile, err)
+	}
+
+	startHeight := uint32(ctx.Uint(GetFlagName(TxExportHeightFlag)))
+	endHeight := reader.BlockHeight()
+	if ctx.IsSet(GetFlagName(TxExportEndHeightFlag)) {
+		height := ctx.Uint(GetFlagName(TxExportEndHeightFlag))
+		if height > uint(reader.BlockHeight()) {
+			return fmt.Errorf("The specified end height %d is over the last block %d of file:%s", height, reader.BlockHeight(), blockFile)
+		}
+		endHeight = uint32(height)
+	}
+	if startHeight > endHeight {
+		return fmt.Errorf("No block to convert between block %d and block %d", startHeight, endHeight)
+	}
+
+	first, err := reader.ReadBlock()
+	if err != nil {
+		return fmt.Errorf("Read first block of file:%s error:%s", blockFile, err)
+	}
+	firstHeight := first.Header.Height
+	if startHeight < firstHeight {
+		if ctx.IsSet(GetFlagName(TxExportHeightFlag)) {
+			return fmt.Errorf("File:%s starts at block %d, after the specified height %d", blockFile, firstHeight, startHeight)
+		}
+		startHeight = firstHeight
+	}
+	if startHeight > endHeight {
+		return fmt.Errorf("No block to convert between block %d and block %d", startHeight, endHeight)
+	}
+	var header *utils.ArchiveHeader
+	if format == utils.EXPORT_FORMAT_BINARY {
+		// the genesis block identifies the chain, it is unknown if the file starts later
+		var genesisHash common.Uint256
+		if firstHeight == 0 {
+			genesisHash = first.Hash()
+		}
+		header = &utils.ArchiveHeader{
+			NetworkId:   uint32(ctx.Uint(GetFlagName(NetworkIdFlag))),
+			GenesisHash: genesisHash,
+			Source:      "blockfile:" + blockFile,
+			StartHeight: startHeight,
+			EndHeight:   endHeight + 1,
+			CreateTime:  uint64(time.Now().Unix()),
+		}
+	}
+
+	ef, err := os.OpenFile(txFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0664)
+	if err != nil {
+		return fmt.Errorf("Open file:%s error:%s", txFile, err)
+	}
+	defer ef.Close()
+	out, err := utils.NewCompressWriter(ef, compression)
+	if err != nil {
+		return err
+	}
+	writer, err := newExportWriter(out, format, utils.TX_ARCHIVE_VERSION, header, nil)
+	if err != nil {
+		return err
+	}
+
+	totalBlocks := int(endHeight-firstHeight) + 1
+	uiprogress.Start()
+	bar := uiprogress.AddBar(totalBlocks).
+		AppendCompleted().
+		AppendElapsed().
+		PrependFunc(func(b *uiprogress.Bar) string {
+			return fmt.Sprintf("Remaining Block %d", totalBlocks-b.Current())
+		})
+
+	fmt.Printf("Start convert...\n")
+	var count uint64
+	var block *types.Block
+	for height := firstHeight; height <= endHeight; height++ {
+		switch {
+		case height == firstHeight:
+			block = first
+		case height < startHeight:
+			// blocks before the range are not decompressed
+			block = nil
+			err = reader.SkipBlock()
+		default:
+			block, err = reader.ReadBlock()
+		}
+		if err != nil {
+			return fmt.Errorf("Read file:%s error:%s", blockFile, err)
+		}
+		if height >= startHeight {
+			err = writer.WriteBlock(block.Header, block.Transactions)
+			if err != nil {
+				return err
+			}
+			count += uint64(len(block.Transactions))
+		}
+		bar.Incr()
+	}
+	uiprogress.Stop()
+
+	err = writer.Close()
+	if err == nil {
+		err = out.Close()
+	}
+	if err != nil {
+		return fmt.Errorf("Export flush file error:%s", err)
+	}
+	fmt.Printf("Convert blocks successfully.\n")
+	fmt.Printf("Total txs:%d from block %d to block %d\n", count, startHeight, endHeight)
+	fmt.Printf("Export file:%s\n", txFile)
+	return nil
+}
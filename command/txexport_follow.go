@@ -0,0 +1,312 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package command
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/ontio/ontology/core/types"
+	"github.com/ontio/txreplay/utils"
+	"github.com/urfave/cli"
+)
+
+// countingWriter counts the bytes written to a segment file
+type countingWriter struct {
+	w     io.Writer
+	count int64
+}
+
+func (this *countingWriter) Write(p []byte) (int, error) {
+	n, err := this.w.Write(p)
+	this.count += int64(n)
+	return n, err
+}
+
+// segmentWriter writes the blocks of a followed export into segment files and keeps the manifest
+type segmentWriter struct {
+	exportFile string
+	manifest   *utils.ExportManifest
+	policy     *utils.SegmentPolicy
+	filter     *utils.TxFilter
+	header     *utils.ArchiveHeader // template of the segment headers of a binary export
+	file       *os.File
+	counter    *countingWriter
+	out        io.WriteCloser
+	writer     utils.ExportWriter
+	segment    *utils.ExportSegment
+}
+
+func (this *segmentWriter) open(height uint32) error {
+	fileName := utils.SegmentFileName(this.exportFile, height)
+	file, err := os.OpenFile(fileName, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0664)
+	if err != nil {
+		return fmt.Errorf("Open file:%s error:%s", fileName, err)
+	}
+	this.file = file
+	this.counter = &countingWriter{w: file}
+	this.out, err = utils.NewCompressWriter(this.counter, this.manifest.Compression)
+	if err != nil {
+		return err
+	}
+	var header *utils.ArchiveHeader
+	if this.header != nil {
+		segmentHeader := *this.header
+		segmentHeader.StartHeight = height
+		segmentHeader.CreateTime = uint64(time.Now().Unix())
+		header = &segmentHeader
+	}
+	this.writer, err = newExportWriter(this.out, this.manifest.Format, utils.TX_ARCHIVE_VERSION, header, nil)
+	if err != nil {
+		return err
+	}
+	this.segment = &utils.ExportSegment{
+		File:        fileName,
+		StartHeight: height,
+		EndHeight:   height,
+	}
+	this.manifest.Segments = append(this.manifest.Segments, this.segment)
+	return this.manifest.Save()
+}
+
+// write exports the block, in a new segment if the current one is full. A segment is only
+// opened for a block with matched txs, so a filter matching nothing leaves no empty segment.
+func (this *segmentWriter) write(block *types.Block) error {
+	txs := block.Transactions
+	if !this.filter.IsEmpty() {
+		txs = make([]*types.Transaction, 0, len(block.Transactions))
+		for _, tx := range block.Transactions {
+			if this.filter.Match(tx) {
+				txs = append(txs, tx)
+			}
+		}
+	}
+	// the skipped blocks rotate and expire the segments too, their time is the latest block time
+	if this.segment != nil && this.policy.ShouldRotate(this.segment, block.Header.Timestamp) {
+		err := this.rotate(block.Header.Timestamp)
+		if err != nil {
+			return err
+		}
+	}
+	if len(txs) == 0 {
+		this.manifest.NextHeight = block.Header.Height + 1
+		if this.segment != nil {
+			this.segment.EndHeight = block.Header.Height + 1
+			return nil
+		}
+		return this.expire(block.Header.Timestamp)
+	}
+	if this.segment == nil {
+		err := this.open(block.Header.Height)
+		if err != nil {
+			return err
+		}
+	}
+	err := this.writer.WriteBlock(block.Header, txs)
+	if err != nil {
+		return err
+	}
+	this.segment.Add(block.Header.Height, block.Header.Timestamp, len(txs))
+	this.segment.Size = this.counter.count
+	this.manifest.NextHeight = block.Header.Height + 1
+	return nil
+}
+
+// flush pushes the written blocks to the segment file and saves the manifest, so the
+// segment can be read while it grows
+func (this *segmentWriter) flush() error {
+	if this.segment == nil {
+		return this.manifest.Save()
+	}
+	err := this.writer.Flush()
+	if err == nil {
+		if flusher, ok := this.out.(interface{ Flush() error }); ok {
+			err = flusher.Flush()
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("Export flush file:%s error:%s", this.segment.File, err)
+	}
+	this.segment.Size = this.counter.count
+	return this.manifest.Save()
+}
+
+// close completes the current segment, a segment without blocks is removed
+func (this *segmentWriter) close() error {
+	if this.segment == nil {
+		return this.manifest.Save()
+	}
+	err := this.writer.Close()
+	if err == nil {
+		err = this.out.Close()
+	}
+	if err == nil {
+		err = this.file.Close()
+	}
+	if err != nil {
+		return fmt.Errorf("Export close file:%s error:%s", this.segment.File, err)
+	}
+	segment := this.segment
+	segment.Size = this.counter.count
+	segment.Complete = true
+	this.segment = nil
+	if segment.Blocks == 0 {
+		err = this.manifest.DropLast()
+		if err != nil {
+			return err
+		}
+		return this.manifest.Save()
+	}
+	fmt.Printf("Segment %s: block %d to block %d, %d txs\n", segment.File, segment.StartHeight,
+		int64(segment.EndHeight)-1, segment.Txs)
+	return this.manifest.Save()
+}
+
+// rotate completes the current segment and removes the segments expired at latestTime
+func (this *segmentWriter) rotate(latestTime uint32) error {
+	err := this.close()
+	if err != nil {
+		return err
+	}
+	return this.expire(latestTime)
+}
+
+// expire removes the complete segments older than the retention before latestTime
+func (this *segmentWriter) expire(latestTime uint32) error {
+	expired, err := this.manifest.Expire(latestTime, this.policy.Retain)
+	for _, segment := range expired {
+		fmt.Printf("Remove expired segment %s\n", segment.File)
+	}
+	if err != nil {
+		return err
+	}
+	if len(expired) == 0 {
+		return nil
+	}
+	return this.manifest.Save()
+}
+
+// followExport exports the blocks into segment files, and keeps appending the new blocks
+// of the chain after it catches up, until Ctrl-C
+func followExport(ctx *cli.Context, txFile, format, compression string, filter *utils.TxFilter) error {
+	for _, flag := range []cli.Flag{TxExportEndHeightFlag, TxExportEndHashFlag, TxExportEndTimeFlag} {
+		if ctx.IsSet(GetFlagName(flag)) {
+			return fmt.Errorf("--%s cannot be used with --%s", GetFlagName(flag), GetFlagName(TxExportFollowFlag))
+		}
+	}
+	policy := &utils.SegmentPolicy{
+		MaxSize:   int64(ctx.Uint(GetFlagName(TxExportRotateSizeFlag))) * 1024 * 1024,
+		MaxBlocks: uint32(ctx.Uint(GetFlagName(TxExportRotateBlocksFlag))),
+		Window:    time.Minute * time.Duration(ctx.Uint(GetFlagName(TxExportRotateTimeFlag))),
+		Retain:    time.Hour * time.Duration(ctx.Uint(GetFlagName(TxExportRetainFlag))),
+	}
+	pollInterval := time.Millisecond * time.Duration(ctx.Uint(GetFlagName(TxExportPollFlag)))
+	if pollInterval <= 0 {
+		return fmt.Errorf("--%s should be positive", GetFlagName(TxExportPollFlag))
+	}
+	manifest, err := utils.LoadExportManifest(txFile)
+	if err != nil {
+		return err
+	}
+	resume := ctx.Bool(GetFlagName(TxExportResumeFlag))
+	if manifest != nil && !resume {
+		return fmt.Errorf("Manifest:%s has already exist, use --%s to continue the export",
+			utils.ManifestFile(txFile), GetFlagName(TxExportResumeFlag))
+	}
+
+	runCtx, cancel := interruptContext()
+	defer cancel()
+	source, err := exportSource(ctx, runCtx)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	blockCount, err := source.GetBlockCount()
+	if err != nil {
+		return fmt.Errorf("GetBlockCount error:%s", err)
+	}
+
+	var nextHeight uint32
+	if manifest != nil && (manifest.NextHeight != 0 || manifest.Last() != nil) {
+		if ctx.IsSet(GetFlagName(TxExportFormatFlag)) && manifest.Format != format {
+			return fmt.Errorf("Export:%s is in %s format, cannot resume it in %s format", txFile, manifest.Format, format)
+		}
+		nextHeight = manifest.NextHeight
+		// the segment being written when the export stopped is written again
+		if last := manifest.Last(); last != nil && !last.Complete {
+			nextHeight = last.StartHeight
+			err = manifest.DropLast()
+			if err != nil {
+				return err
+			}
+		}
+	} else {
+		if manifest == nil {
+			manifest = utils.NewExportManifest(txFile, format, compression)
+		}
+		nextHeight, _, err = exportRange(ctx, source, blockCount)
+		if err != nil {
+			return err
+		}
+	}
+	manifest.NextHeight = nextHeight
+
+	writer := &segmentWriter{
+		exportFile: txFile,
+		manifest:   manifest,
+		policy:     policy,
+		filter:     filter,
+	}
+	if manifest.Format == utils.EXPORT_FORMAT_BINARY {
+		// the end of a segment is unknown when it starts, its trailer has the last height
+		writer.header, err = exportArchiveHeader(source, nextHeight, 0)
+		if err != nil {
+			return err
+		}
+	}
+
+	routineNum := ctx.Uint(GetFlagName(RoutineNumFlag))
+	batchSize := ctx.Uint(GetFlagName(TxExportBatchFlag))
+	follower := utils.NewBlockFollower(source, routineNum, batchSize, pollInterval)
+
+	fmt.Printf("Start export from block %d...\n", nextHeight)
+	nextHeight, err = follower.Follow(runCtx, nextHeight, func(block *types.Block, blockCount uint32) error {
+		err := writer.write(block)
+		if err != nil {
+			return err
+		}
+		if (block.Header.Height+1)%utils.EXPORT_CHECKPOINT_INTERVAL == 0 {
+			return writer.flush()
+		}
+		return nil
+	}, func(uint32) error {
+		return writer.flush()
+	})
+	if err != nil {
+		return err
+	}
+	err = writer.close()
+	if err != nil {
+		return err
+	}
+	return cli.NewExitError(fmt.Sprintf("Export stopped at block %d, run it again with --%s to continue",
+		nextHeight, GetFlagName(TxExportResumeFlag)), EXIT_CODE_INTERRUPTED)
+}
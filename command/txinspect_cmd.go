@@ -0,0 +1,169 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package command
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/urfave/cli"
+
+	"github.com/ontio/ontology/common"
+	"github.com/ontio/txreplay/utils"
+)
+
+var TxInspectCommand = cli.Command{
+	Name:      "txinspect",
+	Usage:     "Summarize and validate an export file",
+	ArgsUsage: "",
+	Action:    inspectTxs,
+	Flags: []cli.Flag{
+		TxExportFileFlag,
+	},
+	Description: "Parse every block and tx of an export file the same way as tximport and report integrity failures",
+}
+
+type inspectReport struct {
+	blocks         uint64
+	txs            uint64
+	firstHeight    uint32
+	lastHeight     uint32
+	numMismatches  uint64
+	malformedLines uint64
+	badTxs         uint64
+	hashMismatches uint64
+	duplicateTxs   uint64
+	outOfOrder     uint64
+	readErr        error
+}
+
+func (this *inspectReport) failures() uint64 {
+	failures := this.numMismatches + this.malformedLines + this.badTxs + this.hashMismatches +
+		this.duplicateTxs + this.outOfOrder
+	if this.readErr != nil {
+		failures++
+	}
+	return failures
+}
+
+func inspectTxs(ctx *cli.Context) error {
+	txFile := ctx.String(GetFlagName(TxExportFileFlag))
+	if txFile == "" {
+		fmt.Println("Missing file argument")
+		cli.ShowSubcommandHelp(ctx)
+		return nil
+	}
+	ifile, err := os.OpenFile(txFile, os.O_RDONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("Open file:%s error:%s", txFile, err)
+	}
+	defer ifile.Close()
+
+	reader, err := utils.NewExportReader(ifile)
+	if err != nil {
+		return fmt.Errorf("Read file:%s error:%s", txFile, err)
+	}
+	defer reader.Close()
+
+	fmt.Printf("File:%s\n", txFile)
+	fmt.Printf("Format:%s compression:%s\n", reader.Format(), reader.Compression())
+	if header := reader.Header(); header != nil {
+		fmt.Printf("Archive version:%d network id:%d genesis block:%s\n",
+			header.Version, header.NetworkId, header.GenesisHash.ToHexString())
+		fmt.Printf("Exported from %s, block %d to block %d, at %s\n", header.Source,
+			header.StartHeight, header.EndHeight, time.Unix(int64(header.CreateTime), 0).UTC().Format(time.UnixDate))
+	}
+
+	report := &inspectReport{}
+	txHashes := make(map[common.Uint256]struct{})
+	for {
+		block, err := reader.ReadBlock()
+		if err == io.EOF {
+			break
+		}
+		if lineErr, ok := err.(*utils.BlockLineError); ok {
+			// the txs of the malformed block line are skipped, the scan goes on at the next block line
+			fmt.Printf("Malformed block %s, its txs are skipped\n", lineErr)
+			report.malformedLines++
+			continue
+		}
+		if err != nil {
+			report.readErr = err
+			fmt.Printf("Read error after block %d: %s\n", report.lastHeight, err)
+			break
+		}
+		if report.blocks == 0 {
+			report.firstHeight = block.Height
+		} else if block.Height <= report.lastHeight {
+			fmt.Printf("Block %d after block %d is out of order\n", block.Height, report.lastHeight)
+			report.outOfOrder++
+		}
+		report.blocks++
+		report.lastHeight = block.Height
+		if block.TxNum != len(block.Txs) {
+			fmt.Printf("Block %d records %d txs but has %d\n", block.Height, block.TxNum, len(block.Txs))
+			report.numMismatches++
+		}
+
+		for _, etx := range block.Txs {
+			report.txs++
+			if etx.Err != nil {
+				fmt.Printf("Block %d line %d: %s\n", block.Height, etx.Line, etx.Err)
+				if etx.ErrKind == utils.TX_ERR_DESERIALIZE {
+					report.badTxs++
+				} else {
+					report.malformedLines++
+				}
+				continue
+			}
+			txHash := etx.Tx.Hash()
+			if etx.Hash != fmt.Sprintf("%x", txHash) {
+				fmt.Printf("Block %d line %d: recorded hash %s but tx hash is %x\n", block.Height, etx.Line, etx.Hash, txHash)
+				report.hashMismatches++
+			}
+			if _, ok := txHashes[txHash]; ok {
+				fmt.Printf("Block %d line %d: duplicated tx %x\n", block.Height, etx.Line, txHash)
+				report.duplicateTxs++
+				continue
+			}
+			txHashes[txHash] = struct{}{}
+		}
+	}
+
+	if report.blocks == 0 {
+		fmt.Printf("Blocks:0\n")
+	} else {
+		fmt.Printf("Blocks:%d from block %d to block %d\n", report.blocks, report.firstHeight, report.lastHeight)
+	}
+	fmt.Printf("Total txs:%d\n", report.txs)
+	fmt.Printf("Tx num mismatches:%d\n", report.numMismatches)
+	fmt.Printf("Malformed lines:%d\n", report.malformedLines)
+	fmt.Printf("Undeserializable txs:%d\n", report.badTxs)
+	fmt.Printf("Hash mismatches:%d\n", report.hashMismatches)
+	fmt.Printf("Duplicated txs:%d\n", report.duplicateTxs)
+	fmt.Printf("Out of order blocks:%d\n", report.outOfOrder)
+
+	if report.failures() != 0 {
+		return fmt.Errorf("Inspect file:%s failed, %d integrity failures", txFile, report.failures())
+	}
+	fmt.Printf("Inspect file:%s successfully.\n", txFile)
+	return nil
+}
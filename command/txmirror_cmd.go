@@ -0,0 +1,345 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package command
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/urfave/cli"
+
+	"github.com/ontio/ontology/common"
+	"github.com/ontio/ontology/common/log"
+	"github.com/ontio/ontology/core/types"
+	"github.com/ontio/txreplay/utils"
+)
+
+var TxMirrorCommand = cli.Command{
+	Name:      "txmirror",
+	Usage:     "Mirror the txs of a running network into the ledger as its blocks are produced",
+	ArgsUsage: "",
+	Action:    mirrorTxs,
+	Flags: []cli.Flag{
+		HostIPFlag,
+		RPCPortFlag,
+		RpcEndpointsFlag,
+		RpcTimeoutFlag,
+		RpcRetryFlag,
+		RpcBackoffFlag,
+		RpcMaxErrorRateFlag,
+		RpcMaxLatencyFlag,
+		TxExportCrossCheckFlag,
+		RoutineNumFlag,
+		TxExportBatchFlag,
+		MirrorHeightFlag,
+		MirrorResumeFlag,
+		MirrorPollFlag,
+		ImportRejectFileFlag,
+		ImportOriginalTimeFlag,
+		ImportTxsPerBlockFlag,
+		ImportMaxBlockSizeFlag,
+		ImportMaxBlockGasFlag,
+		ImportMergeBlocksFlag,
+		NetworkIdFlag,
+	},
+	Description: "Follow the blocks of a source node and pack their txs into blocks of the ledger signed by the consensus wallets, reporting how far the ledger lags behind the source",
+}
+
+func mirrorTxs(ctx *cli.Context) error {
+	log.Init(log.PATH, log.Stdout)
+	networkId := ctx.Int(GetFlagName(NetworkIdFlag))
+	cfg, err := utils.InitConfig("", networkId)
+	if err != nil {
+		return cli.NewExitError(fmt.Sprintf("Init config error:%s", err), EXIT_CODE_CONFIG)
+	}
+	accounts, err := utils.InitAccounts()
+	if err != nil {
+		return cli.NewExitError(fmt.Sprintf("Init accounts error:%s", err), EXIT_CODE_WALLET)
+	}
+	ldg, err := utils.InitLedger(cfg, networkId)
+	if err != nil {
+		return cli.NewExitError(fmt.Sprintf("Init ledger error:%s", err), EXIT_CODE_LEDGER)
+	}
+	pollInterval := time.Millisecond * time.Duration(ctx.Uint(GetFlagName(MirrorPollFlag)))
+	if pollInterval <= 0 {
+		return fmt.Errorf("--%s should be positive", GetFlagName(MirrorPollFlag))
+	}
+
+	journal := utils.NewMirrorJournal(utils.LedgerDir(networkId))
+	found, err := journal.Load()
+	if err != nil {
+		return cli.NewExitError(err, EXIT_CODE_LEDGER)
+	}
+	resume := ctx.Bool(GetFlagName(MirrorResumeFlag))
+	if found && !resume {
+		return fmt.Errorf("Mirror journal of network %d has already exist, use --%s to continue the mirror",
+			networkId, GetFlagName(MirrorResumeFlag))
+	}
+	if !found && resume {
+		return fmt.Errorf("No mirror journal of network %d to resume", networkId)
+	}
+	if resume && ctx.IsSet(GetFlagName(MirrorHeightFlag)) {
+		return fmt.Errorf("--%s cannot be used with --%s", GetFlagName(MirrorHeightFlag), GetFlagName(MirrorResumeFlag))
+	}
+	if resume && ldg.GetCurrentBlockHeight() < journal.BlockHeight {
+		return cli.NewExitError(fmt.Sprintf("Ledger height:%d is below the mirrored block height:%d of the journal",
+			ldg.GetCurrentBlockHeight(), journal.BlockHeight), EXIT_CODE_LEDGER)
+	}
+	// txs added to the ledger after the journal was last saved
+	var recovered map[common.Uint256]struct{}
+	if resume {
+		recovered, err = ledgerTxsAfter(ldg, journal.BlockHeight)
+		if err != nil {
+			return cli.NewExitError(err, EXIT_CODE_LEDGER)
+		}
+	}
+
+	runCtx, cancel := interruptContext()
+	defer cancel()
+	source, err := exportSource(ctx, runCtx)
+	if err != nil {
+		return cli.NewExitError(err, EXIT_CODE_INPUT)
+	}
+	defer source.Close()
+	sourceNetworkId, err := source.GetNetworkId()
+	if err != nil {
+		return cli.NewExitError(fmt.Sprintf("GetNetworkId error:%s", err), EXIT_CODE_INPUT)
+	}
+	var nextHeight uint32
+	// txs of the first source block processed before the mirror was interrupted
+	skipTxs := 0
+	if resume {
+		if journal.NetworkId != sourceNetworkId {
+			return cli.NewExitError(fmt.Sprintf("Journal mirrors network %d, source:%s is network %d",
+				journal.NetworkId, source.Name(), sourceNetworkId), EXIT_CODE_INPUT)
+		}
+		nextHeight = journal.NextHeight
+		skipTxs = journal.SourceTxs
+	} else if ctx.IsSet(GetFlagName(MirrorHeightFlag)) {
+		nextHeight = uint32(ctx.Uint(GetFlagName(MirrorHeightFlag)))
+	} else {
+		nextHeight, err = source.GetBlockCount()
+		if err != nil {
+			return cli.NewExitError(fmt.Sprintf("GetBlockCount error:%s", err), EXIT_CODE_INPUT)
+		}
+	}
+	if sourceNetworkId != uint32(networkId) {
+		fmt.Printf("Warning: mirroring network %d to network %d\n", sourceNetworkId, networkId)
+	}
+	journal.Source = source.Name()
+	journal.NetworkId = sourceNetworkId
+
+	report := newImportReport(false)
+	if rejectFile := ctx.String(GetFlagName(ImportRejectFileFlag)); rejectFile != "" {
+		report.rejects, err = utils.NewRejectWriter(rejectFile)
+		if err != nil {
+			return cli.NewExitError(err, EXIT_CODE_OUTPUT)
+		}
+		defer func() {
+			// the records still held back if the command stops early
+			report.flush(math.MaxUint32)
+			report.rejects.Close()
+		}()
+	}
+	policy := &utils.PackPolicy{
+		TxsPerBlock:  int(ctx.Uint(GetFlagName(ImportTxsPerBlockFlag))),
+		MaxBlockSize: int(ctx.Uint(GetFlagName(ImportMaxBlockSizeFlag))),
+		MaxBlockGas:  ctx.Uint64(GetFlagName(ImportMaxBlockGasFlag)),
+		MergeBlocks:  int(ctx.Uint(GetFlagName(ImportMergeBlocksFlag))),
+	}
+	packer := utils.NewBlockPacker(policy)
+	txs := &sourceTxs{
+		ldg:       ldg,
+		packer:    packer,
+		report:    report,
+		recovered: recovered,
+		packed:    journal.MirroredTxs,
+		errNum:    journal.ErrNum,
+	}
+	originalTime := ctx.Bool(GetFlagName(ImportOriginalTimeFlag))
+	lag := &mirrorLag{}
+
+	// commit adds a block of the packed txs, next and sourceTxs are the progress of the mirror if no tx is
+	// left in the packer
+	commit := func(batch *utils.PackedBlock, next uint32, sourceTxs int) error {
+		blk, err := addImportBlock(accounts, ldg, batch, originalTime)
+		if err != nil {
+			return cli.NewExitError(err, EXIT_CODE_LEDGER)
+		}
+		report.pack(batch)
+		if report.rejects != nil {
+			report.checkExecution(batch.Items, ldg)
+			if report.err != nil {
+				return cli.NewExitError(report.err, EXIT_CODE_OUTPUT)
+			}
+		}
+		// a resumed mirror fetches the source block of the first tx still in the packer again
+		if item := packer.Pending(); item != nil {
+			next, sourceTxs = item.SourceHeight, item.Progress.SourceTxs
+		}
+		journal.NextHeight = next
+		journal.SourceTxs = sourceTxs
+		journal.BlockHeight = blk.Header.Height
+		txs.packed += len(batch.Items)
+		journal.MirroredTxs = txs.packed
+		journal.ErrNum = txs.errNum
+		err = journal.Save()
+		if err != nil {
+			return cli.NewExitError(err, EXIT_CODE_OUTPUT)
+		}
+
+		lag.update(batch.Items[len(batch.Items)-1].SourceHeight, batch.Timestamp())
+		fmt.Printf("%s mirrored tx count %d, errNum %d, source block %d, current block height %d  block hash %x, %s\n",
+			time.Now().UTC().Format(time.UnixDate), txs.packed, txs.errNum, lag.sourceHeight,
+			blk.Header.Height, blk.Hash(), lag)
+		return nil
+	}
+
+	handle := func(block *types.Block, blockCount uint32) error {
+		sourceBlock := &utils.ExportBlock{Height: block.Header.Height, Timestamp: block.Header.Timestamp}
+		lag.blockCount = blockCount
+		for i, tx := range block.Transactions {
+			if i < skipTxs {
+				continue
+			}
+			progress := utils.ImportProgress{SourceTxs: i}
+			batches, recovered := txs.add(sourceBlock, utils.NewExportTx(uint64(i+1), tx), progress)
+			if recovered && len(txs.recovered) == 0 {
+				// the journal catches up with the ledger after the last recovered tx
+				journal.NextHeight = sourceBlock.Height
+				journal.SourceTxs = i + 1
+				journal.BlockHeight = ldg.GetCurrentBlockHeight()
+				journal.MirroredTxs = txs.packed
+				journal.ErrNum = txs.errNum
+				err := journal.Save()
+				if err != nil {
+					return cli.NewExitError(err, EXIT_CODE_OUTPUT)
+				}
+			}
+			for j, batch := range batches {
+				next, sourceTxs := sourceBlock.Height, i+1
+				if j+1 < len(batches) {
+					next, sourceTxs = batches[j+1].Items[0].SourceHeight, batches[j+1].Items[0].Progress.SourceTxs
+				}
+				err := commit(batch, next, sourceTxs)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		skipTxs = 0
+		if report.err != nil {
+			return cli.NewExitError(report.err, EXIT_CODE_OUTPUT)
+		}
+		next := sourceBlock.Height + 1
+		if batch := packer.EndSourceBlock(); batch != nil {
+			err := commit(batch, next, 0)
+			if err != nil {
+				return err
+			}
+		} else if packer.Pending() == nil && next%utils.EXPORT_CHECKPOINT_INTERVAL == 0 {
+			// the blocks without txs are recorded at times, so a resume does not fetch them all again
+			lag.update(sourceBlock.Height, sourceBlock.Timestamp)
+			fmt.Printf("%s source block %d, %s\n", time.Now().UTC().Format(time.UnixDate), sourceBlock.Height, lag)
+			journal.NextHeight = next
+			journal.SourceTxs = 0
+			journal.ErrNum = txs.errNum
+			err := journal.Save()
+			if err != nil {
+				return cli.NewExitError(err, EXIT_CODE_OUTPUT)
+			}
+		}
+		txs.flushRejects(next)
+		if report.err != nil {
+			return cli.NewExitError(report.err, EXIT_CODE_OUTPUT)
+		}
+		return nil
+	}
+
+	// idle packs the txs left in the packer once the ledger catches up with the source, so merged
+	// blocks never hold the txs of the new source blocks back
+	idle := func(next uint32) error {
+		if batch := packer.Flush(); batch != nil {
+			err := commit(batch, next, 0)
+			if err != nil {
+				return err
+			}
+		} else if journal.NextHeight != next || journal.SourceTxs != 0 {
+			journal.NextHeight = next
+			journal.SourceTxs = 0
+			journal.ErrNum = txs.errNum
+			err := journal.Save()
+			if err != nil {
+				return cli.NewExitError(err, EXIT_CODE_OUTPUT)
+			}
+		}
+		txs.flushRejects(next)
+		if report.err != nil {
+			return cli.NewExitError(report.err, EXIT_CODE_OUTPUT)
+		}
+		return nil
+	}
+
+	fmt.Printf("%s Start mirror from source block %d of %s to block %d of the ledger...\n",
+		time.Now().UTC().Format(time.UnixDate), nextHeight, source.Name(), ldg.GetCurrentBlockHeight()+1)
+	follower := utils.NewBlockFollower(source, ctx.Uint(GetFlagName(RoutineNumFlag)), ctx.Uint(GetFlagName(TxExportBatchFlag)), pollInterval)
+	_, err = follower.Follow(runCtx, nextHeight, handle, idle)
+	if err != nil {
+		if _, ok := err.(*cli.ExitError); ok {
+			return err
+		}
+		return cli.NewExitError(err, EXIT_CODE_INPUT)
+	}
+
+	fmt.Printf("%s Mirror stopped, mirrored txs %d errNum %d, %s\n",
+		time.Now().UTC().Format(time.UnixDate), txs.packed, txs.errNum, lag)
+	report.printBlocks("Mirrored")
+	report.flush(math.MaxUint32)
+	if report.rejects != nil {
+		fmt.Printf("Rejected txs:%d written to file:%s\n", report.rejects.Count(), ctx.String(GetFlagName(ImportRejectFileFlag)))
+	}
+	return cli.NewExitError(fmt.Sprintf("Mirror stopped at source block %d, run it again with --%s to continue",
+		journal.NextHeight, GetFlagName(MirrorResumeFlag)), EXIT_CODE_INTERRUPTED)
+}
+
+// mirrorLag is how far the ledger was behind the source node when the last source block was
+// mirrored, in blocks and in the time since the source block was produced
+type mirrorLag struct {
+	blockCount   uint32 // block count of the source known at the last block
+	sourceHeight uint32 // last mirrored source block
+	blocks       int64
+	seconds      int64
+}
+
+func (this *mirrorLag) update(sourceHeight, sourceTime uint32) {
+	this.sourceHeight = sourceHeight
+	this.blocks = int64(this.blockCount) - 1 - int64(sourceHeight)
+	if this.blocks < 0 {
+		this.blocks = 0
+	}
+	this.seconds = time.Now().Unix() - int64(sourceTime)
+	if this.seconds < 0 {
+		this.seconds = 0
+	}
+}
+
+func (this *mirrorLag) String() string {
+	return fmt.Sprintf("lag %d blocks %ds", this.blocks, this.seconds)
+}
@@ -21,22 +21,30 @@ package command
 import (
 	"bufio"
 	"bytes"
-	"encoding/hex"
+	"context"
 	"fmt"
 	"io"
+	"math"
 	"os"
-	"strconv"
+	"os/signal"
+	"sort"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/gosuri/uiprogress"
 	"github.com/urfave/cli"
 
+	"github.com/ontio/ontology/account"
 	cutils "github.com/ontio/ontology/cmd/utils"
 	"github.com/ontio/ontology/common"
 	"github.com/ontio/ontology/common/log"
 	"github.com/ontio/ontology/common/serialization"
+	"github.com/ontio/ontology/core/ledger"
 	"github.com/ontio/ontology/core/types"
+	"github.com/ontio/ontology/core/validation"
+	ontErrors "github.com/ontio/ontology/errors"
+	"github.com/ontio/ontology/smartcontract/event"
 	"github.com/ontio/txreplay/utils"
 )
 
@@ -45,6 +53,51 @@ const (
 	DEFAULT_BLOCK_FILE_NAME  = "block.dat"
 )
 
+// exit codes of tximport, other failures exit with 1
+const (
+	EXIT_CODE_CONFIG      = 2   // the node config cannot be loaded
+	EXIT_CODE_WALLET      = 3   // the consensus wallets cannot be opened
+	EXIT_CODE_LEDGER      = 4   // the ledger cannot be opened, read or extended
+	EXIT_CODE_INPUT       = 5   // the import file cannot be read or is malformed
+	EXIT_CODE_OUTPUT      = 6   // the block file, the reject file or the journal cannot be written
+	EXIT_CODE_INTERRUPTED = 130 // stopped by Ctrl-C or SIGTERM, also used by txexport and txsend
+)
+
+// interruptContext returns a context canceled by the first Ctrl-C or SIGTERM, a second one
+// kills the process
+func interruptContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-sigs:
+			fmt.Printf("\nInterrupted, stopping...\n")
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(sigs)
+	}()
+	return ctx, cancel
+}
+
+// rpcConfig builds the config of the rpc clients from the rpc flags
+func rpcConfig(ctx *cli.Context) *utils.RpcConfig {
+	return &utils.RpcConfig{
+		Timeout: time.Second * time.Duration(ctx.Uint(GetFlagName(RpcTimeoutFlag))),
+		Retries: ctx.Uint(GetFlagName(RpcRetryFlag)),
+		Backoff: time.Millisecond * time.Duration(ctx.Uint(GetFlagName(RpcBackoffFlag))),
+	}
+}
+
+// rpcEndpoints returns the addresses of --endpoints, or the address of --ip and --rpcport
+func rpcEndpoints(ctx *cli.Context) ([]string, error) {
+	if ctx.IsSet(GetFlagName(RpcEndpointsFlag)) {
+		return utils.ParseEndpoints(ctx.String(GetFlagName(RpcEndpointsFlag)))
+	}
+	return []string{fmt.Sprintf("http://%s:%d", ctx.String(GetFlagName(HostIPFlag)), ctx.Uint(GetFlagName(RPCPortFlag)))}, nil
+}
+
 var TxExportCommand = cli.Command{
 	Name:      "txexport",
 	Usage:     "Export txs in DB to a file",
@@ -53,34 +106,88 @@ var TxExportCommand = cli.Command{
 	Flags: []cli.Flag{
 		HostIPFlag,
 		RPCPortFlag,
+		RpcEndpointsFlag,
+		RpcTimeoutFlag,
+		RpcRetryFlag,
+		RpcBackoffFlag,
+		RpcMaxErrorRateFlag,
+		RpcMaxLatencyFlag,
+		ChainDirFlag,
+		NetworkIdFlag,
 		TxExportFileFlag,
 		TxExportHeightFlag,
+		TxExportEndHeightFlag,
+		TxExportStartHashFlag,
+		TxExportEndHashFlag,
+		TxExportStartTimeFlag,
+		TxExportEndTimeFlag,
+		TxExportContractFlag,
+		TxExportPayerFlag,
+		TxExportSignerFlag,
+		TxExportTxTypeFlag,
+		TxExportMinGasPriceFlag,
+		TxExportMaxGasPriceFlag,
+		TxExportFormatFlag,
+		TxExportCompressFlag,
+		TxExportCrossCheckFlag,
+		TxExportFollowFlag,
+		TxExportRotateSizeFlag,
+		TxExportRotateBlocksFlag,
+		TxExportRotateTimeFlag,
+		TxExportRetainFlag,
+		TxExportPollFlag,
+		TxExportResumeFlag,
+		RoutineNumFlag,
+		TxExportBatchFlag,
 	},
 	Description: "",
 }
 
 func exportTxs(ctx *cli.Context) error {
-	ip := ctx.String(GetFlagName(HostIPFlag))
-	port := ctx.Uint(GetFlagName(RPCPortFlag))
-	utils.SetIPPort(ip, port)
-
 	txFile := ctx.String(GetFlagName(TxExportFileFlag))
 	if txFile == "" {
 		fmt.Printf("Missing file argumen\n")
 		cli.ShowSubcommandHelp(ctx)
 		return nil
 	}
-	if common.FileExisted(txFile) {
-		return fmt.Errorf("File:%s has already exist", txFile)
+	format := ctx.String(GetFlagName(TxExportFormatFlag))
+	err := utils.CheckExportFormat(format)
+	if err != nil {
+		return err
+	}
+	compression := ctx.String(GetFlagName(TxExportCompressFlag))
+	if compression == "" {
+		compression = utils.CompressionByFileName(txFile)
+	}
+	err = utils.CheckCompression(compression)
+	if err != nil {
+		return err
 	}
-	startHeight := ctx.Uint(GetFlagName(TxExportHeightFlag))
-	blockCount, err := utils.GetBlockCount()
+	filter, err := exportFilter(ctx)
+	if err != nil {
+		return err
+	}
+	if ctx.Bool(GetFlagName(TxExportFollowFlag)) {
+		return followExport(ctx, txFile, format, compression, filter)
+	}
+	resume := ctx.Bool(GetFlagName(TxExportResumeFlag))
+	if common.FileExisted(txFile) && !resume {
+		return fmt.Errorf("File:%s has already exist, use --%s to continue the export", txFile, GetFlagName(TxExportResumeFlag))
+	}
+	runCtx, cancel := interruptContext()
+	defer cancel()
+	source, err := exportSource(ctx, runCtx)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	blockCount, err := source.GetBlockCount()
 	if err != nil {
 		return fmt.Errorf("GetBlockCount error:%s", err)
 	}
-
-	if startHeight >= uint(blockCount) {
-		return fmt.Errorf("The specified height is over current height")
+	startHeight, endHeight, err := exportRange(ctx, source, blockCount)
+	if err != nil {
+		return err
 	}
 
 	ef, err := os.OpenFile(txFile, os.O_RDWR|os.O_CREATE, 0664)
@@ -88,9 +195,61 @@ func exportTxs(ctx *cli.Context) error {
 		return fmt.Errorf("Open file:%s error:%s", txFile, err)
 	}
 	defer ef.Close()
-	fWriter := bufio.NewWriter(ef)
 
-	totalBlocks := int(blockCount) - int(startHeight)
+	ckpt := &utils.ExportCheckpoint{
+		File:        txFile,
+		StartHeight: startHeight,
+		NextHeight:  startHeight,
+	}
+	version := uint32(utils.TX_ARCHIVE_VERSION)
+	var trailer *utils.ArchiveTrailer
+	if resume {
+		fileCompression, err := utils.FileCompression(ef)
+		if err != nil {
+			return err
+		}
+		if fileCompression != utils.COMPRESS_NONE || compression != utils.COMPRESS_NONE {
+			return fmt.Errorf("Compressed export file:%s cannot be resumed", txFile)
+		}
+		fileFormat, fileVersion, fileTrailer, err := resumeExport(ef, ckpt)
+		if err != nil {
+			return err
+		}
+		if ctx.IsSet(GetFlagName(TxExportFormatFlag)) && fileFormat != format {
+			return fmt.Errorf("Export file:%s is in %s format, cannot resume it in %s format", txFile, fileFormat, format)
+		}
+		format = fileFormat
+		version = fileVersion
+		trailer = fileTrailer
+		if ckpt.NextHeight >= endHeight {
+			// resumeExport dropped the trailer of the archive, write it back
+			if format == utils.EXPORT_FORMAT_BINARY {
+				err = utils.NewArchiveWriter(ef, version, trailer).Close()
+				if err != nil {
+					return fmt.Errorf("Write trailer of export file:%s error:%s", txFile, err)
+				}
+			}
+			fmt.Printf("Export file:%s is up to date at block %d\n", txFile, ckpt.NextHeight)
+			return utils.RemoveExportCheckpoint(txFile)
+		}
+	}
+	out, err := utils.NewCompressWriter(ef, compression)
+	if err != nil {
+		return err
+	}
+	var header *utils.ArchiveHeader
+	if format == utils.EXPORT_FORMAT_BINARY && ckpt.Offset == 0 {
+		header, err = exportArchiveHeader(source, ckpt.StartHeight, endHeight)
+		if err != nil {
+			return err
+		}
+	}
+	writer, err := newExportWriter(out, format, version, header, trailer)
+	if err != nil {
+		return err
+	}
+
+	totalBlocks := int(endHeight) - int(ckpt.NextHeight)
 	uiprogress.Start()
 	bar := uiprogress.AddBar(totalBlocks).
 		AppendCompleted().
@@ -100,41 +259,351 @@ func exportTxs(ctx *cli.Context) error {
 		})
 
 	fmt.Printf("Start export...\n")
+	routineNum := ctx.Uint(GetFlagName(RoutineNumFlag))
+	fetcher := utils.NewBlockFetcher(source, routineNum, ctx.Uint(GetFlagName(TxExportBatchFlag)))
+	defer fetcher.Stop()
+
 	var count uint64
-	for i := uint32(startHeight); i < uint32(blockCount); i++ {
-		blockData, err := utils.GetBlockData(i)
-		if err != nil {
-			return fmt.Errorf("Get block:%d error:%s", i, err)
+	nextHeight := ckpt.NextHeight
+	for result := range fetcher.Start(ckpt.NextHeight, endHeight) {
+		if runCtx.Err() != nil {
+			break
 		}
-		var block types.Block
-		buf := bytes.NewBuffer(blockData)
-		err = block.Deserialize(buf)
-		if err != nil {
-			return fmt.Errorf("failed to read block at height %d err %v", i, err)
+		if result.Err != nil {
+			return result.Err
 		}
-		fWriter.WriteString(fmt.Sprintf("Block %d num %d\n", i, len(block.Transactions)))
-		for _, tx := range block.Transactions {
-			txHex := hex.EncodeToString(tx.ToArray())
-			_, err = fWriter.WriteString(fmt.Sprintf("%x %s\n", tx.Hash(), txHex))
+		i := result.Height
+		block := result.Block
+		txs := block.Transactions
+		if !filter.IsEmpty() {
+			txs = make([]*types.Transaction, 0, len(block.Transactions))
+			for _, tx := range block.Transactions {
+				if filter.Match(tx) {
+					txs = append(txs, tx)
+				}
+			}
+		}
+		// a filtered export omits the blocks without matched txs
+		if len(txs) != 0 || filter.IsEmpty() {
+			err = writer.WriteBlock(block.Header, txs)
 			if err != nil {
-				return fmt.Errorf("failed to write tx data %x at block height %d", tx.Hash(), i)
+				return err
 			}
-			count++
+			count += uint64(len(txs))
 		}
 		bar.Incr()
+
+		nextHeight = i + 1
+
+		// offsets inside a compressed stream cannot be resumed from, so no checkpoint for it
+		if compression == utils.COMPRESS_NONE && nextHeight%utils.EXPORT_CHECKPOINT_INTERVAL == 0 {
+			err = saveExportCheckpoint(ef, writer, ckpt, nextHeight)
+			if err != nil {
+				return err
+			}
+		}
 	}
 	uiprogress.Stop()
+	if runCtx.Err() != nil {
+		if compression != utils.COMPRESS_NONE {
+			return cli.NewExitError(fmt.Sprintf("Export interrupted at block %d", nextHeight), EXIT_CODE_INTERRUPTED)
+		}
+		err = saveExportCheckpoint(ef, writer, ckpt, nextHeight)
+		if err != nil {
+			return err
+		}
+		return cli.NewExitError(fmt.Sprintf("Export interrupted at block %d, run it again with --%s to continue",
+			nextHeight, GetFlagName(TxExportResumeFlag)), EXIT_CODE_INTERRUPTED)
+	}
 
-	err = fWriter.Flush()
+	err = writer.Close()
+	if err == nil {
+		err = out.Close()
+	}
 	if err != nil {
 		return fmt.Errorf("Export flush file error:%s", err)
 	}
+	err = utils.RemoveExportCheckpoint(txFile)
+	if err != nil {
+		return fmt.Errorf("Remove checkpoint error:%s", err)
+	}
 	fmt.Printf("Export txs successfully.\n")
-	fmt.Printf("Total txs:%d from block %d to block %d\n", count, startHeight, blockCount)
+	fmt.Printf("Total txs:%d from block %d to block %d\n", count, ckpt.StartHeight, endHeight)
 	fmt.Printf("Export file:%s\n", txFile)
+	if multi, ok := source.(*utils.MultiRpcBlockSource); ok {
+		printEndpointStats(multi.Stats())
+	}
 	return nil
 }
 
+func printEndpointStats(stats []*utils.EndpointStats) {
+	fmt.Printf("Endpoints:\n")
+	for _, stat := range stats {
+		state := ""
+		if stat.Ejected {
+			state = " ejected"
+		}
+		fmt.Printf("  %s requests:%d errors:%d avg latency:%s ejections:%d%s\n", stat.Addr, stat.Requests,
+			stat.Errors, stat.AvgLatency, stat.Ejections, state)
+	}
+}
+
+// exportSource opens the ledger directory set by --chaindir, or connects to the node of --rpcport
+// or --endpoints, by JSON-RPC, RESTful or WebSocket as the scheme of its address says. With
+// several --endpoints the blocks are fetched from all the nodes by JSON-RPC. The requests to the
+// nodes are canceled when runCtx is done.
+func exportSource(ctx *cli.Context, runCtx context.Context) (utils.BlockSource, error) {
+	chainDir := ctx.String(GetFlagName(ChainDirFlag))
+	if chainDir == "" {
+		endpoints, err := rpcEndpoints(ctx)
+		if err != nil {
+			return nil, err
+		}
+		config := rpcConfig(ctx)
+		if len(endpoints) == 1 {
+			return utils.NewBlockSource(runCtx, endpoints[0], config)
+		}
+		clients := make([]*utils.RpcClient, 0, len(endpoints))
+		for _, endpoint := range endpoints {
+			if !utils.IsRpcAddr(endpoint) {
+				return nil, fmt.Errorf("Several --%s should all be JSON-RPC addresses, not %s", GetFlagName(RpcEndpointsFlag), endpoint)
+			}
+			clients = append(clients, utils.NewRpcClient(endpoint, config))
+		}
+		maxErrorRate := ctx.Float64(GetFlagName(RpcMaxErrorRateFlag))
+		if maxErrorRate < 0 || maxErrorRate > 1 {
+			return nil, fmt.Errorf("--%s should be between 0 and 1", GetFlagName(RpcMaxErrorRateFlag))
+		}
+		policy := &utils.HealthPolicy{
+			MaxErrorRate: maxErrorRate,
+			MaxLatency:   time.Millisecond * time.Duration(ctx.Uint(GetFlagName(RpcMaxLatencyFlag))),
+			CrossCheck:   uint32(ctx.Uint(GetFlagName(TxExportCrossCheckFlag))),
+		}
+		return utils.NewMultiRpcBlockSource(runCtx, clients, policy), nil
+	}
+	networkId := uint32(ctx.Uint(GetFlagName(NetworkIdFlag)))
+	source, err := utils.NewLedgerBlockSource(chainDir, networkId)
+	if err != nil {
+		return nil, fmt.Errorf("Open ledger:%s error:%s", chainDir, err)
+	}
+	return source, nil
+}
+
+// exportFilter builds the tx filter of txexport from its filter flags
+func exportFilter(ctx *cli.Context) (*utils.TxFilter, error) {
+	var err error
+	filter := utils.NewTxFilter()
+	filter.Contracts, err = utils.ParseAddressList(ctx.String(GetFlagName(TxExportContractFlag)))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid --%s:%s", GetFlagName(TxExportContractFlag), err)
+	}
+	filter.Payers, err = utils.ParseAddressList(ctx.String(GetFlagName(TxExportPayerFlag)))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid --%s:%s", GetFlagName(TxExportPayerFlag), err)
+	}
+	filter.Signers, err = utils.ParseAddressList(ctx.String(GetFlagName(TxExportSignerFlag)))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid --%s:%s", GetFlagName(TxExportSignerFlag), err)
+	}
+	filter.TxTypes, err = utils.ParseTxTypeList(ctx.String(GetFlagName(TxExportTxTypeFlag)))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid --%s:%s", GetFlagName(TxExportTxTypeFlag), err)
+	}
+	filter.MinGasPrice = ctx.Uint64(GetFlagName(TxExportMinGasPriceFlag))
+	filter.MaxGasPrice = ctx.Uint64(GetFlagName(TxExportMaxGasPriceFlag))
+	if filter.MaxGasPrice != 0 && filter.MaxGasPrice < filter.MinGasPrice {
+		return nil, fmt.Errorf("--%s is lower than --%s", GetFlagName(TxExportMaxGasPriceFlag), GetFlagName(TxExportMinGasPriceFlag))
+	}
+	return filter, nil
+}
+
+// exportRange resolves the range flags of txexport to the blocks [start, end)
+func exportRange(ctx *cli.Context, source utils.BlockSource, blockCount uint32) (uint32, uint32, error) {
+	startFlags := []cli.Flag{TxExportHeightFlag, TxExportStartHashFlag, TxExportStartTimeFlag}
+	endFlags := []cli.Flag{TxExportEndHeightFlag, TxExportEndHashFlag, TxExportEndTimeFlag}
+	for _, flags := range [][]cli.Flag{startFlags, endFlags} {
+		names := make([]string, 0, len(flags))
+		for _, flag := range flags {
+			if ctx.IsSet(GetFlagName(flag)) {
+				names = append(names, "--"+GetFlagName(flag))
+			}
+		}
+		if len(names) > 1 {
+			return 0, 0, fmt.Errorf("Flags %s cannot be used together", strings.Join(names, ", "))
+		}
+	}
+
+	start := uint32(ctx.Uint(GetFlagName(TxExportHeightFlag)))
+	end := blockCount
+	if ctx.IsSet(GetFlagName(TxExportEndHeightFlag)) {
+		height := ctx.Uint(GetFlagName(TxExportEndHeightFlag))
+		if height >= uint(blockCount) {
+			return 0, 0, fmt.Errorf("The specified end height %d is over current height %d", height, blockCount-1)
+		}
+		end = uint32(height) + 1
+	}
+	if ctx.IsSet(GetFlagName(TxExportStartHashFlag)) {
+		height, err := utils.GetBlockHeightByHash(source, ctx.String(GetFlagName(TxExportStartHashFlag)))
+		if err != nil {
+			return 0, 0, err
+		}
+		start = height
+	}
+	if ctx.IsSet(GetFlagName(TxExportEndHashFlag)) {
+		height, err := utils.GetBlockHeightByHash(source, ctx.String(GetFlagName(TxExportEndHashFlag)))
+		if err != nil {
+			return 0, 0, err
+		}
+		end = height + 1
+	}
+	if ctx.IsSet(GetFlagName(TxExportStartTimeFlag)) {
+		timestamp, err := utils.ParseTimestamp(ctx.String(GetFlagName(TxExportStartTimeFlag)))
+		if err != nil {
+			return 0, 0, err
+		}
+		start, err = utils.FindHeightByTime(source, timestamp, 0, blockCount)
+		if err != nil {
+			return 0, 0, fmt.Errorf("Find block of start time error:%s", err)
+		}
+	}
+	if ctx.IsSet(GetFlagName(TxExportEndTimeFlag)) {
+		timestamp, err := utils.ParseTimestamp(ctx.String(GetFlagName(TxExportEndTimeFlag)))
+		if err != nil {
+			return 0, 0, err
+		}
+		if timestamp < math.MaxUint32 {
+			// the first block after the end time is excluded
+			end, err = utils.FindHeightByTime(source, timestamp+1, 0, blockCount)
+			if err != nil {
+				return 0, 0, fmt.Errorf("Find block of end time error:%s", err)
+			}
+		}
+	}
+
+	if start >= blockCount {
+		return 0, 0, fmt.Errorf("The specified height is over current height")
+	}
+	if start >= end {
+		return 0, 0, fmt.Errorf("No block to export between block %d and block %d", start, end)
+	}
+	return start, end, nil
+}
+
+// newExportWriter starts writing the export file in format, the archive header is only written to a new file
+func newExportWriter(w io.Writer, format string, version uint32, header *utils.ArchiveHeader,
+	trailer *utils.ArchiveTrailer) (utils.ExportWriter, error) {
+	if format == utils.EXPORT_FORMAT_TEXT {
+		return utils.NewTextExportWriter(w), nil
+	}
+	if header != nil {
+		err := utils.WriteArchiveHeader(w, header)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return utils.NewArchiveWriter(w, version, trailer), nil
+}
+
+// exportArchiveHeader describes the blocks [startHeight, endHeight) of source in an archive header
+func exportArchiveHeader(source utils.BlockSource, startHeight, endHeight uint32) (*utils.ArchiveHeader, error) {
+	networkId, err := source.GetNetworkId()
+	if err != nil {
+		return nil, fmt.Errorf("GetNetworkId error:%s", err)
+	}
+	genesis, err := source.GetBlock(0)
+	if err != nil {
+		return nil, fmt.Errorf("Get genesis block error:%s", err)
+	}
+	return &utils.ArchiveHeader{
+		NetworkId:   networkId,
+		GenesisHash: genesis.Hash(),
+		Source:      source.Name(),
+		StartHeight: startHeight,
+		EndHeight:   endHeight,
+		CreateTime:  uint64(time.Now().Unix()),
+	}, nil
+}
+
+// resumeExport drops the partial record at the end of the export file and
+// moves the checkpoint to the first block missing from the file. It returns
+// the format of the file and, for a binary archive, its version and the totals of its records.
+func resumeExport(ef *os.File, ckpt *utils.ExportCheckpoint) (string, uint32, *utils.ArchiveTrailer, error) {
+	format := utils.EXPORT_FORMAT_TEXT
+	var tail *utils.ExportTail
+	var trailer *utils.ArchiveTrailer
+	isArchive, err := utils.IsArchiveFile(ef)
+	if err != nil {
+		return "", 0, nil, err
+	}
+	if isArchive {
+		format = utils.EXPORT_FORMAT_BINARY
+		tail, trailer, err = utils.FindArchiveTail(ef)
+	} else {
+		tail, err = utils.FindExportTail(ef)
+	}
+	if err != nil {
+		return "", 0, nil, fmt.Errorf("Read tail of export file:%s error:%s", ckpt.File, err)
+	}
+	saved, err := utils.LoadExportCheckpoint(ckpt.File)
+	if err != nil {
+		return "", 0, nil, err
+	}
+	if saved != nil && tail.Offset < saved.Offset {
+		return "", 0, nil, fmt.Errorf("Export file:%s is behind its checkpoint, offset %d, checkpoint block %d offset %d",
+			ckpt.File, tail.Offset, saved.NextHeight, saved.Offset)
+	}
+	if tail.Found {
+		ckpt.NextHeight = tail.NextHeight
+		ckpt.StartHeight = tail.NextHeight
+	}
+	if saved != nil {
+		ckpt.StartHeight = saved.StartHeight
+		// blocks without matched txs are not written to a filtered export, so the
+		// checkpoint may be ahead of the last record
+		if saved.NextHeight > ckpt.NextHeight {
+			ckpt.NextHeight = saved.NextHeight
+		}
+	}
+	if !tail.Found && !isArchive {
+		info, err := ef.Stat()
+		if err != nil {
+			return "", 0, nil, fmt.Errorf("Stat export file:%s error:%s", ckpt.File, err)
+		}
+		if info.Size() != 0 {
+			return "", 0, nil, fmt.Errorf("Export file:%s has no block record", ckpt.File)
+		}
+	}
+
+	err = ef.Truncate(tail.Offset)
+	if err != nil {
+		return "", 0, nil, fmt.Errorf("Truncate export file:%s error:%s", ckpt.File, err)
+	}
+	_, err = ef.Seek(tail.Offset, io.SeekStart)
+	if err != nil {
+		return "", 0, nil, fmt.Errorf("Seek export file:%s error:%s", ckpt.File, err)
+	}
+	ckpt.Offset = tail.Offset
+	if tail.Found {
+		fmt.Printf("Resume export from block %d\n", ckpt.NextHeight)
+	}
+	return format, tail.Version, trailer, nil
+}
+
+// saveExportCheckpoint flushes the exported blocks before nextHeight and records them in the checkpoint
+func saveExportCheckpoint(ef *os.File, writer utils.ExportWriter, ckpt *utils.ExportCheckpoint, nextHeight uint32) error {
+	err := writer.Flush()
+	if err != nil {
+		return fmt.Errorf("Export flush file error:%s", err)
+	}
+	offset, err := ef.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("Seek export file:%s error:%s", ckpt.File, err)
+	}
+	ckpt.NextHeight = nextHeight
+	ckpt.Offset = offset
+	return ckpt.Save()
+}
+
 var TxImportCommand = cli.Command{
 	Name:      "tximport",
 	Usage:     "Import txs from a file",
@@ -142,164 +611,348 @@ var TxImportCommand = cli.Command{
 	Action:    importTxs,
 	Flags: []cli.Flag{
 		ImportTxFileFlag,
+		ImportResumeFlag,
+		ImportDryRunFlag,
+		ImportRejectFileFlag,
+		ImportOriginalTimeFlag,
+		ImportTxsPerBlockFlag,
+		ImportMaxBlockSizeFlag,
+		ImportMaxBlockGasFlag,
+		ImportMergeBlocksFlag,
+		ImportTpsFlag,
+		ImportBpsFlag,
+		ImportBurstFlag,
+		ImportCadenceFlag,
 		NetworkIdFlag,
 		TimerFlag,
 	},
 	Description: "",
 }
 
-func importTxs(ctx *cli.Context) {
+func importTxs(ctx *cli.Context) error {
 	log.Init(log.PATH, log.Stdout)
 	networkId := ctx.Int(GetFlagName(NetworkIdFlag))
 	cfg, err := utils.InitConfig("", networkId)
 	if err != nil {
-		fmt.Println("failed to init config %v", err)
-		return
+		return cli.NewExitError(fmt.Sprintf("Init config error:%s", err), EXIT_CODE_CONFIG)
 	}
-	accounts, err := utils.InitAccounts()
-
-	if err != nil {
-		fmt.Println(err)
-		return
+	// a dry run never builds blocks, so it needs no consensus wallets
+	dryRun := ctx.Bool(GetFlagName(ImportDryRunFlag))
+	var accounts []*account.Account
+	if !dryRun {
+		accounts, err = utils.InitAccounts()
+		if err != nil {
+			return cli.NewExitError(fmt.Sprintf("Init accounts error:%s", err), EXIT_CODE_WALLET)
+		}
 	}
 
 	ldg, err := utils.InitLedger(cfg, networkId)
 	if err != nil {
-		fmt.Println(err)
-		return
+		return cli.NewExitError(fmt.Sprintf("Init ledger error:%s", err), EXIT_CODE_LEDGER)
 	}
 
 	txFile := ctx.String(GetFlagName(ImportTxFileFlag))
 	if txFile == "" {
 		fmt.Println("Missing file argument")
 		cli.ShowSubcommandHelp(ctx)
-		return
+		return nil
 	}
 
 	ifile, err := os.OpenFile(txFile, os.O_RDONLY, 0644)
 	if err != nil {
-		fmt.Println(err)
-		return
+		return cli.NewExitError(fmt.Sprintf("Open file:%s error:%s", txFile, err), EXIT_CODE_INPUT)
 	}
 	defer ifile.Close()
 
-	fReader := bufio.NewReader(ifile)
+	journal := utils.NewImportJournal(utils.LedgerDir(networkId), txFile)
+	var reader utils.ExportReader
+	// txs added to the ledger after the journal was last saved
+	var recovered map[common.Uint256]struct{}
+	if ctx.Bool(GetFlagName(ImportResumeFlag)) {
+		reader, recovered, err = resumeImport(ifile, ldg, journal)
+		if err != nil {
+			return err
+		}
+	} else {
+		reader, err = utils.NewExportReader(ifile)
+		if err != nil {
+			return cli.NewExitError(fmt.Sprintf("Read file:%s error:%s", txFile, err), EXIT_CODE_INPUT)
+		}
+	}
+	defer reader.Close()
+	if header := reader.Header(); header != nil && header.NetworkId != uint32(networkId) {
+		fmt.Printf("Warning: txs were exported from network %d, importing to network %d\n",
+			header.NetworkId, networkId)
+	}
 
 	fmt.Printf("%s Start import Txs...\n",
 		time.Now().UTC().Format(time.UnixDate))
 
-	var txs []*types.Transaction
-	count := 0
-	summary := 0
-	errNum := 0
-	delay := ctx.Uint(GetFlagName(TimerFlag))
-	rateLimiter := time.NewTicker(time.Millisecond * time.Duration(delay))
+	originalTime := ctx.Bool(GetFlagName(ImportOriginalTimeFlag))
+	// the flag that needs the source block times
+	var timeFlag string
+	if originalTime {
+		timeFlag = GetFlagName(ImportOriginalTimeFlag)
+	} else if ctx.IsSet(GetFlagName(ImportCadenceFlag)) {
+		timeFlag = GetFlagName(ImportCadenceFlag)
+	}
+	report := newImportReport(dryRun)
+	if rejectFile := ctx.String(GetFlagName(ImportRejectFileFlag)); rejectFile != "" {
+		report.rejects, err = utils.NewRejectWriter(rejectFile)
+		if err != nil {
+			return cli.NewExitError(err, EXIT_CODE_OUTPUT)
+		}
+		defer func() {
+			// the records still held back if the command stops early
+			report.flush(math.MaxUint32)
+			report.rejects.Close()
+		}()
+	}
+	policy := &utils.PackPolicy{
+		TxsPerBlock:  int(ctx.Uint(GetFlagName(ImportTxsPerBlockFlag))),
+		MaxBlockSize: int(ctx.Uint(GetFlagName(ImportMaxBlockSizeFlag))),
+		MaxBlockGas:  ctx.Uint64(GetFlagName(ImportMaxBlockGasFlag)),
+		MergeBlocks:  int(ctx.Uint(GetFlagName(ImportMergeBlocksFlag))),
+	}
+	packer := utils.NewBlockPacker(policy)
+	txs := &sourceTxs{
+		ldg:       ldg,
+		packer:    packer,
+		report:    report,
+		recovered: recovered,
+		packed:    journal.PackedTxs,
+		errNum:    journal.ErrNum,
+	}
+	count := journal.TotalTxs
+	// txs of the first block processed before the import was interrupted
+	skipTxs := journal.SourceTxs
+	rateLimiter, err := importRateLimiter(ctx)
+	if err != nil {
+		return cli.NewExitError(err.Error(), EXIT_CODE_CONFIG)
+	}
+	defer rateLimiter.Stop()
+	runCtx, cancel := interruptContext()
+	defer cancel()
+	rateMeter := utils.NewRateMeter()
+
+	// commit adds a block of the packed txs, done is the progress of the import if no tx is left in the packer
+	commit := func(batch *utils.PackedBlock, done utils.ImportProgress) error {
+		report.pack(batch)
+		if dryRun {
+			txs.packed += len(batch.Items)
+			return nil
+		}
+		err := rateLimiter.Wait(runCtx, len(batch.Items), batch.Timestamp())
+		if err != nil {
+			return importInterrupted(dryRun)
+		}
+		blk, err := addImportBlock(accounts, ldg, batch, originalTime)
+		if err != nil {
+			return cli.NewExitError(err, EXIT_CODE_LEDGER)
+		}
+		txs.packed += len(batch.Items)
+		rateMeter.Add(len(batch.Items))
+		if report.rejects != nil {
+			report.checkExecution(batch.Items, ldg)
+			if report.err != nil {
+				return cli.NewExitError(report.err, EXIT_CODE_OUTPUT)
+			}
+		}
+
+		// a resumed import continues at the first tx still in the packer
+		if item := packer.Pending(); item != nil {
+			done = item.Progress
+		}
+		journal.ImportProgress = done
+		journal.SourceHeight = batch.Items[len(batch.Items)-1].SourceHeight
+		journal.BlockHeight = blk.Header.Height
+		journal.PackedTxs = txs.packed
+		err = journal.Save()
+		if err != nil {
+			return cli.NewExitError(err, EXIT_CODE_OUTPUT)
+		}
+
+		fmt.Printf("%s packed tx count %d, errNum %d, current block height %d  block hash %x, %s\n",
+			time.Now().UTC().Format(time.UnixDate), txs.packed, txs.errNum, blk.Header.Height,
+			blk.Hash(), formatRates(rateMeter, rateLimiter))
+		return nil
+	}
 
 	for {
-		line, err := fReader.ReadString('\n')
+		if runCtx.Err() != nil {
+			return importInterrupted(dryRun)
+		}
+		pos := reader.Position()
+		block, err := reader.ReadBlock()
 		if err == io.EOF {
 			break
 		}
-		if strings.HasPrefix(line, "Block ") {
-			if len(txs) != 0 {
-				blockHeight := ldg.GetCurrentBlockHeight()
-				preBlock, err := ldg.GetBlockByHeight(blockHeight)
-				if err != nil {
-					fmt.Println(err)
-					return
-				}
+		if err != nil {
+			return cli.NewExitError(fmt.Sprintf("Read file:%s error:%s", txFile, err), EXIT_CODE_INPUT)
+		}
+		if timeFlag != "" && block.Timestamp == 0 {
+			return cli.NewExitError(fmt.Sprintf("File:%s does not record the time of block %d, export it again to use --%s",
+				txFile, block.Height, timeFlag), EXIT_CODE_INPUT)
+		}
 
-				// build a block
-				blk, err := utils.ConstructBlock(accounts, ldg, blockHeight+1, preBlock, txs)
+		for i, etx := range block.Txs {
+			if i < skipTxs {
+				continue
+			}
+			before := utils.ImportProgress{Position: *pos, SourceTxs: i, TotalTxs: count, ErrNum: txs.errNum}
+			if etx.Err == nil {
+				count++
+			}
+			batches, recovered := txs.add(block, etx, before)
+			if recovered && len(txs.recovered) == 0 && !dryRun {
+				// the journal catches up with the ledger after the last recovered tx
+				journal.ImportProgress = utils.ImportProgress{Position: *pos, SourceTxs: i + 1, TotalTxs: count, ErrNum: txs.errNum}
+				journal.SourceHeight = block.Height
+				journal.BlockHeight = ldg.GetCurrentBlockHeight()
+				journal.PackedTxs = txs.packed
+				err = journal.Save()
 				if err != nil {
-					fmt.Println(err)
-					return
+					return cli.NewExitError(err, EXIT_CODE_OUTPUT)
 				}
-				err = ldg.AddBlock(blk)
+			}
+			for j, batch := range batches {
+				done := utils.ImportProgress{Position: *pos, SourceTxs: i + 1, TotalTxs: count, ErrNum: txs.errNum}
+				if j+1 < len(batches) {
+					done = batches[j+1].Items[0].Progress
+				}
+				err = commit(batch, done)
 				if err != nil {
-					fmt.Errorf("add block height:%d error:%s", blockHeight, err)
-					return
+					return err
 				}
-				summary = summary + len(txs)
-
-				fmt.Printf("%s packed tx count %d, errNum %d, current block height %d  block hash %x\n",
-					time.Now().UTC().Format(time.UnixDate), summary, errNum, blk.Header.Height,
-					blk.Hash())
 			}
-			<-rateLimiter.C
-
-			index := strings.LastIndex(line, " ")
-			num, _ := strconv.Atoi(line[index+1 : len(line)-1])
-			txs = make([]*types.Transaction, 0, num)
-		} else {
-			index := strings.Index(line, " ")
-			if index < 0 {
-				fmt.Printf("failed to split tx %s\n", line)
-				errNum++
-				continue
-			}
-			txHex := line[index+1 : len(line)-1]
-			hex, err := common.HexToBytes(txHex)
-			if err != nil {
-				fmt.Printf("failed to convert from hex to bytes %s\n", line)
-				errNum++
-				continue
-			}
-			tx := &types.Transaction{}
-			if err := tx.Deserialize(bytes.NewReader(hex)); err != nil {
-				fmt.Printf("failed to deserialize tx %x\n", hex)
-				errNum++
-				continue
-			}
-			count++
-
-			exist, err := ldg.IsContainTransaction(tx.Hash())
+		}
+		skipTxs = 0
+		if report.err != nil {
+			return cli.NewExitError(report.err, EXIT_CODE_OUTPUT)
+		}
+		if batch := packer.EndSourceBlock(); batch != nil {
+			err = commit(batch, utils.ImportProgress{Position: *reader.Position(), TotalTxs: count, ErrNum: txs.errNum})
 			if err != nil {
-				fmt.Printf("Unknown error tx %x\n", tx.Hash())
-				errNum++
-				continue
-			} else if exist {
-				fmt.Printf("Duplicated input tx %x\n", tx.Hash())
-				errNum++
-				continue
+				return err
 			}
-			txs = append(txs, tx)
+		}
+		txs.flushRejects(block.Height + 1)
+		if report.err != nil {
+			return cli.NewExitError(report.err, EXIT_CODE_OUTPUT)
 		}
 	}
-
-	// Last block
-	if len(txs) != 0 {
-		blockHeight := ldg.GetCurrentBlockHeight()
-		preBlock, err := ldg.GetBlockByHeight(blockHeight)
+	if batch := packer.Flush(); batch != nil {
+		err = commit(batch, utils.ImportProgress{Position: *reader.Position(), TotalTxs: count, ErrNum: txs.errNum})
 		if err != nil {
-			fmt.Println(err)
-			return
+			return err
 		}
-		// build a block
-		blk, err := utils.ConstructBlock(accounts, ldg, blockHeight+1, preBlock, txs)
-		if err != nil {
-			fmt.Println(err)
-			return
+	}
+	report.flush(math.MaxUint32)
+	if report.err != nil {
+		return cli.NewExitError(report.err, EXIT_CODE_OUTPUT)
+	}
+
+	if dryRun {
+		report.print(count)
+		return nil
+	}
+	fmt.Printf("%s Import Txs complete, total txs %d packed txs %d errNum %d, %s\n",
+		time.Now().UTC().Format(time.UnixDate), count, txs.packed, txs.errNum, formatRates(rateMeter, rateLimiter))
+	report.printBlocks("Packed")
+	if report.rejects != nil {
+		fmt.Printf("Rejected txs:%d written to file:%s\n", report.rejects.Count(), ctx.String(GetFlagName(ImportRejectFileFlag)))
+	}
+
+	return exportBlockFile(ldg)
+}
+
+// importInterrupted is the error of an import stopped by Ctrl-C. The journal is saved after each
+// block, so the blocks added so far are kept and the import can be resumed.
+func importInterrupted(dryRun bool) error {
+	if dryRun {
+		return cli.NewExitError("Dry run interrupted", EXIT_CODE_INTERRUPTED)
+	}
+	return cli.NewExitError(fmt.Sprintf("Import interrupted, run it again with --%s to continue", GetFlagName(ImportResumeFlag)),
+		EXIT_CODE_INTERRUPTED)
+}
+
+// importRateLimiter returns the limiter of the rate options, or the constant timer if none is set
+func importRateLimiter(ctx *cli.Context) (utils.RateLimiter, error) {
+	var limiters []utils.RateLimiter
+	burst := ctx.Uint(GetFlagName(ImportBurstFlag))
+	if ctx.IsSet(GetFlagName(ImportTpsFlag)) {
+		tps := ctx.Float64(GetFlagName(ImportTpsFlag))
+		if tps <= 0 {
+			return nil, fmt.Errorf("--%s should be positive", GetFlagName(ImportTpsFlag))
 		}
-		err = ldg.AddBlock(blk)
-		if err != nil {
-			fmt.Errorf("add block height:%d error:%s", blockHeight, err)
-			return
+		limiters = append(limiters, utils.NewTxRateLimiter(tps, burst))
+	}
+	if ctx.IsSet(GetFlagName(ImportBpsFlag)) {
+		bps := ctx.Float64(GetFlagName(ImportBpsFlag))
+		if bps <= 0 {
+			return nil, fmt.Errorf("--%s should be positive", GetFlagName(ImportBpsFlag))
+		}
+		limiters = append(limiters, utils.NewBlockRateLimiter(bps, burst))
+	}
+	if ctx.IsSet(GetFlagName(ImportCadenceFlag)) {
+		factor := ctx.Float64(GetFlagName(ImportCadenceFlag))
+		if factor <= 0 {
+			return nil, fmt.Errorf("--%s should be positive", GetFlagName(ImportCadenceFlag))
 		}
-		summary = summary + len(txs)
-		fmt.Printf("%s packed tx count %d errNum %d,  current block height %d  block hash %x\n",
-			time.Now().UTC().Format(time.UnixDate), summary, errNum, blk.Header.Height,
-			blk.Hash())
+		limiters = append(limiters, utils.NewCadenceLimiter(factor))
 	}
+	switch len(limiters) {
+	case 0:
+		delay := ctx.Uint(GetFlagName(TimerFlag))
+		return utils.NewTickerLimiter(time.Millisecond * time.Duration(delay)), nil
+	case 1:
+		return limiters[0], nil
+	}
+	return nil, fmt.Errorf("Only one of --%s, --%s and --%s can be set", GetFlagName(ImportTpsFlag),
+		GetFlagName(ImportBpsFlag), GetFlagName(ImportCadenceFlag))
+}
 
-	fmt.Printf("%s Import Txs complete, total txs %d packed txs %d errNum %d\n",
-		time.Now().UTC().Format(time.UnixDate), count, summary, errNum)
-	rateLimiter.Stop()
+// formatRates shows the achieved rates of an import against the targets of its limiter
+func formatRates(meter *utils.RateMeter, limiter utils.RateLimiter) string {
+	tps, bps := meter.Rates()
+	targetTps, targetBps := limiter.Target()
+	return fmt.Sprintf("tps %.1f/%s bps %.2f/%s", tps, formatTarget(targetTps, "%.1f"), bps, formatTarget(targetBps, "%.2f"))
+}
 
-	oFile, err := os.OpenFile(DEFAULT_BLOCK_FILE_NAME, os.O_RDWR|os.O_CREATE, 0644)
+func formatTarget(rate float64, format string) string {
+	if rate == 0 {
+		return "-"
+	}
+	return fmt.Sprintf(format, rate)
+}
+
+// addImportBlock builds a block of the packed txs on the last block of the ledger and adds it to the ledger
+func addImportBlock(accounts []*account.Account, ldg *ledger.Ledger, batch *utils.PackedBlock, originalTime bool) (*types.Block, error) {
+	blockHeight := ldg.GetCurrentBlockHeight()
+	preBlock, err := ldg.GetBlockByHeight(blockHeight)
 	if err != nil {
-		fmt.Printf("failed to open file %s, err %v\n", DEFAULT_BLOCK_FILE_NAME, err)
-		return
+		return nil, fmt.Errorf("Get block height:%d error:%s", blockHeight, err)
+	}
+	var timestamp uint32
+	if originalTime {
+		timestamp = batch.Timestamp()
+	}
+	blk, err := utils.ConstructBlock(accounts, ldg, blockHeight+1, preBlock, batch.Txs(), timestamp)
+	if err != nil {
+		return nil, fmt.Errorf("Construct block height:%d error:%s", blockHeight+1, err)
+	}
+	err = ldg.AddBlock(blk)
+	if err != nil {
+		return nil, fmt.Errorf("add block height:%d error:%s", blockHeight+1, err)
+	}
+	return blk, nil
+}
+
+// exportBlockFile exports all blocks of the ledger to block.dat, which can be imported by ontology
+func exportBlockFile(ldg *ledger.Ledger) error {
+	oFile, err := os.OpenFile(DEFAULT_BLOCK_FILE_NAME, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return cli.NewExitError(fmt.Sprintf("failed to open file %s, err %v", DEFAULT_BLOCK_FILE_NAME, err), EXIT_CODE_OUTPUT)
 	}
 
 	defer oFile.Close()
@@ -311,8 +964,7 @@ func importTxs(ctx *cli.Context) {
 	metadata.BlockHeight = blockHeight
 	err = metadata.Serialize(fWriter)
 	if err != nil {
-		fmt.Printf("Write export metadata error:%s\n", err)
-		return
+		return cli.NewExitError(fmt.Sprintf("Write export metadata error:%s", err), EXIT_CODE_OUTPUT)
 	}
 
 	//progress bar
@@ -328,8 +980,7 @@ func importTxs(ctx *cli.Context) {
 	for i := uint32(0); i <= blockHeight; i++ {
 		block, err := ldg.GetBlockByHeight(i)
 		if err != nil {
-			fmt.Println(err)
-			return
+			return cli.NewExitError(fmt.Sprintf("Get block height:%d error:%s", i, err), EXIT_CODE_LEDGER)
 		}
 
 		w := bytes.NewBuffer(nil)
@@ -337,18 +988,15 @@ func importTxs(ctx *cli.Context) {
 
 		data, err := cutils.CompressBlockData(w.Bytes(), metadata.CompressType)
 		if err != nil {
-			fmt.Printf("Compress block height:%d error:%s\n", i, err)
-			return
+			return cli.NewExitError(fmt.Sprintf("Compress block height:%d error:%s", i, err), EXIT_CODE_OUTPUT)
 		}
 		err = serialization.WriteUint32(fWriter, uint32(len(data)))
 		if err != nil {
-			fmt.Errorf("write block data height:%d len:%d error:%s\n", i, uint32(len(data)), err)
-			return
+			return cli.NewExitError(fmt.Sprintf("write block data height:%d len:%d error:%s", i, uint32(len(data)), err), EXIT_CODE_OUTPUT)
 		}
 		_, err = fWriter.Write(data)
 		if err != nil {
-			fmt.Errorf("write block data height:%d error:%s\n", i, err)
-			return
+			return cli.NewExitError(fmt.Sprintf("write block data height:%d error:%s", i, err), EXIT_CODE_OUTPUT)
 		}
 
 		bar.Incr()
@@ -357,10 +1005,290 @@ func importTxs(ctx *cli.Context) {
 
 	err = fWriter.Flush()
 	if err != nil {
-		fmt.Errorf("Export flush file error:%s\n", err)
-		return
+		return cli.NewExitError(fmt.Sprintf("Export flush file error:%s", err), EXIT_CODE_OUTPUT)
 	}
 	fmt.Printf("Export blocks successfully.\n")
 	fmt.Printf("Total blocks:%d\n", blockHeight)
 	fmt.Printf("Export file:%s\n", DEFAULT_BLOCK_FILE_NAME)
+	return nil
+}
+
+// importReport collects the txs tximport skips or rejects and writes them to the
+// reject file. In a dry run it prints what would be done with each tx.
+type importReport struct {
+	dryRun    bool
+	rejects   *utils.RejectWriter
+	held      []*utils.RejectRecord // records of the source blocks with txs still waiting to be packed
+	err       error                 // first error writing the reject file
+	packedTxs int
+	blocks    *utils.PackStats // blocks packed in this run
+	skipped   uint64
+	rejected  map[string]uint64 // reason -> tx count
+	txHashes  map[common.Uint256]struct{}
+}
+
+func newImportReport(dryRun bool) *importReport {
+	return &importReport{
+		dryRun:   dryRun,
+		blocks:   utils.NewPackStats(),
+		rejected: make(map[string]uint64),
+		txHashes: make(map[common.Uint256]struct{}),
+	}
+}
+
+// check runs the checks that only a dry run needs: the txs of the earlier blocks are not
+// in the ledger, and the ledger does not verify txs before they are packed
+func (this *importReport) check(block *utils.ExportBlock, etx *utils.ExportTx, ldg *ledger.Ledger) bool {
+	txHash := etx.Tx.Hash()
+	if _, ok := this.txHashes[txHash]; ok {
+		this.skip(block, etx, "already packed from an earlier line")
+		return false
+	}
+	if errCode := validation.VerifyTransaction(etx.Tx); errCode != ontErrors.ErrNoError {
+		this.reject(block, etx, utils.REJECT_REASON_VERIFY, errCode.Error())
+		return false
+	}
+	if errCode := validation.VerifyTransactionWithLedger(etx.Tx, ldg); errCode != ontErrors.ErrNoError {
+		this.reject(block, etx, utils.REJECT_REASON_VERIFY, errCode.Error())
+		return false
+	}
+	this.txHashes[txHash] = struct{}{}
+	return true
+}
+
+// checkExecution rejects the packed txs whose execution failed
+func (this *importReport) checkExecution(items []*utils.PackItem, ldg *ledger.Ledger) {
+	for _, item := range items {
+		notify, err := ldg.GetEventNotifyByTx(item.Tx.Tx.Hash())
+		if err != nil || notify == nil {
+			continue
+		}
+		if notify.State == event.CONTRACT_STATE_FAIL {
+			block := &utils.ExportBlock{Height: item.SourceHeight, Timestamp: item.SourceTime}
+			this.reject(block, item.Tx, utils.REJECT_REASON_EXECUTION, "execution failed")
+		}
+	}
+}
+
+func (this *importReport) pack(batch *utils.PackedBlock) {
+	this.packedTxs += len(batch.Items)
+	this.blocks.Add(batch)
+	if !this.dryRun {
+		return
+	}
+	first, last := batch.Items[0].SourceHeight, batch.Items[len(batch.Items)-1].SourceHeight
+	if first == last {
+		fmt.Printf("Block %d: would pack %d txs, size %d\n", first, len(batch.Items), batch.Size)
+	} else {
+		fmt.Printf("Blocks %d-%d: would pack %d txs, size %d\n", first, last, len(batch.Items), batch.Size)
+	}
+}
+
+func (this *importReport) skip(block *utils.ExportBlock, etx *utils.ExportTx, desc string) {
+	this.skipped++
+	if this.dryRun {
+		fmt.Printf("Block %d line %d: would skip tx %x, %s: %s\n", block.Height, etx.Line, etx.Tx.Hash(),
+			utils.REJECT_REASON_DUPLICATE, desc)
+	}
+	this.write(block, etx, utils.REJECT_REASON_DUPLICATE, desc)
+}
+
+func (this *importReport) reject(block *utils.ExportBlock, etx *utils.ExportTx, reason, desc string) {
+	this.rejected[reason]++
+	if this.dryRun {
+		fmt.Printf("Block %d line %d: would reject tx %s, %s: %s\n", block.Height, etx.Line, etx.Hash, reason, desc)
+	}
+	this.write(block, etx, reason, desc)
+}
+
+func (this *importReport) write(block *utils.ExportBlock, etx *utils.ExportTx, reason, desc string) {
+	if this.rejects == nil || this.err != nil {
+		return
+	}
+	txHash := etx.Hash
+	if etx.Tx != nil {
+		txHash = fmt.Sprintf("%x", etx.Tx.Hash())
+	}
+	this.held = append(this.held, &utils.RejectRecord{
+		SourceHeight: block.Height,
+		SourceTime:   block.Timestamp,
+		Line:         etx.Line,
+		TxHash:       txHash,
+		Reason:       reason,
+		Desc:         desc,
+		Raw:          etx.Raw,
+	})
+}
+
+// flush writes the records of the source blocks before height to the reject file in source order. The
+// execution rejects of a source block are known after its txs are packed, so its records are held until
+// then, and a reject file read back as an export has every source block in one block record.
+func (this *importReport) flush(height uint32) {
+	if this.rejects == nil || this.err != nil {
+		return
+	}
+	sort.SliceStable(this.held, func(i, j int) bool {
+		if this.held[i].SourceHeight != this.held[j].SourceHeight {
+			return this.held[i].SourceHeight < this.held[j].SourceHeight
+		}
+		return this.held[i].Line < this.held[j].Line
+	})
+	n := 0
+	for ; n < len(this.held) && this.held[n].SourceHeight < height; n++ {
+		this.err = this.rejects.Write(this.held[n])
+		if this.err != nil {
+			return
+		}
+	}
+	this.held = this.held[n:]
+}
+
+func (this *importReport) print(count int) {
+	rejected := uint64(0)
+	for _, num := range this.rejected {
+		rejected += num
+	}
+	fmt.Printf("%s Dry run complete, total txs %d\n", time.Now().UTC().Format(time.UnixDate), count)
+	this.printBlocks("Would pack")
+	fmt.Printf("Would skip duplicated txs:%d\n", this.skipped)
+	fmt.Printf("Would reject txs:%d\n", rejected)
+	for _, entry := range utils.SortCounts(this.rejected) {
+		fmt.Printf("  %s:%d\n", entry.Key, entry.Count)
+	}
+}
+
+// printBlocks prints the blocks packed in this run and their distributions of tx count, size and gas limit
+func (this *importReport) printBlocks(prefix string) {
+	this.blocks.Finish()
+	fmt.Printf("%s txs:%d in %d blocks\n", prefix, this.packedTxs, this.blocks.Blocks)
+	if this.blocks.Blocks == 0 {
+		return
+	}
+	fmt.Printf("  txs per block min/avg/p50/p90/p99/max:%s\n", formatDistribution(this.blocks.Txs))
+	fmt.Printf("  block size min/avg/p50/p90/p99/max:%s\n", formatDistribution(this.blocks.Size))
+	fmt.Printf("  block gas limit min/avg/p50/p90/p99/max:%s\n", formatDistribution(this.blocks.Gas))
+}
+
+// sourceTxs adds the txs of the source blocks of tximport and txmirror to a block packer. A tx that
+// cannot be decoded or is already in the ledger is not packed and counted as an error.
+type sourceTxs struct {
+	ldg       *ledger.Ledger
+	packer    *utils.BlockPacker
+	report    *importReport
+	recovered map[common.Uint256]struct{} // txs added to the ledger after the journal was last saved
+	packed    int
+	errNum    int
+}
+
+// flushRejects writes the rejects of the source blocks before next without a tx left in the packer
+func (this *sourceTxs) flushRejects(next uint32) {
+	if item := this.packer.Pending(); item != nil && item.SourceHeight < next {
+		next = item.SourceHeight
+	}
+	this.report.flush(next)
+}
+
+// add adds a tx of a source block to the packer and returns the blocks that are full. A tx added
+// to the ledger after the journal was last saved is counted as packed, and recovered is true then.
+func (this *sourceTxs) add(block *utils.ExportBlock, etx *utils.ExportTx, progress utils.ImportProgress) (
+	batches []*utils.PackedBlock, recovered bool) {
+	dryRun := this.report.dryRun
+	if etx.Err != nil {
+		if !dryRun {
+			fmt.Println(etx.Err)
+		}
+		this.errNum++
+		this.report.reject(block, etx, etx.ErrKind, etx.Err.Error())
+		return nil, false
+	}
+	tx := etx.Tx
+	exist, err := this.ldg.IsContainTransaction(tx.Hash())
+	if err != nil {
+		if !dryRun {
+			fmt.Printf("Unknown error tx %x\n", tx.Hash())
+		}
+		this.errNum++
+		this.report.reject(block, etx, utils.REJECT_REASON_LEDGER, err.Error())
+		return nil, false
+	} else if exist {
+		if _, ok := this.recovered[tx.Hash()]; ok {
+			delete(this.recovered, tx.Hash())
+			this.packed++
+			return nil, true
+		}
+		if !dryRun {
+			fmt.Printf("Duplicated input tx %x\n", tx.Hash())
+		}
+		this.errNum++
+		this.report.skip(block, etx, "already in the ledger")
+		return nil, false
+	}
+	if dryRun && !this.report.check(block, etx, this.ldg) {
+		this.errNum++
+		return nil, false
+	}
+	return this.packer.Add(&utils.PackItem{
+		Tx:           etx,
+		SourceHeight: block.Height,
+		SourceTime:   block.Timestamp,
+		Progress:     progress,
+	}), false
+}
+
+// resumeImport continues reading the import file at the progress recorded in the import journal, the caller
+// skips the first journal.SourceTxs txs of the first block read. It also returns the txs of the blocks added
+// after the journal was saved, they are imported already.
+func resumeImport(ifile *os.File, ldg *ledger.Ledger, journal *utils.ImportJournal) (utils.ExportReader,
+	map[common.Uint256]struct{}, error) {
+	txFile := journal.File
+	found, err := journal.Load()
+	if err != nil {
+		return nil, nil, cli.NewExitError(err, EXIT_CODE_INPUT)
+	}
+	if !found {
+		fmt.Printf("No import journal found, import file:%s from the start\n", txFile)
+		reader, err := utils.NewExportReader(ifile)
+		if err != nil {
+			return nil, nil, cli.NewExitError(fmt.Sprintf("Read file:%s error:%s", txFile, err), EXIT_CODE_INPUT)
+		}
+		return reader, nil, nil
+	}
+	if journal.File != txFile {
+		return nil, nil, cli.NewExitError(fmt.Sprintf("The ledger is imported from file:%s, cannot resume it with file:%s",
+			journal.File, txFile), EXIT_CODE_INPUT)
+	}
+	blockHeight := ldg.GetCurrentBlockHeight()
+	if blockHeight < journal.BlockHeight {
+		return nil, nil, cli.NewExitError(fmt.Sprintf("The ledger is at block %d but the import journal is at block %d",
+			blockHeight, journal.BlockHeight), EXIT_CODE_LEDGER)
+	}
+	recovered, err := ledgerTxsAfter(ldg, journal.BlockHeight)
+	if err != nil {
+		return nil, nil, cli.NewExitError(err, EXIT_CODE_LEDGER)
+	}
+	if len(recovered) != 0 {
+		fmt.Printf("%d blocks with %d txs were added after the import journal was saved, they are counted as packed\n",
+			blockHeight-journal.BlockHeight, len(recovered))
+	}
+	reader, err := utils.NewExportReaderAt(ifile, &journal.Position)
+	if err != nil {
+		return nil, nil, cli.NewExitError(fmt.Sprintf("Resume file:%s error:%s", txFile, err), EXIT_CODE_INPUT)
+	}
+	fmt.Printf("Resume import after the last packed tx of source block %d, current block height %d\n", journal.SourceHeight, blockHeight)
+	return reader, recovered, nil
+}
+
+// ledgerTxsAfter returns the txs of the blocks of the ledger after the block height
+func ledgerTxsAfter(ldg *ledger.Ledger, height uint32) (map[common.Uint256]struct{}, error) {
+	txs := make(map[common.Uint256]struct{})
+	for h := height + 1; h <= ldg.GetCurrentBlockHeight(); h++ {
+		block, err := ldg.GetBlockByHeight(h)
+		if err != nil {
+			return nil, fmt.Errorf("Get block height:%d error:%s", h, err)
+		}
+		for _, tx := range block.Transactions {
+			txs[tx.Hash()] = struct{}{}
+		}
+	}
+	return txs, nil
 }
@@ -0,0 +1,104 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package command
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ontio/txreplay/utils"
+)
+
+// readTestRejects returns the source height and line of the records of a reject file
+func readTestRejects(t *testing.T, fileName string) [][2]uint64 {
+	file, err := os.Open(fileName)
+	if err != nil {
+		t.Fatalf("Open error:%s", err)
+	}
+	defer file.Close()
+	var records [][2]uint64
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		record := &utils.RejectRecord{}
+		err = json.Unmarshal(scanner.Bytes(), record)
+		if err != nil {
+			t.Fatalf("invalid reject record %s: %s", scanner.Text(), err)
+		}
+		records = append(records, [2]uint64{uint64(record.SourceHeight), record.Line})
+	}
+	return records
+}
+
+func TestImportReportFlush(t *testing.T) {
+	dir, err := ioutil.TempDir("", "txreplay-test")
+	if err != nil {
+		t.Fatalf("TempDir error:%s", err)
+	}
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "rejects.json")
+	report := newImportReport(false)
+	report.rejects, err = utils.NewRejectWriter(fileName)
+	if err != nil {
+		t.Fatalf("NewRejectWriter error:%s", err)
+	}
+	defer report.rejects.Close()
+
+	reject := func(height uint32, line uint64, reason string) {
+		block := &utils.ExportBlock{Height: height}
+		report.reject(block, &utils.ExportTx{Line: line, Hash: "00"}, reason, "rejected")
+	}
+	// the execution rejects of a block come after the rejects of the later blocks
+	reject(5, 50, utils.REJECT_REASON_VERIFY)
+	reject(3, 31, utils.REJECT_REASON_VERIFY)
+	reject(7, 70, utils.REJECT_REASON_DUPLICATE)
+	reject(3, 30, utils.REJECT_REASON_EXECUTION)
+	report.flush(3)
+	if records := readTestRejects(t, fileName); len(records) != 0 {
+		t.Fatalf("flushed %v before block 3", records)
+	}
+	report.flush(6)
+	if records := readTestRejects(t, fileName); len(records) != 3 {
+		t.Fatalf("flushed %v before block 6, expected the records of blocks 3 and 5", records)
+	}
+	reject(6, 60, utils.REJECT_REASON_EXECUTION)
+	report.flush(math.MaxUint32)
+	if report.err != nil {
+		t.Fatalf("flush error:%s", report.err)
+	}
+	// the reject of block 6 comes after the one of block 7 but is written before it
+	expected := [][2]uint64{{3, 30}, {3, 31}, {5, 50}, {6, 60}, {7, 70}}
+	records := readTestRejects(t, fileName)
+	if len(records) != len(expected) {
+		t.Fatalf("records %v, expected %v", records, expected)
+	}
+	for i := range records {
+		if records[i] != expected[i] {
+			t.Errorf("records %v, expected %v", records, expected)
+			break
+		}
+	}
+	if len(report.held) != 0 {
+		t.Errorf("%d records still held", len(report.held))
+	}
+}
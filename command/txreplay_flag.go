@@ -22,6 +22,7 @@ import (
 	"strings"
 
 	"github.com/ontio/ontology/common/config"
+	"github.com/ontio/txreplay/utils"
 	"github.com/urfave/cli"
 )
 
@@ -43,12 +44,274 @@ var (
 		Value: 0,
 	}
 
+	TxExportEndHeightFlag = cli.UintFlag{
+		Name:  "endheight",
+		Usage: "Using to specifies the end of the block to be exported, the end block is included. Default is the current height.",
+	}
+
+	TxExportStartHashFlag = cli.StringFlag{
+		Name:  "starthash",
+		Usage: "Using to specifies the hash of the beginning block to be exported.",
+	}
+
+	TxExportEndHashFlag = cli.StringFlag{
+		Name:  "endhash",
+		Usage: "Using to specifies the hash of the end block to be exported.",
+	}
+
+	TxExportStartTimeFlag = cli.StringFlag{
+		Name:  "starttime",
+		Usage: "Export blocks produced at or after the UTC time, in unix seconds or like \"2018-07-03 12:00:00\"",
+	}
+
+	TxExportEndTimeFlag = cli.StringFlag{
+		Name:  "endtime",
+		Usage: "Export blocks produced at or before the UTC time, in unix seconds or like \"2018-07-03 12:00:00\"",
+	}
+
+	TxExportContractFlag = cli.StringFlag{
+		Name:  "contract",
+		Usage: "Only export txs invoking or deploying the contracts, a comma separated list of hex addresses or native contract names like ont, ong",
+	}
+
+	TxExportPayerFlag = cli.StringFlag{
+		Name:  "payer",
+		Usage: "Only export txs paid by the accounts, a comma separated list of base58 addresses",
+	}
+
+	TxExportSignerFlag = cli.StringFlag{
+		Name:  "signer",
+		Usage: "Only export txs signed by any of the accounts, a comma separated list of base58 addresses",
+	}
+
+	TxExportTxTypeFlag = cli.StringFlag{
+		Name:  "txtype",
+		Usage: "Only export txs of the types, deploy or invoke",
+	}
+
+	TxExportMinGasPriceFlag = cli.Uint64Flag{
+		Name:  "mingasprice",
+		Usage: "Only export txs with gas price not lower than the value",
+	}
+
+	TxExportMaxGasPriceFlag = cli.Uint64Flag{
+		Name:  "maxgasprice",
+		Usage: "Only export txs with gas price not higher than the value, 0 means no limit",
+	}
+
+	TxExportFormatFlag = cli.StringFlag{
+		Name:  "format",
+		Usage: "Format of export file, text or binary",
+		Value: utils.EXPORT_FORMAT_TEXT,
+	}
+
+	TxExportCompressFlag = cli.StringFlag{
+		Name:  "compress",
+		Usage: "Compression of export file, none, gzip or zstd. Default is chosen by the file extension, .gz for gzip and .zst for zstd",
+	}
+
+	TxExportBatchFlag = cli.UintFlag{
+		Name:  "batchsize",
+		Usage: "Blocks fetched by each routine in one JSON-RPC batch request, single requests are used if the node does not support batches",
+		Value: 10,
+	}
+
+	TxExportCrossCheckFlag = cli.UintFlag{
+		Name:  "crosscheck",
+		Usage: "Compare the block hash on all nodes of --endpoints at every this many heights, 0 means never",
+		Value: 1000,
+	}
+
+	TxExportFollowFlag = cli.BoolFlag{
+		Name:  "follow",
+		Usage: "Keep exporting the new blocks after catching up, into segment files named after --file and listed in <file>.manifest, until Ctrl-C",
+	}
+
+	TxExportRotateSizeFlag = cli.UintFlag{
+		Name:  "rotatesize",
+		Usage: "Start a new segment of --follow after this many MB, 0 means no limit",
+	}
+
+	TxExportRotateBlocksFlag = cli.UintFlag{
+		Name:  "rotateblocks",
+		Usage: "Start a new segment of --follow after this many exported blocks, 0 means no limit",
+	}
+
+	TxExportRotateTimeFlag = cli.UintFlag{
+		Name:  "rotatetime",
+		Usage: "Start a new segment of --follow for each window of this many minutes of block time, aligned to 00:00 UTC, 0 means no window",
+	}
+
+	TxExportRetainFlag = cli.UintFlag{
+		Name:  "retain",
+		Usage: "Remove the segments of --follow whose last block is older than this many hours before the latest block, 0 keeps all",
+	}
+
+	TxExportPollFlag = cli.UintFlag{
+		Name:  "pollinterval",
+		Usage: "Interval (ms) of polling the node for new blocks with --follow",
+		Value: 1000,
+	}
+
+	TxExportResumeFlag = cli.BoolFlag{
+		Name:  "resume",
+		Usage: "Continue an interrupted export after the last complete block in the export file",
+	}
+
+	ChainDirFlag = cli.StringFlag{
+		Name:  "chaindir",
+		Usage: "Export from the ledger directory of a stopped node like ./Chain/ontology instead of the rpc server, use --networkid to set its network id",
+	}
+
+	BlockFileFlag = cli.StringFlag{
+		Name:  "blockfile",
+		Usage: "Path of block file exported by ontology",
+		Value: "./block.dat",
+	}
+
 	ImportTxFileFlag = cli.StringFlag{
 		Name:  "importtxsfile",
 		Usage: "Path of import txs file",
 		Value: DEFAULT_TX_EXPORT_FILE,
 	}
 
+	ImportResumeFlag = cli.BoolFlag{
+		Name:  "resume",
+		Usage: "Continue an interrupted import after the last packed tx recorded in the import journal of the ledger",
+	}
+
+	ImportDryRunFlag = cli.BoolFlag{
+		Name:  "dry-run",
+		Usage: "Check and verify every tx against the ledger and report what would be imported, without adding blocks",
+	}
+
+	ImportRejectFileFlag = cli.StringFlag{
+		Name:  "reject-file",
+		Usage: "Append a JSON record for every skipped or rejected tx to the file, which can be imported again to retry the txs",
+	}
+
+	ImportOriginalTimeFlag = cli.BoolFlag{
+		Name:  "originaltime",
+		Usage: "Stamp the built blocks with the time of their source blocks instead of the current time",
+	}
+
+	ImportTxsPerBlockFlag = cli.UintFlag{
+		Name:  "txsperblock",
+		Usage: "Pack at most the number of txs in a block, 0 means no limit",
+	}
+
+	ImportMaxBlockSizeFlag = cli.UintFlag{
+		Name:  "maxblocksize",
+		Usage: "Pack txs of at most the serialized size (bytes) in a block, 0 means no limit",
+	}
+
+	ImportMaxBlockGasFlag = cli.Uint64Flag{
+		Name:  "maxblockgas",
+		Usage: "Pack txs of at most the total gas limit in a block, 0 means no limit",
+	}
+
+	ImportMergeBlocksFlag = cli.UintFlag{
+		Name:  "mergeblocks",
+		Usage: "Pack the txs of the number of source blocks in a block. Without any packing option every source block is packed in a block, with only size limits the source blocks are ignored",
+	}
+
+	ImportTpsFlag = cli.Float64Flag{
+		Name:  "tps",
+		Usage: "Add blocks at the target rate of txs per second, limited by a token bucket of --burst txs",
+	}
+
+	ImportBpsFlag = cli.Float64Flag{
+		Name:  "bps",
+		Usage: "Add blocks at the target rate of blocks per second, limited by a token bucket of --burst blocks",
+	}
+
+	ImportBurstFlag = cli.UintFlag{
+		Name:  "burst",
+		Usage: "Txs of --tps or blocks of --bps that can be added at once after an idle time, 0 means the rate of one second",
+	}
+
+	ImportCadenceFlag = cli.Float64Flag{
+		Name:  "cadence",
+		Usage: "Add blocks at the intervals of their source block times sped up by the factor, 1 replays at the original cadence",
+	}
+
+	SendTpsFlag = cli.Float64Flag{
+		Name:  "tps",
+		Usage: "Send txs at the target rate of txs per second, limited by a token bucket of --burst txs. Default is no limit",
+	}
+
+	SendBurstFlag = cli.UintFlag{
+		Name:  "burst",
+		Usage: "Txs of --tps that can be sent at once after an idle time, 0 means the rate of one second",
+	}
+
+	SendRetryFlag = cli.UintFlag{
+		Name:  "retry",
+		Usage: "Times to retry a tx on the next endpoint if the node cannot be reached or its tx pool is full",
+		Value: 3,
+	}
+
+	SendRetryDelayFlag = cli.UintFlag{
+		Name:  "retrydelay",
+		Usage: "Delay (ms) before the first retry of a tx, the delay grows with each retry",
+		Value: 500,
+	}
+
+	SendConfirmFlag = cli.BoolFlag{
+		Name:  "confirm",
+		Usage: "Poll the nodes until every accepted tx is packed in a block or times out, and report its execution state and latency",
+	}
+
+	SendConfirmTimeoutFlag = cli.UintFlag{
+		Name:  "confirmtimeout",
+		Usage: "Seconds after sending to give up waiting for a tx to be packed",
+		Value: 120,
+	}
+
+	SendPollIntervalFlag = cli.UintFlag{
+		Name:  "pollinterval",
+		Usage: "Interval (ms) of polling the nodes for the blocks of the accepted txs",
+		Value: 1000,
+	}
+
+	SendResultFileFlag = cli.StringFlag{
+		Name:  "resultfile",
+		Usage: "Write a JSON record with the state, block height and latency of every tx to the file",
+	}
+
+	MirrorHeightFlag = cli.UintFlag{
+		Name:  "height",
+		Usage: "Source block to start mirroring from, default is the next block of the source node",
+	}
+
+	MirrorResumeFlag = cli.BoolFlag{
+		Name:  "resume",
+		Usage: "Continue an interrupted mirror after the last source block recorded in the mirror journal of the ledger",
+	}
+
+	MirrorPollFlag = cli.UintFlag{
+		Name:  "pollinterval",
+		Usage: "Interval (ms) of polling the source node for new blocks",
+		Value: 1000,
+	}
+
+	AnalyzeRangeFlag = cli.UintFlag{
+		Name:  "blockrange",
+		Usage: "Number of blocks in each block range of the gas distributions",
+		Value: 100000,
+	}
+
+	AnalyzeTopFlag = cli.UintFlag{
+		Name:  "top",
+		Usage: "Number of rows shown in each table, 0 shows all rows",
+		Value: 20,
+	}
+
+	AnalyzeJsonFlag = cli.BoolFlag{
+		Name:  "json",
+		Usage: "Print the analysis as JSON",
+	}
+
 	HostIPFlag = cli.StringFlag{
 		Name:  "ip",
 		Usage: "node's ip address",
@@ -61,6 +324,40 @@ var (
 		Value: 20336,
 	}
 
+	RpcEndpointsFlag = cli.StringFlag{
+		Name:  "endpoints",
+		Usage: "Comma separated rpc addresses like 127.0.0.1:20336 of several nodes to spread the requests over, instead of --ip and --rpcport. txexport also takes one RESTful address like rest://127.0.0.1:20334 or WebSocket address like ws://127.0.0.1:20335",
+	}
+
+	RpcMaxErrorRateFlag = cli.Float64Flag{
+		Name:  "maxerrorrate",
+		Usage: "Eject an endpoint of --endpoints for a while if more than this ratio of its latest requests failed, 0 means never",
+		Value: 0.5,
+	}
+
+	RpcMaxLatencyFlag = cli.UintFlag{
+		Name:  "maxlatency",
+		Usage: "Eject an endpoint of --endpoints for a while if the average latency (ms) of its latest requests is higher, 0 means never",
+	}
+
+	RpcTimeoutFlag = cli.UintFlag{
+		Name:  "rpctimeout",
+		Usage: "Timeout (s) of each rpc request, 0 means no timeout",
+		Value: 30,
+	}
+
+	RpcRetryFlag = cli.UintFlag{
+		Name:  "rpcretry",
+		Usage: "Times to retry an rpc request after a network error, a timeout or a 5xx response",
+		Value: 3,
+	}
+
+	RpcBackoffFlag = cli.UintFlag{
+		Name:  "rpcbackoff",
+		Usage: "Delay (ms) before the first retry of an rpc request, doubled for each retry",
+		Value: 500,
+	}
+
 	RoutineNumFlag = cli.UintFlag{
 		Name:  "routinenum",
 		Usage: "concurrent routine number",
@@ -68,7 +365,7 @@ var (
 	}
 	TimerFlag = cli.UintFlag{
 		Name:  "constanttimer",
-		Usage: "constant timer delay (ms)",
+		Usage: "constant timer delay (ms) between blocks, used without --tps, --bps and --cadence",
 		Value: 1,
 	}
 	NetworkIdFlag = cli.UintFlag{
@@ -0,0 +1,304 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package command
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gosuri/uiprogress"
+	"github.com/urfave/cli"
+
+	"github.com/ontio/txreplay/utils"
+)
+
+var TxSendCommand = cli.Command{
+	Name:      "txsend",
+	Usage:     "Send the txs of an export file to running nodes",
+	ArgsUsage: "",
+	Action:    sendTxs,
+	Flags: []cli.Flag{
+		TxExportFileFlag,
+		HostIPFlag,
+		RPCPortFlag,
+		RpcTimeoutFlag,
+		RpcRetryFlag,
+		RpcBackoffFlag,
+		RpcEndpointsFlag,
+		RoutineNumFlag,
+		SendTpsFlag,
+		SendBurstFlag,
+		SendRetryFlag,
+		SendRetryDelayFlag,
+		SendConfirmFlag,
+		SendConfirmTimeoutFlag,
+		SendPollIntervalFlag,
+		SendResultFileFlag,
+	},
+	Description: "Stream an export file and submit every tx to the rpc endpoints of nodes by sendrawtransaction, retrying transient errors",
+}
+
+// sendReport counts the results of the txs sent by the routines
+type sendReport struct {
+	lock      sync.Mutex
+	sent      uint64
+	accepted  uint64
+	retried   uint64
+	badTxs    uint64
+	rejected  map[string]uint64            // reason -> tx count
+	endpoints map[string]map[string]uint64 // endpoint -> reason -> tx count, "" is accepted
+	results   *utils.ResultWriter
+	err       error // first error writing the result file
+}
+
+func newSendReport() *sendReport {
+	return &sendReport{
+		rejected:  make(map[string]uint64),
+		endpoints: make(map[string]map[string]uint64),
+	}
+}
+
+func (this *sendReport) add(result *utils.SendResult) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.sent++
+	if result.Attempts > 1 {
+		this.retried++
+	}
+	if result.Reason == "" {
+		this.accepted++
+	} else {
+		this.rejected[result.Reason]++
+	}
+	counts, ok := this.endpoints[result.Endpoint]
+	if !ok {
+		counts = make(map[string]uint64)
+		this.endpoints[result.Endpoint] = counts
+	}
+	counts[result.Reason]++
+}
+
+// write records the final result of a tx in the result file
+func (this *sendReport) write(result *utils.TxResult) {
+	if this.results == nil {
+		return
+	}
+	err := this.results.Write(result)
+	if err != nil {
+		this.lock.Lock()
+		if this.err == nil {
+			this.err = err
+		}
+		this.lock.Unlock()
+	}
+}
+
+func (this *sendReport) progress() string {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	return fmt.Sprintf("Sent %d accepted %d rejected %d", this.sent, this.accepted, this.sent-this.accepted)
+}
+
+func (this *sendReport) print(endpoints []string) {
+	fmt.Printf("Sent txs:%d accepted:%d rejected:%d retried:%d undecodable:%d\n",
+		this.sent, this.accepted, this.sent-this.accepted, this.retried, this.badTxs)
+	for _, entry := range utils.SortCounts(this.rejected) {
+		fmt.Printf("  %s:%d\n", entry.Key, entry.Count)
+	}
+	for _, endpoint := range endpoints {
+		counts := this.endpoints[endpoint]
+		rejected := uint64(0)
+		for reason, num := range counts {
+			if reason != "" {
+				rejected += num
+			}
+		}
+		fmt.Printf("Endpoint %s accepted:%d rejected:%d\n", endpoint, counts[""], rejected)
+	}
+}
+
+func sendTxs(ctx *cli.Context) error {
+	txFile := ctx.String(GetFlagName(TxExportFileFlag))
+	if txFile == "" {
+		fmt.Println("Missing file argument")
+		cli.ShowSubcommandHelp(ctx)
+		return nil
+	}
+	endpoints, err := rpcEndpoints(ctx)
+	if err != nil {
+		return err
+	}
+	for _, endpoint := range endpoints {
+		if !utils.IsRpcAddr(endpoint) {
+			return fmt.Errorf("txsend sends txs by JSON-RPC only, not to %s", endpoint)
+		}
+	}
+	routineNum := ctx.Uint(GetFlagName(RoutineNumFlag))
+	if routineNum == 0 {
+		routineNum = 1
+	}
+	var rateLimiter utils.RateLimiter
+	if ctx.IsSet(GetFlagName(SendTpsFlag)) {
+		tps := ctx.Float64(GetFlagName(SendTpsFlag))
+		if tps <= 0 {
+			return fmt.Errorf("--%s should be positive", GetFlagName(SendTpsFlag))
+		}
+		rateLimiter = utils.NewTxRateLimiter(tps, ctx.Uint(GetFlagName(SendBurstFlag)))
+		defer rateLimiter.Stop()
+	}
+	config := rpcConfig(ctx)
+	// the sender retries on the next endpoint itself, so its clients do not retry
+	sendConfig := *config
+	sendConfig.Retries = 0
+	clients := make([]*utils.RpcClient, 0, len(endpoints))
+	sendClients := make([]*utils.RpcClient, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		clients = append(clients, utils.NewRpcClient(endpoint, config))
+		sendClients = append(sendClients, utils.NewRpcClient(endpoint, &sendConfig))
+	}
+	sender := utils.NewTxSender(sendClients, ctx.Uint(GetFlagName(SendRetryFlag)),
+		time.Millisecond*time.Duration(ctx.Uint(GetFlagName(SendRetryDelayFlag))))
+	runCtx, cancel := interruptContext()
+	defer cancel()
+	report := newSendReport()
+	if resultFile := ctx.String(GetFlagName(SendResultFileFlag)); resultFile != "" {
+		report.results, err = utils.NewResultWriter(resultFile)
+		if err != nil {
+			return err
+		}
+		defer report.results.Close()
+	}
+	var tracker *utils.ConfirmTracker
+	if ctx.Bool(GetFlagName(SendConfirmFlag)) {
+		tracker = utils.NewConfirmTracker(runCtx, clients,
+			time.Millisecond*time.Duration(ctx.Uint(GetFlagName(SendPollIntervalFlag))),
+			time.Second*time.Duration(ctx.Uint(GetFlagName(SendConfirmTimeoutFlag))),
+			routineNum, report.write)
+	}
+
+	ifile, err := os.OpenFile(txFile, os.O_RDONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("Open file:%s error:%s", txFile, err)
+	}
+	defer ifile.Close()
+	fileInfo, err := ifile.Stat()
+	if err != nil {
+		return fmt.Errorf("Stat file:%s error:%s", txFile, err)
+	}
+	reader, err := utils.NewExportReader(ifile)
+	if err != nil {
+		return fmt.Errorf("Read file:%s error:%s", txFile, err)
+	}
+	defer reader.Close()
+
+	// the file is streamed, so the progress is the part of the file read
+	uiprogress.Start()
+	bar := uiprogress.AddBar(int(fileInfo.Size())).
+		AppendCompleted().
+		AppendElapsed().
+		PrependFunc(func(b *uiprogress.Bar) string {
+			return report.progress()
+		})
+
+	fmt.Printf("Start send txs to %d endpoints...\n", len(endpoints))
+	start := time.Now()
+	jobs := make(chan *utils.ExportTx, routineNum)
+	wg := &sync.WaitGroup{}
+	for i := uint(0); i < routineNum; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for etx := range jobs {
+				if runCtx.Err() != nil {
+					continue
+				}
+				sentAt := time.Now()
+				result := sender.Send(runCtx, etx.Tx)
+				// a tx canceled by Ctrl-C is neither accepted nor rejected
+				if runCtx.Err() != nil {
+					continue
+				}
+				report.add(result)
+				txHash := etx.Tx.Hash()
+				txResult := utils.NewTxResult(txHash.ToHexString(), sentAt, result)
+				if tracker != nil && txResult.State == utils.TX_STATE_SENT {
+					tracker.Track(txResult)
+				} else {
+					report.write(txResult)
+				}
+			}
+		}()
+	}
+
+	var readErr error
+	for runCtx.Err() == nil {
+		block, err := reader.ReadBlock()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			readErr = fmt.Errorf("Read file:%s error:%s", txFile, err)
+			break
+		}
+		for _, etx := range block.Txs {
+			if etx.Err != nil {
+				report.lock.Lock()
+				report.badTxs++
+				report.lock.Unlock()
+				continue
+			}
+			if rateLimiter != nil && rateLimiter.Wait(runCtx, 1, block.Timestamp) != nil {
+				break
+			}
+			jobs <- etx
+		}
+		if offset, err := ifile.Seek(0, io.SeekCurrent); err == nil {
+			bar.Set(int(offset))
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	bar.Set(int(fileInfo.Size()))
+	uiprogress.Stop()
+
+	fmt.Printf("%s Send txs complete, tps %.1f\n", time.Now().UTC().Format(time.UnixDate),
+		float64(report.sent)/time.Since(start).Seconds())
+	report.print(endpoints)
+	if tracker != nil {
+		fmt.Printf("Waiting for the confirmations of %d txs...\n", tracker.Pending())
+		printConfirmStats(tracker.Close())
+	}
+	if readErr != nil {
+		return readErr
+	}
+	if runCtx.Err() != nil {
+		return cli.NewExitError("Send interrupted", EXIT_CODE_INTERRUPTED)
+	}
+	return report.err
+}
+
+func printConfirmStats(stats *utils.ConfirmStats) {
+	fmt.Printf("%s Confirm txs complete, success:%d failed:%d included:%d timeout:%d unconfirmed:%d\n",
+		time.Now().UTC().Format(time.UnixDate), stats.States[utils.TX_STATE_SUCCESS], stats.States[utils.TX_STATE_FAILED],
+		stats.States[utils.TX_STATE_INCLUDED], stats.States[utils.TX_STATE_TIMEOUT], stats.States[utils.TX_STATE_UNCONFIRMED])
+	fmt.Printf("  latency ms min/avg/p50/p90/p99/max:%s\n", formatDistribution(stats.Latency))
+}
@@ -38,6 +38,11 @@ func setupTxReplay() *cli.App {
 	app.Commands = []cli.Command{
 		command.TxExportCommand,
 		command.TxImportCommand,
+		command.TxInspectCommand,
+		command.TxAnalyzeCommand,
+		command.TxConvertCommand,
+		command.TxSendCommand,
+		command.TxMirrorCommand,
 	}
 	sort.Sort(cli.CommandsByName(app.Commands))
 	app.Before = func(context *cli.Context) error {
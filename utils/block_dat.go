@@ -0,0 +1,134 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package utils
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	cutils "github.com/ontio/ontology/cmd/utils"
+	"github.com/ontio/ontology/common/serialization"
+	"github.com/ontio/ontology/core/types"
+)
+
+// maxBlockDatRecordLength bounds the length prefix of a block, far above any block a node accepts,
+// so a corrupted length fails instead of allocating the memory
+const maxBlockDatRecordLength = 64 * 1024 * 1024
+
+// BlockDatReader reads the block.dat files written by the --export of ontology or by tximport:
+// the export metadata, then every block up to the metadata height, each one compressed and
+// prefixed with its uint32 length.
+type BlockDatReader struct {
+	reader   *bufio.Reader
+	metadata *cutils.ExportBlockMetadata
+	next     uint32
+	started  bool // a block is read, next follows its height
+}
+
+func NewBlockDatReader(r io.Reader) (*BlockDatReader, error) {
+	reader := bufio.NewReader(r)
+	metadata := cutils.NewExportBlockMetadata()
+	err := metadata.Deserialize(reader)
+	if err != nil {
+		return nil, fmt.Errorf("read block file metadata error:%s", err)
+	}
+	return &BlockDatReader{
+		reader:   reader,
+		metadata: metadata,
+	}, nil
+}
+
+// BlockHeight is the height of the last block in the file
+func (this *BlockDatReader) BlockHeight() uint32 {
+	return this.metadata.BlockHeight
+}
+
+// NextHeight is the height of the block returned by the next ReadBlock or SkipBlock, it is known
+// after the first block is read
+func (this *BlockDatReader) NextHeight() uint32 {
+	return this.next
+}
+
+// ReadBlock returns the next block, or io.EOF after the last block
+func (this *BlockDatReader) ReadBlock() (*types.Block, error) {
+	data, err := this.readBlockData()
+	if err != nil {
+		return nil, err
+	}
+	blockData, err := cutils.DecompressBlockData(data, this.metadata.CompressType)
+	if err != nil {
+		return nil, fmt.Errorf("decompress %s error:%s", this.position(), err)
+	}
+	block, err := deserializeBlock(blockData)
+	if err != nil {
+		return nil, fmt.Errorf("deserialize %s error:%s", this.position(), err)
+	}
+	// the first block sets the height, the file does not have to start at the genesis block
+	if this.started && block.Header.Height != this.next {
+		return nil, fmt.Errorf("%s has height %d", this.position(), block.Header.Height)
+	}
+	if block.Header.Height > this.metadata.BlockHeight {
+		return nil, fmt.Errorf("block height %d is over the last block %d of the file", block.Header.Height, this.metadata.BlockHeight)
+	}
+	this.started = true
+	this.next = block.Header.Height + 1
+	return block, nil
+}
+
+// SkipBlock passes over the next block without decompressing it, a block has to be read first
+// to know the height
+func (this *BlockDatReader) SkipBlock() error {
+	if !this.started {
+		return fmt.Errorf("cannot skip a block before the first block is read")
+	}
+	_, err := this.readBlockData()
+	if err != nil {
+		return err
+	}
+	this.next++
+	return nil
+}
+
+func (this *BlockDatReader) readBlockData() ([]byte, error) {
+	if this.started && this.next > this.metadata.BlockHeight {
+		return nil, io.EOF
+	}
+	size, err := serialization.ReadUint32(this.reader)
+	if err != nil {
+		return nil, fmt.Errorf("read length of %s error:%s", this.position(), err)
+	}
+	if size > maxBlockDatRecordLength {
+		return nil, fmt.Errorf("invalid length %d of %s", size, this.position())
+	}
+	data := make([]byte, size)
+	_, err = io.ReadFull(this.reader, data)
+	if err != nil {
+		return nil, fmt.Errorf("read %s error:%s", this.position(), err)
+	}
+	return data, nil
+}
+
+// position describes the next block in the errors
+func (this *BlockDatReader) position() string {
+	if !this.started {
+		return "the first block"
+	}
+	return fmt.Sprintf("block:%d", this.next)
+}
@@ -0,0 +1,165 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package utils
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	cutils "github.com/ontio/ontology/cmd/utils"
+	"github.com/ontio/ontology/common/serialization"
+	"github.com/ontio/ontology/core/types"
+)
+
+// writeTestBlockDat returns a block.dat of the blocks with blockHeight in its metadata
+func writeTestBlockDat(t *testing.T, blocks []*types.Block, blockHeight uint32) []byte {
+	buf := bytes.NewBuffer(nil)
+	metadata := cutils.NewExportBlockMetadata()
+	metadata.BlockHeight = blockHeight
+	err := metadata.Serialize(buf)
+	if err != nil {
+		t.Fatalf("metadata.Serialize error:%s", err)
+	}
+	for _, block := range blocks {
+		data, err := cutils.CompressBlockData(block.ToArray(), metadata.CompressType)
+		if err != nil {
+			t.Fatalf("CompressBlockData error:%s", err)
+		}
+		serialization.WriteUint32(buf, uint32(len(data)))
+		buf.Write(data)
+	}
+	return buf.Bytes()
+}
+
+// newTestBlockDatChain returns a chain with a tx in every block
+func newTestBlockDatChain(count uint32) *testChain {
+	chain := newTestChain(count)
+	for _, block := range chain.blocks {
+		block.Transactions = []*types.Transaction{newTestTx(block.Header.Height)}
+	}
+	return chain
+}
+
+func TestBlockDatReader(t *testing.T) {
+	chain := newTestBlockDatChain(5)
+	reader, err := NewBlockDatReader(bytes.NewReader(writeTestBlockDat(t, chain.blocks, 4)))
+	if err != nil {
+		t.Fatalf("NewBlockDatReader error:%s", err)
+	}
+	if reader.BlockHeight() != 4 {
+		t.Errorf("block height %d, expected 4", reader.BlockHeight())
+	}
+	for height := uint32(0); height < 5; height++ {
+		if height == 2 {
+			err = reader.SkipBlock()
+			if err != nil {
+				t.Fatalf("SkipBlock error:%s", err)
+			}
+			continue
+		}
+		block, err := reader.ReadBlock()
+		if err != nil {
+			t.Fatalf("ReadBlock %d error:%s", height, err)
+		}
+		if block.Hash() != chain.blocks[height].Hash() || len(block.Transactions) != 1 ||
+			block.Transactions[0].Hash() != chain.blocks[height].Transactions[0].Hash() {
+			t.Errorf("block %d differs from the block written", height)
+		}
+		if reader.NextHeight() != height+1 {
+			t.Errorf("next height %d, expected %d", reader.NextHeight(), height+1)
+		}
+	}
+	if _, err = reader.ReadBlock(); err != io.EOF {
+		t.Errorf("ReadBlock after the last block returned %v, expected EOF", err)
+	}
+}
+
+func TestBlockDatReaderHeights(t *testing.T) {
+	chain := newTestBlockDatChain(8)
+	// a file written from a height other than the genesis block
+	reader, err := NewBlockDatReader(bytes.NewReader(writeTestBlockDat(t, chain.blocks[5:], 7)))
+	if err != nil {
+		t.Fatalf("NewBlockDatReader error:%s", err)
+	}
+	if err = reader.SkipBlock(); err == nil {
+		t.Errorf("no error skipping a block before the first block is read")
+	}
+	block, err := reader.ReadBlock()
+	if err != nil {
+		t.Fatalf("ReadBlock error:%s", err)
+	}
+	if block.Header.Height != 5 || reader.NextHeight() != 6 {
+		t.Errorf("block %d next %d, expected block 5 next 6", block.Header.Height, reader.NextHeight())
+	}
+	if err = reader.SkipBlock(); err != nil {
+		t.Fatalf("SkipBlock error:%s", err)
+	}
+	block, err = reader.ReadBlock()
+	if err != nil || block.Header.Height != 7 {
+		t.Fatalf("ReadBlock returned %v error %v, expected block 7", block, err)
+	}
+	if _, err = reader.ReadBlock(); err != io.EOF {
+		t.Errorf("ReadBlock after the last block returned %v, expected EOF", err)
+	}
+}
+
+func TestBlockDatReaderErrors(t *testing.T) {
+	chain := newTestBlockDatChain(5)
+	oversized := writeTestBlockDat(t, chain.blocks[:1], 4)
+	oversized = append(oversized, 0x01, 0x00, 0x00, 0x04) // length 64MB + 1
+	full := writeTestBlockDat(t, chain.blocks, 4)
+	tests := []struct {
+		name    string
+		data    []byte
+		reads   int // blocks read before the error
+		errText string
+	}{
+		{"gap", writeTestBlockDat(t, []*types.Block{chain.blocks[0], chain.blocks[2]}, 4), 1, "block:1 has height 2"},
+		{"over the metadata height", writeTestBlockDat(t, chain.blocks[4:], 3), 0, "over the last block 3"},
+		{"oversized length", oversized, 1, "invalid length 67108865 of block:1"},
+		{"truncated block", full[:len(full)-3], 4, "read block:4"},
+		{"truncated length", full[:len(full)-len(chain.blocks[4].ToArray())-2], 4, "read length of block:4"},
+		{"missing blocks", writeTestBlockDat(t, chain.blocks[:3], 4), 3, "read length of block:3"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reader, err := NewBlockDatReader(bytes.NewReader(test.data))
+			if err != nil {
+				t.Fatalf("NewBlockDatReader error:%s", err)
+			}
+			for i := 0; i < test.reads; i++ {
+				_, err = reader.ReadBlock()
+				if err != nil {
+					t.Fatalf("ReadBlock %d error:%s", i, err)
+				}
+			}
+			_, err = reader.ReadBlock()
+			if err == nil || !strings.Contains(err.Error(), test.errText) {
+				t.Errorf("ReadBlock returned %v, expected %s", err, test.errText)
+			}
+		})
+	}
+
+	_, err := NewBlockDatReader(bytes.NewReader(full[:10]))
+	if err == nil {
+		t.Errorf("no error for a truncated metadata")
+	}
+}
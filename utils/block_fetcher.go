@@ -0,0 +1,171 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+
+	"github.com/ontio/ontology/core/types"
+)
+
+// BlockResult is a fetched block, or the error of fetching it
+type BlockResult struct {
+	Height uint32
+	Block  *types.Block
+	Err    error
+}
+
+// fetchJob is a window of consecutive heights fetched together
+type fetchJob struct {
+	height  uint32
+	results []chan *BlockResult
+}
+
+// BlockFetcher fetches blocks with several routines and delivers them in height order
+type BlockFetcher struct {
+	source     BlockSource
+	routineNum uint
+	batchSize  uint
+	quit       chan struct{}
+	stopOnce   sync.Once
+}
+
+// NewBlockFetcher fetches blocks with routineNum routines. Each routine gets batchSize
+// consecutive blocks at once from a BatchBlockSource, other sources are asked block by block.
+func NewBlockFetcher(source BlockSource, routineNum, batchSize uint) *BlockFetcher {
+	if routineNum == 0 {
+		routineNum = 1
+	}
+	if _, ok := source.(BatchBlockSource); !ok || batchSize == 0 {
+		batchSize = 1
+	}
+	return &BlockFetcher{
+		source:     source,
+		routineNum: routineNum,
+		batchSize:  batchSize,
+		quit:       make(chan struct{}),
+	}
+}
+
+// Start fetches blocks in [startHeight, endHeight). The returned channel yields the
+// blocks in height order and is closed after the last block or after Stop
+func (this *BlockFetcher) Start(startHeight, endHeight uint32) <-chan *BlockResult {
+	jobs := make(chan *fetchJob)
+	//pending keeps the result slots in height order, its size bounds the blocks held in memory
+	pending := make(chan chan *BlockResult, this.routineNum*this.batchSize*2)
+	out := make(chan *BlockResult)
+
+	go func() {
+		defer close(jobs)
+		defer close(pending)
+		for height := startHeight; height < endHeight; {
+			job := &fetchJob{height: height}
+			for ; height < endHeight && len(job.results) < int(this.batchSize); height++ {
+				result := make(chan *BlockResult, 1)
+				select {
+				case pending <- result:
+				case <-this.quit:
+					return
+				}
+				job.results = append(job.results, result)
+			}
+			select {
+			case jobs <- job:
+			case <-this.quit:
+				return
+			}
+		}
+	}()
+
+	for i := uint(0); i < this.routineNum; i++ {
+		go func() {
+			for job := range jobs {
+				this.fetch(job)
+			}
+		}()
+	}
+
+	go func() {
+		defer close(out)
+		for result := range pending {
+			var res *BlockResult
+			select {
+			case res = <-result:
+			case <-this.quit:
+				return
+			}
+			select {
+			case out <- res:
+			case <-this.quit:
+				return
+			}
+		}
+	}()
+	return out
+}
+
+func (this *BlockFetcher) fetch(job *fetchJob) {
+	if len(job.results) == 1 {
+		block, err := this.source.GetBlock(job.height)
+		job.results[0] <- &BlockResult{Height: job.height, Block: block, Err: err}
+		return
+	}
+	heights := make([]uint32, 0, len(job.results))
+	for i := range job.results {
+		heights = append(heights, job.height+uint32(i))
+	}
+	blocks, err := this.source.(BatchBlockSource).GetBlocks(heights)
+	for i, result := range job.results {
+		if err != nil {
+			result <- &BlockResult{Height: heights[i], Err: err}
+		} else {
+			result <- &BlockResult{Height: heights[i], Block: blocks[i]}
+		}
+	}
+}
+
+// Stop aborts the pending fetches, it is safe to call Stop more than once
+func (this *BlockFetcher) Stop() {
+	this.stopOnce.Do(func() {
+		close(this.quit)
+	})
+}
+
+func deserializeBlock(blockData []byte) (*types.Block, error) {
+	block := &types.Block{}
+	err := block.Deserialize(bytes.NewBuffer(blockData))
+	if err != nil {
+		return nil, err
+	}
+	return block, nil
+}
+
+func deserializeBlocks(heights []uint32, blocksData [][]byte) ([]*types.Block, error) {
+	blocks := make([]*types.Block, 0, len(blocksData))
+	for i, blockData := range blocksData {
+		block, err := deserializeBlock(blockData)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read block at height %d err %v", heights[i], err)
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks, nil
+}
@@ -0,0 +1,189 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package utils
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ontio/ontology/common"
+	"github.com/ontio/ontology/core/types"
+)
+
+func testBlockTime(height uint32) uint32 {
+	return 1530000000 + height*6
+}
+
+// testChain is a BlockSource of generated blocks, a block every 6 seconds
+type testChain struct {
+	blocks []*types.Block
+	delay  func(height uint32) time.Duration // delay of a request, nil for none
+	gate   chan struct{}                     // requests wait until it is closed, nil for no wait
+	failAt map[uint32]bool                   // heights whose requests fail
+	lock   sync.Mutex
+	gets   int // GetBlock requests
+}
+
+func newTestChain(count uint32) *testChain {
+	chain := &testChain{failAt: make(map[uint32]bool)}
+	for height := uint32(0); height < count; height++ {
+		header := &types.Header{Height: height, Timestamp: testBlockTime(height)}
+		if height > 0 {
+			header.PrevBlockHash = chain.blocks[height-1].Hash()
+		}
+		chain.blocks = append(chain.blocks, &types.Block{Header: header})
+	}
+	return chain
+}
+
+func (this *testChain) Name() string {
+	return "test"
+}
+
+func (this *testChain) GetNetworkId() (uint32, error) {
+	return 1, nil
+}
+
+func (this *testChain) GetBlockCount() (uint32, error) {
+	return uint32(len(this.blocks)), nil
+}
+
+func (this *testChain) GetBlock(height uint32) (*types.Block, error) {
+	this.lock.Lock()
+	this.gets++
+	this.lock.Unlock()
+	if this.gate != nil {
+		<-this.gate
+	}
+	if this.delay != nil {
+		time.Sleep(this.delay(height))
+	}
+	if height >= uint32(len(this.blocks)) || this.failAt[height] {
+		return nil, fmt.Errorf("unknown block %d", height)
+	}
+	return this.blocks[height], nil
+}
+
+func (this *testChain) GetBlockByHash(hash common.Uint256) (*types.Block, error) {
+	for _, block := range this.blocks {
+		if block.Hash() == hash {
+			return block, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown block %s", hash.ToHexString())
+}
+
+func (this *testChain) Close() error {
+	return nil
+}
+
+// testBatchChain is a testChain answering batch requests
+type testBatchChain struct {
+	*testChain
+}
+
+func (this *testBatchChain) GetBlocks(heights []uint32) ([]*types.Block, error) {
+	blocks := make([]*types.Block, 0, len(heights))
+	for _, height := range heights {
+		block, err := this.GetBlock(height)
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks, nil
+}
+
+func TestBlockFetcherOrder(t *testing.T) {
+	chain := newTestChain(50)
+	// the later blocks of every 5 come first
+	chain.delay = func(height uint32) time.Duration {
+		return time.Duration(5-height%5) * time.Millisecond
+	}
+	chain.failAt[33] = true
+	tests := []struct {
+		name       string
+		source     BlockSource
+		routineNum uint
+		batchSize  uint
+	}{
+		{"one routine", chain, 1, 1},
+		{"routines", chain, 8, 1},
+		{"no routine", chain, 0, 1},
+		// the batch size is ignored by a source without batches
+		{"batch size without batches", chain, 4, 3},
+		{"batches", &testBatchChain{chain}, 4, 3},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fetcher := NewBlockFetcher(test.source, test.routineNum, test.batchSize)
+			defer fetcher.Stop()
+			height := uint32(2)
+			for result := range fetcher.Start(2, 40) {
+				if result.Height != height {
+					t.Fatalf("got block %d, expected %d", result.Height, height)
+				}
+				if result.Err != nil {
+					// a failed batch fails every block of the batch
+					if !chain.failAt[height] && (test.batchSize == 1 || (height-2)/3 != (33-2)/3) {
+						t.Errorf("block %d error:%s", height, result.Err)
+					}
+				} else if result.Block != chain.blocks[height] {
+					t.Errorf("block %d is not the block of the chain", height)
+				}
+				height++
+			}
+			if height != 40 {
+				t.Errorf("fetched up to block %d, expected 40", height)
+			}
+		})
+	}
+}
+
+func TestBlockFetcherStop(t *testing.T) {
+	chain := newTestChain(100)
+	chain.gate = make(chan struct{})
+	defer close(chain.gate)
+	fetcher := NewBlockFetcher(chain, 4, 1)
+	results := fetcher.Start(0, 100)
+	// wait until every routine is in a request
+	for start := time.Now(); ; time.Sleep(time.Millisecond) {
+		chain.lock.Lock()
+		gets := chain.gets
+		chain.lock.Unlock()
+		if gets == 4 {
+			break
+		}
+		if time.Since(start) > time.Second {
+			t.Fatalf("%d requests running, expected 4", gets)
+		}
+	}
+	fetcher.Stop()
+	fetcher.Stop()
+	select {
+	case result, ok := <-results:
+		if ok {
+			t.Fatalf("got block %d after Stop", result.Height)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("results not closed after Stop")
+	}
+}
@@ -0,0 +1,148 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package utils
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ontio/ontology/core/types"
+)
+
+// BlockFollower delivers the blocks of a chain in height order, first the blocks the node
+// already has, then each new block as the node gets it
+type BlockFollower struct {
+	source       BlockSource
+	routineNum   uint
+	batchSize    uint
+	pollInterval time.Duration
+}
+
+// NewBlockFollower fetches the blocks behind the node as NewBlockFetcher does, and then polls the
+// node for new blocks every pollInterval, or takes them as pushed by a BlockSubscriber
+func NewBlockFollower(source BlockSource, routineNum, batchSize uint, pollInterval time.Duration) *BlockFollower {
+	return &BlockFollower{
+		source:       source,
+		routineNum:   routineNum,
+		batchSize:    batchSize,
+		pollInterval: pollInterval,
+	}
+}
+
+// Follow calls handle with each block from startHeight and the block count of the node known at
+// the time, and calls idle with the next height before waiting for new blocks. It runs until ctx
+// is done or a callback fails, and returns the next height to handle. A fetch error stops it only
+// before it first catches up with the node, later the blocks are fetched again in the next round.
+func (this *BlockFollower) Follow(ctx context.Context, startHeight uint32,
+	handle func(block *types.Block, blockCount uint32) error, idle func(nextHeight uint32) error) (uint32, error) {
+	nextHeight := startHeight
+	blockCount, err := this.source.GetBlockCount()
+	if err != nil {
+		return nextHeight, fmt.Errorf("GetBlockCount error:%s", err)
+	}
+	var pushed <-chan *types.Block
+	if subscriber, ok := this.source.(BlockSubscriber); ok {
+		pushed, err = subscriber.SubscribeBlocks()
+		if err != nil {
+			return nextHeight, err
+		}
+	}
+	ticker := time.NewTicker(this.pollInterval)
+	defer ticker.Stop()
+
+	caughtUp := false
+	for ctx.Err() == nil {
+		if blockCount > nextHeight {
+			var fetchErr error
+			nextHeight, fetchErr, err = this.fetchRange(ctx, nextHeight, blockCount, handle)
+			if err != nil {
+				return nextHeight, err
+			}
+			if fetchErr != nil && ctx.Err() == nil {
+				if !caughtUp {
+					return nextHeight, fetchErr
+				}
+				fmt.Printf("%s\n", fetchErr)
+			}
+		}
+		err = idle(nextHeight)
+		if err != nil {
+			return nextHeight, err
+		}
+		if !caughtUp && nextHeight >= blockCount {
+			caughtUp = true
+			fmt.Printf("Caught up at block %d, following new blocks...\n", nextHeight)
+		}
+
+		select {
+		case block, ok := <-pushed:
+			if !ok {
+				pushed = nil
+				continue
+			}
+			if block.Header.Height >= blockCount {
+				blockCount = block.Header.Height + 1
+			}
+			// a pushed block is handled at once, a gap before it is fetched by the next round
+			if block.Header.Height == nextHeight {
+				err = handle(block, blockCount)
+				if err != nil {
+					return nextHeight, err
+				}
+				nextHeight++
+			}
+			continue
+		case <-ticker.C:
+		case <-ctx.Done():
+			continue
+		}
+		count, countErr := this.source.GetBlockCount()
+		if countErr != nil {
+			// a node restarting is waited for until ctx is done
+			fmt.Printf("GetBlockCount error:%s\n", countErr)
+			continue
+		}
+		blockCount = count
+	}
+	return nextHeight, nil
+}
+
+// fetchRange handles the blocks [startHeight, endHeight) and returns the next height to handle,
+// the error of fetching a block, and the error of handling a block
+func (this *BlockFollower) fetchRange(ctx context.Context, startHeight, endHeight uint32,
+	handle func(block *types.Block, blockCount uint32) error) (uint32, error, error) {
+	fetcher := NewBlockFetcher(this.source, this.routineNum, this.batchSize)
+	defer fetcher.Stop()
+	nextHeight := startHeight
+	for result := range fetcher.Start(startHeight, endHeight) {
+		if ctx.Err() != nil {
+			break
+		}
+		if result.Err != nil {
+			return nextHeight, result.Err, nil
+		}
+		err := handle(result.Block, endHeight)
+		if err != nil {
+			return nextHeight, nil, err
+		}
+		nextHeight = result.Height + 1
+	}
+	return nextHeight, nil, nil
+}
@@ -0,0 +1,165 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package utils
+
+import (
+	"github.com/ontio/ontology/core/types"
+)
+
+// PackPolicy decides how the imported txs are packed into blocks, 0 means no limit.
+// Without any limit every source block is packed into one block.
+type PackPolicy struct {
+	TxsPerBlock  int    // txs of a block
+	MaxBlockSize int    // serialized size of the txs of a block
+	MaxBlockGas  uint64 // sum of the gas limits of the txs of a block
+	MergeBlocks  int    // source blocks packed into a block
+}
+
+// KeepsSourceBlocks returns true if every source block is packed into one block
+func (this *PackPolicy) KeepsSourceBlocks() bool {
+	return this.TxsPerBlock == 0 && this.MaxBlockSize == 0 && this.MaxBlockGas == 0 && this.MergeBlocks <= 1
+}
+
+// PackItem is a tx waiting in the block packer
+type PackItem struct {
+	Tx           *ExportTx
+	SourceHeight uint32
+	SourceTime   uint32
+	Progress     ImportProgress // progress of the import before the tx
+	size         int
+}
+
+// PackedBlock holds the txs of a block to build
+type PackedBlock struct {
+	Items []*PackItem
+	Size  int    // serialized size of the txs
+	Gas   uint64 // sum of the gas limits of the txs
+}
+
+func (this *PackedBlock) Txs() []*types.Transaction {
+	txs := make([]*types.Transaction, 0, len(this.Items))
+	for _, item := range this.Items {
+		txs = append(txs, item.Tx.Tx)
+	}
+	return txs
+}
+
+// Timestamp is the time of the last source block with txs in the block
+func (this *PackedBlock) Timestamp() uint32 {
+	return this.Items[len(this.Items)-1].SourceTime
+}
+
+// BlockPacker collects the txs of the source blocks and cuts them into blocks by a PackPolicy
+type BlockPacker struct {
+	policy  *PackPolicy
+	pending *PackedBlock
+	sources int // source blocks with txs in pending
+	source  uint32
+}
+
+func NewBlockPacker(policy *PackPolicy) *BlockPacker {
+	return &BlockPacker{
+		policy:  policy,
+		pending: &PackedBlock{},
+	}
+}
+
+// Add adds a tx and returns the blocks that are full. A tx too large for an empty
+// block is packed into a block of its own.
+func (this *BlockPacker) Add(item *PackItem) []*PackedBlock {
+	var blocks []*PackedBlock
+	item.size = len(item.Tx.Tx.ToArray())
+	if len(this.pending.Items) != 0 &&
+		((this.policy.MaxBlockSize != 0 && this.pending.Size+item.size > this.policy.MaxBlockSize) ||
+			(this.policy.MaxBlockGas != 0 && this.pending.Gas+item.Tx.Tx.GasLimit > this.policy.MaxBlockGas)) {
+		blocks = append(blocks, this.Flush())
+	}
+	if len(this.pending.Items) == 0 || this.source != item.SourceHeight {
+		this.sources++
+		this.source = item.SourceHeight
+	}
+	this.pending.Items = append(this.pending.Items, item)
+	this.pending.Size += item.size
+	this.pending.Gas += item.Tx.Tx.GasLimit
+	if this.policy.TxsPerBlock != 0 && len(this.pending.Items) >= this.policy.TxsPerBlock {
+		blocks = append(blocks, this.Flush())
+	}
+	return blocks
+}
+
+// EndSourceBlock is called after the txs of a source block are added, it returns the
+// pending block if it holds enough source blocks
+func (this *BlockPacker) EndSourceBlock() *PackedBlock {
+	if len(this.pending.Items) == 0 || this.source != this.pending.Items[len(this.pending.Items)-1].SourceHeight {
+		return nil
+	}
+	if this.policy.KeepsSourceBlocks() || (this.policy.MergeBlocks > 0 && this.sources >= this.policy.MergeBlocks) {
+		return this.Flush()
+	}
+	return nil
+}
+
+// Pending returns the first tx waiting for a block, or nil
+func (this *BlockPacker) Pending() *PackItem {
+	if len(this.pending.Items) == 0 {
+		return nil
+	}
+	return this.pending.Items[0]
+}
+
+// Flush returns the pending txs as a block, or nil if there is none
+func (this *BlockPacker) Flush() *PackedBlock {
+	if len(this.pending.Items) == 0 {
+		return nil
+	}
+	block := this.pending
+	this.pending = &PackedBlock{}
+	this.sources = 0
+	return block
+}
+
+// PackStats summarizes the blocks built by an import
+type PackStats struct {
+	Blocks uint64
+	Txs    *Distribution // txs per block
+	Size   *Distribution // serialized size of the txs per block
+	Gas    *Distribution // gas limit per block
+}
+
+func NewPackStats() *PackStats {
+	return &PackStats{
+		Txs:  newDistribution(),
+		Size: newDistribution(),
+		Gas:  newDistribution(),
+	}
+}
+
+func (this *PackStats) Add(block *PackedBlock) {
+	this.Blocks++
+	this.Txs.add(uint64(len(block.Items)))
+	this.Size.add(uint64(block.Size))
+	this.Gas.add(block.Gas)
+}
+
+// Finish computes the distributions, call it after the last block
+func (this *PackStats) Finish() {
+	this.Txs.finish()
+	this.Size.finish()
+	this.Gas.finish()
+}
@@ -0,0 +1,119 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+// packTestBlocks packs the txs of the blocks and returns the source heights of the txs of each packed block
+func packTestBlocks(t *testing.T, policy *PackPolicy, blocks []*testBlock) [][]uint32 {
+	packer := NewBlockPacker(policy)
+	var packed [][]uint32
+	check := func(block *PackedBlock) {
+		heights := make([]uint32, 0, len(block.Items))
+		size := 0
+		gas := uint64(0)
+		for _, item := range block.Items {
+			heights = append(heights, item.SourceHeight)
+			size += len(item.Tx.Tx.ToArray())
+			gas += item.Tx.Tx.GasLimit
+		}
+		if block.Size != size || block.Gas != gas {
+			t.Errorf("block of heights %v has size %d gas %d, expected size %d gas %d", heights,
+				block.Size, block.Gas, size, gas)
+		}
+		if block.Timestamp() != testBlockTime(heights[len(heights)-1]) {
+			t.Errorf("block of heights %v has time %d", heights, block.Timestamp())
+		}
+		if len(block.Txs()) != len(block.Items) {
+			t.Errorf("block of heights %v has %d txs", heights, len(block.Txs()))
+		}
+		packed = append(packed, heights)
+	}
+	for _, block := range blocks {
+		for i, tx := range block.txs {
+			item := &PackItem{
+				Tx:           NewExportTx(uint64(i), tx),
+				SourceHeight: block.height,
+				SourceTime:   testBlockTime(block.height),
+			}
+			for _, full := range packer.Add(item) {
+				check(full)
+			}
+		}
+		if full := packer.EndSourceBlock(); full != nil {
+			check(full)
+		}
+	}
+	if last := packer.Flush(); last != nil {
+		check(last)
+	}
+	return packed
+}
+
+func TestBlockPacker(t *testing.T) {
+	blocks := newTestBlocks([]uint32{1, 2, 3, 4}, []int{3, 1, 0, 2})
+	txSize := len(blocks[0].txs[0].ToArray())
+	txGas := blocks[0].txs[0].GasLimit
+	tests := []struct {
+		name   string
+		policy PackPolicy
+		packed [][]uint32
+	}{
+		{"source blocks", PackPolicy{}, [][]uint32{{1, 1, 1}, {2}, {4, 4}}},
+		{"merge 1 block", PackPolicy{MergeBlocks: 1}, [][]uint32{{1, 1, 1}, {2}, {4, 4}}},
+		{"merge 2 blocks", PackPolicy{MergeBlocks: 2}, [][]uint32{{1, 1, 1, 2}, {4, 4}}},
+		{"merge 3 blocks", PackPolicy{MergeBlocks: 3}, [][]uint32{{1, 1, 1, 2, 4, 4}}},
+		{"txs", PackPolicy{TxsPerBlock: 2}, [][]uint32{{1, 1}, {1, 2}, {4, 4}}},
+		{"size", PackPolicy{MaxBlockSize: 2 * txSize}, [][]uint32{{1, 1}, {1, 2}, {4, 4}}},
+		{"size below a tx", PackPolicy{MaxBlockSize: txSize / 2}, [][]uint32{{1}, {1}, {1}, {2}, {4}, {4}}},
+		{"gas", PackPolicy{MaxBlockGas: 5 * txGas / 2}, [][]uint32{{1, 1}, {1, 2}, {4, 4}}},
+		{"txs and merge", PackPolicy{TxsPerBlock: 3, MergeBlocks: 2}, [][]uint32{{1, 1, 1}, {2, 4, 4}}},
+		{"size and txs", PackPolicy{TxsPerBlock: 3, MaxBlockSize: 2 * txSize}, [][]uint32{{1, 1}, {1, 2}, {4, 4}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			packed := packTestBlocks(t, &test.policy, blocks)
+			if !reflect.DeepEqual(packed, test.packed) {
+				t.Errorf("packed %v, expected %v", packed, test.packed)
+			}
+		})
+	}
+}
+
+func TestKeepsSourceBlocks(t *testing.T) {
+	tests := []struct {
+		policy PackPolicy
+		keeps  bool
+	}{
+		{PackPolicy{}, true},
+		{PackPolicy{MergeBlocks: 1}, true},
+		{PackPolicy{MergeBlocks: 2}, false},
+		{PackPolicy{TxsPerBlock: 1}, false},
+		{PackPolicy{MaxBlockSize: 1}, false},
+		{PackPolicy{MaxBlockGas: 1}, false},
+	}
+	for _, test := range tests {
+		if keeps := test.policy.KeepsSourceBlocks(); keeps != test.keeps {
+			t.Errorf("%+v: keeps source blocks %v, expected %v", test.policy, keeps, test.keeps)
+		}
+	}
+}
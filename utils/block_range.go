@@ -0,0 +1,95 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/ontio/ontology/common"
+	"github.com/ontio/ontology/core/types"
+)
+
+var timeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// ParseTimestamp parses unix seconds or a UTC date time like "2018-07-03 12:00:00"
+func ParseTimestamp(value string) (uint32, error) {
+	if seconds, err := strconv.ParseUint(value, 10, 32); err == nil {
+		return uint32(seconds), nil
+	}
+	for _, layout := range timeLayouts {
+		t, err := time.ParseInLocation(layout, value, time.UTC)
+		if err == nil {
+			if t.Unix() < 0 || t.Unix() > int64(^uint32(0)) {
+				return 0, fmt.Errorf("time %s out of range", value)
+			}
+			return uint32(t.Unix()), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid time %s, use unix seconds or a layout like %s", value, timeLayouts[1])
+}
+
+// GetBlockHeightByHash returns the height of the block with the given hex hash
+func GetBlockHeightByHash(source BlockSource, hash string) (uint32, error) {
+	blockHash, err := common.Uint256FromHexString(hash)
+	if err != nil {
+		return 0, fmt.Errorf("invalid block hash:%s error:%s", hash, err)
+	}
+	block, err := source.GetBlockByHash(blockHash)
+	if err != nil {
+		return 0, err
+	}
+	return block.Header.Height, nil
+}
+
+// getHeader gets only the header from a HeaderSource, and the whole block from other sources
+func getHeader(source BlockSource, height uint32) (*types.Header, error) {
+	if headerSource, ok := source.(HeaderSource); ok {
+		return headerSource.GetHeader(height)
+	}
+	block, err := source.GetBlock(height)
+	if err != nil {
+		return nil, err
+	}
+	return block.Header, nil
+}
+
+// FindHeightByTime binary searches the first block in [low, high) with timestamp >= timestamp.
+// It returns high if every block in the range is older than timestamp.
+func FindHeightByTime(source BlockSource, timestamp uint32, low, high uint32) (uint32, error) {
+	for low < high {
+		mid := low + (high-low)/2
+		header, err := getHeader(source, mid)
+		if err != nil {
+			return 0, err
+		}
+		if header.Timestamp < timestamp {
+			low = mid + 1
+		} else {
+			high = mid
+		}
+	}
+	return low, nil
+}
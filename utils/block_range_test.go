@@ -0,0 +1,134 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package utils
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/ontio/ontology/core/types"
+)
+
+func TestParseTimestamp(t *testing.T) {
+	tests := []struct {
+		value     string
+		timestamp uint32
+		ok        bool
+	}{
+		{"1530619200", 1530619200, true},
+		{"0", 0, true},
+		{"2018-07-03T12:00:00Z", 1530619200, true},
+		{"2018-07-03T14:00:00+02:00", 1530619200, true},
+		{"2018-07-03T12:00:00", 1530619200, true},
+		{"2018-07-03 12:00:00", 1530619200, true},
+		{"2018-07-03", 1530576000, true},
+		{"1969-12-31", 0, false},
+		{"2106-02-08", 0, false},
+		{"-1", 0, false},
+		{"2018-07-03 12:00", 0, false},
+		{"07/03/2018", 0, false},
+		{"", 0, false},
+	}
+	for _, test := range tests {
+		timestamp, err := ParseTimestamp(test.value)
+		if (err == nil) != test.ok {
+			t.Errorf("%q: error %v, expected ok %v", test.value, err, test.ok)
+		} else if timestamp != test.timestamp {
+			t.Errorf("%q: timestamp %d, expected %d", test.value, timestamp, test.timestamp)
+		}
+	}
+}
+
+// testHeaderChain is a testChain answering header requests
+type testHeaderChain struct {
+	*testChain
+	headers int // GetHeader requests
+}
+
+func (this *testHeaderChain) GetHeader(height uint32) (*types.Header, error) {
+	this.headers++
+	if height >= uint32(len(this.blocks)) || this.failAt[height] {
+		return nil, fmt.Errorf("unknown block %d", height)
+	}
+	return this.blocks[height].Header, nil
+}
+
+func TestFindHeightByTime(t *testing.T) {
+	chain := newTestChain(20)
+	headerChain := &testHeaderChain{testChain: newTestChain(20)}
+	tests := []struct {
+		name      string
+		timestamp uint32
+		low, high uint32
+		height    uint32
+	}{
+		{"block time", testBlockTime(7), 0, 20, 7},
+		{"between blocks", testBlockTime(7) + 1, 0, 20, 8},
+		{"before the range", testBlockTime(0), 5, 15, 5},
+		{"after the range", testBlockTime(19), 5, 15, 15},
+		{"after the chain", testBlockTime(19) + 1, 0, 20, 20},
+		{"first block", testBlockTime(0), 0, 20, 0},
+		{"empty range", testBlockTime(3), 4, 4, 4},
+	}
+	sources := map[string]BlockSource{"blocks": chain, "headers": headerChain}
+	for sourceName, source := range sources {
+		for _, test := range tests {
+			t.Run(sourceName+"/"+test.name, func(t *testing.T) {
+				height, err := FindHeightByTime(source, test.timestamp, test.low, test.high)
+				if err != nil {
+					t.Fatalf("FindHeightByTime error:%s", err)
+				}
+				if height != test.height {
+					t.Errorf("height %d, expected %d", height, test.height)
+				}
+			})
+		}
+	}
+	// a source of headers is searched without getting any block
+	if headerChain.gets != 0 || headerChain.headers == 0 {
+		t.Errorf("%d block requests %d header requests, expected headers only", headerChain.gets, headerChain.headers)
+	}
+
+	chain.failAt[10] = true
+	headerChain.failAt[10] = true
+	for sourceName, source := range sources {
+		_, err := FindHeightByTime(source, testBlockTime(12), 0, 20)
+		if err == nil {
+			t.Errorf("%s: no error for a failed block request", sourceName)
+		}
+	}
+}
+
+func TestGetBlockHeightByHash(t *testing.T) {
+	chain := newTestChain(10)
+	hash := chain.blocks[6].Hash()
+	height, err := GetBlockHeightByHash(chain, hash.ToHexString())
+	if err != nil {
+		t.Fatalf("GetBlockHeightByHash error:%s", err)
+	}
+	if height != 6 {
+		t.Errorf("height %d, expected 6", height)
+	}
+	for _, value := range []string{"xyz", "00", hash.ToHexString()[2:] + "00"} {
+		_, err = GetBlockHeightByHash(chain, value)
+		if err == nil {
+			t.Errorf("%s: no error", value)
+		}
+	}
+}
@@ -0,0 +1,344 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/ontio/ontology/common"
+	"github.com/ontio/ontology/common/serialization"
+	scom "github.com/ontio/ontology/core/store/common"
+	"github.com/ontio/ontology/core/store/ledgerstore"
+	"github.com/ontio/ontology/core/types"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+)
+
+// BlockSource provides the blocks of a chain to export
+type BlockSource interface {
+	// Name describes where the blocks come from
+	Name() string
+	GetNetworkId() (uint32, error)
+	GetBlockCount() (uint32, error)
+	GetBlock(height uint32) (*types.Block, error)
+	GetBlockByHash(hash common.Uint256) (*types.Block, error)
+	Close() error
+}
+
+// BatchBlockSource is a BlockSource that can get several blocks in one request
+type BatchBlockSource interface {
+	BlockSource
+	// GetBlocks returns the blocks at the heights in the same order
+	GetBlocks(heights []uint32) ([]*types.Block, error)
+}
+
+// HeaderSource is a BlockSource that can get the header of a block without its txs
+type HeaderSource interface {
+	BlockSource
+	GetHeader(height uint32) (*types.Header, error)
+}
+
+// BlockSubscriber is a BlockSource that pushes the new blocks of the chain
+type BlockSubscriber interface {
+	BlockSource
+	SubscribeBlocks() (<-chan *types.Block, error)
+}
+
+// NewBlockSource connects to a node by the scheme of addr: http or https for JSON-RPC like
+// http://127.0.0.1:20336, rest or rests for RESTful like rest://127.0.0.1:20334, and ws or
+// wss for WebSocket like ws://127.0.0.1:20335
+func NewBlockSource(ctx context.Context, addr string, config *RpcConfig) (BlockSource, error) {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid node address:%s error:%s", addr, err)
+	}
+	switch u.Scheme {
+	case "http", "https":
+		return NewRpcBlockSource(ctx, NewRpcClient(addr, config)), nil
+	case "rest", "rests":
+		u.Scheme = strings.Replace(u.Scheme, "rest", "http", 1)
+		return NewRestBlockSource(ctx, NewRestClient(u.String(), config)), nil
+	case "ws", "wss":
+		return NewWsBlockSource(ctx, NewWsClient(addr, config)), nil
+	}
+	return nil, fmt.Errorf("unsupported scheme of node address:%s, use http, https, rest, rests, ws or wss", addr)
+}
+
+// IsRpcAddr returns true if addr is a JSON-RPC address for NewBlockSource
+func IsRpcAddr(addr string) bool {
+	return strings.HasPrefix(addr, "http://") || strings.HasPrefix(addr, "https://")
+}
+
+// RpcBlockSource gets blocks from the rpc server of a node. Its requests are canceled
+// when the context it is created with is done.
+type RpcBlockSource struct {
+	ctx    context.Context
+	client *RpcClient
+}
+
+func NewRpcBlockSource(ctx context.Context, client *RpcClient) *RpcBlockSource {
+	return &RpcBlockSource{
+		ctx:    ctx,
+		client: client,
+	}
+}
+
+func (this *RpcBlockSource) Name() string {
+	return this.client.Addr()
+}
+
+func (this *RpcBlockSource) GetNetworkId() (uint32, error) {
+	return this.client.GetNetworkId(this.ctx)
+}
+
+func (this *RpcBlockSource) GetBlockCount() (uint32, error) {
+	return this.client.GetBlockCount(this.ctx)
+}
+
+func (this *RpcBlockSource) GetBlock(height uint32) (*types.Block, error) {
+	blockData, err := this.client.GetBlockData(this.ctx, height)
+	if err != nil {
+		return nil, fmt.Errorf("Get block:%d error:%s", height, err)
+	}
+	block, err := deserializeBlock(blockData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read block at height %d err %v", height, err)
+	}
+	return block, nil
+}
+
+// GetHeader still downloads the block, the txs are not deserialized
+func (this *RpcBlockSource) GetHeader(height uint32) (*types.Header, error) {
+	header, err := this.client.GetHeader(this.ctx, height)
+	if err != nil {
+		return nil, fmt.Errorf("Get header:%d error:%s", height, err)
+	}
+	return header, nil
+}
+
+func (this *RpcBlockSource) GetBlocks(heights []uint32) ([]*types.Block, error) {
+	blocksData, err := this.client.GetBlocksData(this.ctx, heights)
+	if err != nil {
+		return nil, err
+	}
+	return deserializeBlocks(heights, blocksData)
+}
+
+func (this *RpcBlockSource) GetBlockByHash(hash common.Uint256) (*types.Block, error) {
+	blockData, err := this.client.GetBlockData(this.ctx, hash.ToHexString())
+	if err != nil {
+		return nil, fmt.Errorf("Get block:%s error:%s", hash.ToHexString(), err)
+	}
+	block, err := deserializeBlock(blockData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read block %s err %v", hash.ToHexString(), err)
+	}
+	return block, nil
+}
+
+func (this *RpcBlockSource) Close() error {
+	return nil
+}
+
+// LedgerBlockSource reads blocks from the block store of a ledger directory. The store is
+// opened read-only, so no node has to run on it and a snapshot or a read-only mount is not changed.
+type LedgerBlockSource struct {
+	dir       string
+	networkId uint32
+	db        *leveldb.DB
+}
+
+// NewLedgerBlockSource opens the block store in a ledger directory like ./Chain/ontology
+func NewLedgerBlockSource(dir string, networkId uint32) (*LedgerBlockSource, error) {
+	blockDir := fmt.Sprintf("%s%s%s", dir, string(os.PathSeparator), ledgerstore.DBDirBlock)
+	if !common.FileExisted(blockDir) {
+		return nil, fmt.Errorf("cannot find block store:%s", blockDir)
+	}
+	db, err := leveldb.OpenFile(blockDir, &opt.Options{ReadOnly: true, ErrorIfMissing: true})
+	if err != nil {
+		return nil, fmt.Errorf("leveldb.OpenFile:%s error:%s", blockDir, err)
+	}
+	return &LedgerBlockSource{
+		dir:       dir,
+		networkId: networkId,
+		db:        db,
+	}, nil
+}
+
+func (this *LedgerBlockSource) Name() string {
+	return "ledger:" + this.dir
+}
+
+func (this *LedgerBlockSource) GetNetworkId() (uint32, error) {
+	return this.networkId, nil
+}
+
+// GetBlockCount reads the current block, stored as its hash and height
+func (this *LedgerBlockSource) GetBlockCount() (uint32, error) {
+	data, err := this.db.Get([]byte{byte(scom.SYS_CURRENT_BLOCK)}, nil)
+	if err != nil {
+		return 0, fmt.Errorf("Get current block error:%s", err)
+	}
+	reader := bytes.NewReader(data)
+	blockHash := common.Uint256{}
+	err = blockHash.Deserialize(reader)
+	if err != nil {
+		return 0, fmt.Errorf("read current block hash error:%s", err)
+	}
+	height, err := serialization.ReadUint32(reader)
+	if err != nil {
+		return 0, fmt.Errorf("read current block height error:%s", err)
+	}
+	return height + 1, nil
+}
+
+func (this *LedgerBlockSource) GetBlock(height uint32) (*types.Block, error) {
+	hash, err := this.blockHash(height)
+	if err != nil {
+		return nil, err
+	}
+	block, err := this.readBlock(hash)
+	if err != nil {
+		return nil, fmt.Errorf("Get block:%d error:%s", height, err)
+	}
+	return block, nil
+}
+
+// GetHeader reads the header of a block, its txs are not read
+func (this *LedgerBlockSource) GetHeader(height uint32) (*types.Header, error) {
+	hash, err := this.blockHash(height)
+	if err != nil {
+		return nil, err
+	}
+	data, err := this.db.Get(append([]byte{byte(scom.DATA_HEADER)}, hash.ToArray()...), nil)
+	if err != nil {
+		return nil, fmt.Errorf("Get header:%d error:%s", height, err)
+	}
+	header, _, err := parseStoredBlock(data)
+	if err != nil {
+		return nil, fmt.Errorf("Get header:%d error:%s", height, err)
+	}
+	return header, nil
+}
+
+// blockHash reads the hash of the block at height
+func (this *LedgerBlockSource) blockHash(height uint32) (common.Uint256, error) {
+	key := make([]byte, 5)
+	key[0] = byte(scom.DATA_BLOCK)
+	binary.LittleEndian.PutUint32(key[1:], height)
+	data, err := this.db.Get(key, nil)
+	if err != nil {
+		return common.Uint256{}, fmt.Errorf("Get block hash:%d error:%s", height, err)
+	}
+	hash, err := common.Uint256ParseFromBytes(data)
+	if err != nil {
+		return common.Uint256{}, fmt.Errorf("Get block hash:%d error:%s", height, err)
+	}
+	return hash, nil
+}
+
+func (this *LedgerBlockSource) GetBlockByHash(hash common.Uint256) (*types.Block, error) {
+	block, err := this.readBlock(hash)
+	if err != nil {
+		return nil, fmt.Errorf("Get block:%s error:%s", hash.ToHexString(), err)
+	}
+	return block, nil
+}
+
+// readBlock reads a block as the block store of ontology saves it: the system fee, the header
+// and the tx hashes under the block hash, and each tx with its block height under the tx hash
+func (this *LedgerBlockSource) readBlock(hash common.Uint256) (*types.Block, error) {
+	data, err := this.db.Get(append([]byte{byte(scom.DATA_HEADER)}, hash.ToArray()...), nil)
+	if err != nil {
+		return nil, fmt.Errorf("get header error:%s", err)
+	}
+	header, txHashes, err := parseStoredBlock(data)
+	if err != nil {
+		return nil, err
+	}
+	txs := make([]*types.Transaction, 0, len(txHashes))
+	for _, txHash := range txHashes {
+		txData, err := this.db.Get(append([]byte{byte(scom.DATA_TRANSACTION)}, txHash.ToArray()...), nil)
+		if err != nil {
+			return nil, fmt.Errorf("get tx:%s error:%s", txHash.ToHexString(), err)
+		}
+		tx, err := parseStoredTx(txData)
+		if err != nil {
+			return nil, fmt.Errorf("read tx:%s error:%s", txHash.ToHexString(), err)
+		}
+		txs = append(txs, tx)
+	}
+	return &types.Block{Header: header, Transactions: txs}, nil
+}
+
+// parseStoredBlock parses the system fee, the header and the tx hashes stored under a block hash
+func parseStoredBlock(data []byte) (*types.Header, []common.Uint256, error) {
+	reader := bytes.NewReader(data)
+	sysFee := new(common.Fixed64)
+	err := sysFee.Deserialize(reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("read sys fee error:%s", err)
+	}
+	header := new(types.Header)
+	err = header.Deserialize(reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("read header error:%s", err)
+	}
+	txNum, err := serialization.ReadUint32(reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("read tx num error:%s", err)
+	}
+	// a corrupted tx num must not allocate more hashes than the data holds
+	if uint64(txNum)*common.UINT256_SIZE > uint64(reader.Len()) {
+		return nil, nil, fmt.Errorf("tx num %d of block %d is over the %d bytes left", txNum, header.Height, reader.Len())
+	}
+	txHashes := make([]common.Uint256, txNum)
+	for i := range txHashes {
+		err = txHashes[i].Deserialize(reader)
+		if err != nil {
+			return nil, nil, fmt.Errorf("read tx hash error:%s", err)
+		}
+	}
+	return header, txHashes, nil
+}
+
+// parseStoredTx parses the block height and the tx stored under a tx hash
+func parseStoredTx(data []byte) (*types.Transaction, error) {
+	reader := bytes.NewReader(data)
+	_, err := serialization.ReadUint32(reader)
+	if err != nil {
+		return nil, fmt.Errorf("read height error:%s", err)
+	}
+	tx := new(types.Transaction)
+	err = tx.Deserialize(reader)
+	if err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+func (this *LedgerBlockSource) Close() error {
+	return this.db.Close()
+}
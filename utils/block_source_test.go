@@ -0,0 +1,110 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package utils
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ontio/ontology/common"
+	"github.com/ontio/ontology/common/serialization"
+	"github.com/ontio/ontology/core/types"
+)
+
+// storedTestBlock serializes a block as the block store saves it under the block hash,
+// with txNum in place of the count of the tx hashes
+func storedTestBlock(t *testing.T, header *types.Header, txHashes []common.Uint256, txNum uint32) []byte {
+	buf := bytes.NewBuffer(nil)
+	serialization.WriteUint64(buf, 100) // system fee
+	err := header.Serialize(buf)
+	if err != nil {
+		t.Fatalf("serialize header error:%s", err)
+	}
+	serialization.WriteUint32(buf, txNum)
+	for _, txHash := range txHashes {
+		buf.Write(txHash.ToArray())
+	}
+	return buf.Bytes()
+}
+
+func TestParseStoredBlock(t *testing.T) {
+	header := newTestChain(8).blocks[7].Header
+	txs := []*types.Transaction{newTestTx(1), newTestTx(2), newTestTx(3)}
+	txHashes := make([]common.Uint256, 0, len(txs))
+	for _, tx := range txs {
+		txHashes = append(txHashes, tx.Hash())
+	}
+	full := storedTestBlock(t, header, txHashes, 3)
+	tests := []struct {
+		name     string
+		data     []byte
+		txHashes []common.Uint256 // nil if the data is invalid
+	}{
+		{"block", full, txHashes},
+		{"no tx", storedTestBlock(t, header, nil, 0), []common.Uint256{}},
+		{"torn tx hash", full[:len(full)-1], nil},
+		{"missing tx hash", storedTestBlock(t, header, txHashes[:2], 3), nil},
+		{"corrupted tx num", storedTestBlock(t, header, txHashes, 0xffffffff), nil},
+		{"torn header", full[:20], nil},
+		{"empty", nil, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			parsed, hashes, err := parseStoredBlock(test.data)
+			if test.txHashes == nil {
+				if err == nil {
+					t.Fatalf("no error for invalid data")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseStoredBlock error:%s", err)
+			}
+			if parsed.Hash() != header.Hash() {
+				t.Errorf("header of block %d, expected block %d", parsed.Height, header.Height)
+			}
+			if len(hashes) != len(test.txHashes) {
+				t.Fatalf("%d tx hashes, expected %d", len(hashes), len(test.txHashes))
+			}
+			for i := range hashes {
+				if hashes[i] != test.txHashes[i] {
+					t.Errorf("tx hash %d is %x, expected %x", i, hashes[i], test.txHashes[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseStoredTx(t *testing.T) {
+	tx := newTestTx(5)
+	buf := bytes.NewBuffer(nil)
+	serialization.WriteUint32(buf, 7) // block height
+	err := tx.Serialize(buf)
+	if err != nil {
+		t.Fatalf("serialize tx error:%s", err)
+	}
+	parsed, err := parseStoredTx(buf.Bytes())
+	if err != nil || parsed.Hash() != tx.Hash() {
+		t.Fatalf("parseStoredTx returned %v error %v", parsed, err)
+	}
+	_, err = parseStoredTx(buf.Bytes()[:10])
+	if err == nil {
+		t.Errorf("no error for a torn tx")
+	}
+}
@@ -0,0 +1,131 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	COMPRESS_NONE = "none"
+	COMPRESS_GZIP = "gzip"
+	COMPRESS_ZSTD = "zstd"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+func CheckCompression(compression string) error {
+	switch compression {
+	case COMPRESS_NONE, COMPRESS_GZIP, COMPRESS_ZSTD:
+		return nil
+	}
+	return fmt.Errorf("unknown compression %s, should be %s, %s or %s", compression, COMPRESS_NONE, COMPRESS_GZIP, COMPRESS_ZSTD)
+}
+
+// CompressionByFileName chooses the compression by the file extension
+func CompressionByFileName(fileName string) string {
+	switch {
+	case strings.HasSuffix(fileName, ".gz"):
+		return COMPRESS_GZIP
+	case strings.HasSuffix(fileName, ".zst"), strings.HasSuffix(fileName, ".zstd"):
+		return COMPRESS_ZSTD
+	}
+	return COMPRESS_NONE
+}
+
+// DetectCompression detects the compression by the magic at the start of a stream
+func DetectCompression(magic []byte) string {
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		return COMPRESS_GZIP
+	case bytes.HasPrefix(magic, zstdMagic):
+		return COMPRESS_ZSTD
+	}
+	return COMPRESS_NONE
+}
+
+// FileCompression detects the compression of a file by its magic
+func FileCompression(file *os.File) (string, error) {
+	magic := make([]byte, len(zstdMagic))
+	n, err := file.ReadAt(magic, 0)
+	if err != nil && err != io.EOF {
+		return "", fmt.Errorf("read file magic error:%s", err)
+	}
+	return DetectCompression(magic[:n]), nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (this nopWriteCloser) Close() error {
+	return nil
+}
+
+// NewCompressWriter compresses the data written to w. Closing it ends the
+// compressed stream but does not close w.
+func NewCompressWriter(w io.Writer, compression string) (io.WriteCloser, error) {
+	switch compression {
+	case COMPRESS_NONE:
+		return nopWriteCloser{w}, nil
+	case COMPRESS_GZIP:
+		return gzip.NewWriter(w), nil
+	case COMPRESS_ZSTD:
+		encoder, err := zstd.NewWriter(w)
+		if err != nil {
+			return nil, fmt.Errorf("zstd.NewWriter error:%s", err)
+		}
+		return encoder, nil
+	}
+	return nil, CheckCompression(compression)
+}
+
+// NewDecompressReader detects the compression of r by its magic and decompresses it while reading
+func NewDecompressReader(r io.Reader) (io.ReadCloser, string, error) {
+	reader := bufio.NewReader(r)
+	magic, _ := reader.Peek(len(zstdMagic))
+	compression := DetectCompression(magic)
+	switch compression {
+	case COMPRESS_GZIP:
+		gzReader, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, "", fmt.Errorf("gzip.NewReader error:%s", err)
+		}
+		return gzReader, compression, nil
+	case COMPRESS_ZSTD:
+		decoder, err := zstd.NewReader(reader)
+		if err != nil {
+			return nil, "", fmt.Errorf("zstd.NewReader error:%s", err)
+		}
+		return decoder.IOReadCloser(), compression, nil
+	}
+	return ioutil.NopCloser(reader), compression, nil
+}
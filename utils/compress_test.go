@@ -0,0 +1,89 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package utils
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestCompressionByFileName(t *testing.T) {
+	tests := []struct {
+		fileName    string
+		compression string
+	}{
+		{"txs.dat", COMPRESS_NONE},
+		{"txs.dat.gz", COMPRESS_GZIP},
+		{"txs.dat.zst", COMPRESS_ZSTD},
+		{"txs.dat.zstd", COMPRESS_ZSTD},
+		{"txs.gz.dat", COMPRESS_NONE},
+	}
+	for _, test := range tests {
+		if compression := CompressionByFileName(test.fileName); compression != test.compression {
+			t.Errorf("%s: compression %s, expected %s", test.fileName, compression, test.compression)
+		}
+	}
+}
+
+func TestCompressRoundTrip(t *testing.T) {
+	data := bytes.Repeat([]byte("Block 1 num 0 time 0\n"), 1000)
+	for _, compression := range []string{COMPRESS_NONE, COMPRESS_GZIP, COMPRESS_ZSTD} {
+		t.Run(compression, func(t *testing.T) {
+			buf := bytes.NewBuffer(nil)
+			writer, err := NewCompressWriter(buf, compression)
+			if err != nil {
+				t.Fatalf("NewCompressWriter error:%s", err)
+			}
+			_, err = writer.Write(data)
+			if err == nil {
+				err = writer.Close()
+			}
+			if err != nil {
+				t.Fatalf("compress error:%s", err)
+			}
+			if detected := DetectCompression(buf.Bytes()); detected != compression {
+				t.Fatalf("detected compression %s, expected %s", detected, compression)
+			}
+
+			reader, detected, err := NewDecompressReader(bytes.NewReader(buf.Bytes()))
+			if err != nil {
+				t.Fatalf("NewDecompressReader error:%s", err)
+			}
+			defer reader.Close()
+			if detected != compression {
+				t.Fatalf("decompress reader compression %s, expected %s", detected, compression)
+			}
+			result, err := ioutil.ReadAll(reader)
+			if err != nil {
+				t.Fatalf("decompress error:%s", err)
+			}
+			if !bytes.Equal(result, data) {
+				t.Fatalf("decompressed %d bytes differ from the %d bytes written", len(result), len(data))
+			}
+		})
+	}
+}
+
+func TestNewCompressWriterUnknown(t *testing.T) {
+	_, err := NewCompressWriter(bytes.NewBuffer(nil), "lz4")
+	if err == nil {
+		t.Fatalf("no error for an unknown compression")
+	}
+}
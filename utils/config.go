@@ -36,7 +36,7 @@ func (this *TxReplayConfig) readFile(fileName string) ([]byte, error) {
 	defer func() {
 		err := file.Close()
 		if err != nil {
-			fmt.Errorf("File %s close error %s", fileName, err)
+			fmt.Printf("File %s close error %s\n", fileName, err)
 		}
 	}()
 	data, err := ioutil.ReadAll(file)
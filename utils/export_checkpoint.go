@@ -0,0 +1,212 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	EXPORT_CHECKPOINT_SUFFIX   = ".ckpt"
+	EXPORT_CHECKPOINT_INTERVAL = 1000 // blocks between two checkpoints
+	exportTailChunkSize        = 64 * 1024
+)
+
+var blockLinePrefix = []byte("Block ")
+
+// ExportCheckpoint is the sidecar file of an export in progress
+type ExportCheckpoint struct {
+	File        string `json:"File"`
+	StartHeight uint32 `json:"StartHeight"`
+	NextHeight  uint32 `json:"NextHeight"`
+	Offset      int64  `json:"Offset"`
+}
+
+// ExportTail is the last complete block record found in an export file
+type ExportTail struct {
+	NextHeight uint32 // height to continue the export from
+	Offset     int64  // end of the last complete record, the file is truncated here
+	Found      bool   // false if the file holds no block record
+	Version    uint32 // version of a binary archive, new records are written in it
+}
+
+func CheckpointFile(exportFile string) string {
+	return exportFile + EXPORT_CHECKPOINT_SUFFIX
+}
+
+// LoadExportCheckpoint returns nil if the export file has no checkpoint
+func LoadExportCheckpoint(exportFile string) (*ExportCheckpoint, error) {
+	ckpt := &ExportCheckpoint{}
+	found, err := readJSONFile(CheckpointFile(exportFile), ckpt)
+	if err != nil || !found {
+		return nil, err
+	}
+	return ckpt, nil
+}
+
+func (this *ExportCheckpoint) Save() error {
+	return writeJSONFileAtomic(CheckpointFile(this.File), this)
+}
+
+func RemoveExportCheckpoint(exportFile string) error {
+	err := os.Remove(CheckpointFile(exportFile))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// ParseBlockLine parses a "Block <height> num <txNum> time <timestamp>" record header. The
+// time is missing in the files exported before it was recorded, Timestamp is 0 then.
+func ParseBlockLine(line string) (*ExportBlock, error) {
+	fields := strings.Fields(line)
+	if (len(fields) != 4 && len(fields) != 6) || fields[0] != "Block" || fields[2] != "num" ||
+		(len(fields) == 6 && fields[4] != "time") {
+		return nil, fmt.Errorf("invalid block line %q", line)
+	}
+	height, err := strconv.ParseUint(fields[1], 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid height in block line %q", line)
+	}
+	txNum, err := strconv.ParseUint(fields[3], 10, 31)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tx num in block line %q", line)
+	}
+	block := &ExportBlock{
+		Height: uint32(height),
+		TxNum:  int(txNum),
+		Txs:    make([]*ExportTx, 0, txNum),
+	}
+	if len(fields) == 6 {
+		timestamp, err := strconv.ParseUint(fields[5], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time in block line %q", line)
+		}
+		block.Timestamp = uint32(timestamp)
+	}
+	return block, nil
+}
+
+// FindExportTail reads the tail of an export file and finds the last complete block record.
+// Tx lines are hex encoded, so a "Block " at the start of a line is always a record header.
+func FindExportTail(file *os.File) (*ExportTail, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("stat export file error:%s", err)
+	}
+	start, err := lastBlockLine(file, info.Size())
+	if err != nil {
+		return nil, err
+	}
+	if start < 0 {
+		return &ExportTail{}, nil
+	}
+
+	reader := bufio.NewReader(io.NewSectionReader(file, start, info.Size()-start))
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		// a torn header line, drop the whole record
+		return tailBefore(file, start)
+	}
+	block, err := ParseBlockLine(line)
+	if err != nil {
+		return nil, err
+	}
+	offset := start + int64(len(line))
+	for i := 0; i < block.TxNum; i++ {
+		line, err = reader.ReadString('\n')
+		if err != nil {
+			// the record is incomplete, export it again
+			return &ExportTail{NextHeight: block.Height, Offset: start, Found: true}, nil
+		}
+		offset += int64(len(line))
+	}
+	return &ExportTail{NextHeight: block.Height + 1, Offset: offset, Found: true}, nil
+}
+
+// tailBefore finds the record ahead of a torn header line at offset end
+func tailBefore(file *os.File, end int64) (*ExportTail, error) {
+	start, err := lastBlockLine(file, end)
+	if err != nil {
+		return nil, err
+	}
+	if start < 0 {
+		return &ExportTail{}, nil
+	}
+	reader := bufio.NewReader(io.NewSectionReader(file, start, end-start))
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("read block line at offset %d error:%s", start, err)
+	}
+	block, err := ParseBlockLine(line)
+	if err != nil {
+		return nil, err
+	}
+	return &ExportTail{NextHeight: block.Height + 1, Offset: end, Found: true}, nil
+}
+
+// lastBlockLine returns the offset of the last record header starting before end, or -1
+func lastBlockLine(file *os.File, end int64) (int64, error) {
+	buf := make([]byte, exportTailChunkSize+len(blockLinePrefix))
+	pos := end
+	for pos > 0 {
+		n := int64(exportTailChunkSize)
+		if pos < n {
+			n = pos
+		}
+		pos -= n
+		// read a bit more so that a prefix across two chunks is found
+		size := n + int64(len(blockLinePrefix))
+		if pos+size > end {
+			size = end - pos
+		}
+		chunk := buf[:size]
+		_, err := file.ReadAt(chunk, pos)
+		if err != nil && err != io.EOF {
+			return -1, fmt.Errorf("read export file at offset %d error:%s", pos, err)
+		}
+		for idx := len(chunk); idx > 0; {
+			idx = bytes.LastIndex(chunk[:idx], blockLinePrefix)
+			if idx < 0 {
+				break
+			}
+			if pos+int64(idx) == 0 || (idx > 0 && chunk[idx-1] == '\n') {
+				return pos + int64(idx), nil
+			}
+			if idx == 0 {
+				// the line start is in the previous chunk
+				prev := make([]byte, 1)
+				_, err = file.ReadAt(prev, pos-1)
+				if err != nil {
+					return -1, fmt.Errorf("read export file at offset %d error:%s", pos-1, err)
+				}
+				if prev[0] == '\n' {
+					return pos, nil
+				}
+			}
+		}
+	}
+	return -1, nil
+}
@@ -0,0 +1,129 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package utils
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+// testBlockLines is a text export record with txNum tx lines, the hash and the data are fake
+func testBlockLines(height uint32, txNum int) string {
+	lines := fmt.Sprintf("Block %d num %d time %d\n", height, txNum, 1530000000+height)
+	for i := 0; i < txNum; i++ {
+		lines += fmt.Sprintf("%064x %x\n", height*100+uint32(i), []byte("tx data"))
+	}
+	return lines
+}
+
+// testTxLine is a tx line of length bytes, newline included
+func testTxLine(length int) string {
+	return strings.Repeat("a", 64) + " " + strings.Repeat("0", length-66) + "\n"
+}
+
+func writeTestFile(t *testing.T, content string) *os.File {
+	file, err := ioutil.TempFile("", "txreplay-test")
+	if err != nil {
+		t.Fatalf("TempFile error:%s", err)
+	}
+	_, err = file.WriteString(content)
+	if err != nil {
+		t.Fatalf("write test file error:%s", err)
+	}
+	return file
+}
+
+func closeTestFile(file *os.File) {
+	file.Close()
+	os.Remove(file.Name())
+}
+
+func TestFindExportTail(t *testing.T) {
+	complete := testBlockLines(10, 2) + testBlockLines(11, 1)
+	// the record of block 12 is more than a tail chunk long
+	long := complete + "Block 12 num 1 time 0\n" + testTxLine(exportTailChunkSize+100)
+	tests := []struct {
+		name    string
+		content string
+		tail    ExportTail
+	}{
+		{"empty", "", ExportTail{}},
+		{"complete", complete, ExportTail{NextHeight: 12, Offset: int64(len(complete)), Found: true}},
+		{"empty block", complete + testBlockLines(12, 0),
+			ExportTail{NextHeight: 13, Offset: int64(len(complete + testBlockLines(12, 0))), Found: true}},
+		{"missing tx line", complete + "Block 12 num 2 time 0\n" + testTxLine(100),
+			ExportTail{NextHeight: 12, Offset: int64(len(complete)), Found: true}},
+		{"torn tx line", complete + testBlockLines(12, 1)[:40],
+			ExportTail{NextHeight: 12, Offset: int64(len(complete)), Found: true}},
+		{"torn block line", complete + "Block 12 nu",
+			ExportTail{NextHeight: 12, Offset: int64(len(complete)), Found: true}},
+		{"torn first block line", "Block 10 nu", ExportTail{}},
+		{"long record", long, ExportTail{NextHeight: 13, Offset: int64(len(long)), Found: true}},
+		{"torn long record", long[:len(long)-1],
+			ExportTail{NextHeight: 12, Offset: int64(len(complete)), Found: true}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			file := writeTestFile(t, test.content)
+			defer closeTestFile(file)
+			tail, err := FindExportTail(file)
+			if err != nil {
+				t.Fatalf("FindExportTail error:%s", err)
+			}
+			if *tail != test.tail {
+				t.Errorf("tail %+v, expected %+v", *tail, test.tail)
+			}
+		})
+	}
+}
+
+func TestLastBlockLine(t *testing.T) {
+	head := testBlockLines(1, 1)
+	line := "Block 2 num 1 time 0\n"
+	tests := []struct {
+		name    string
+		content string
+		offset  int64
+	}{
+		{"no block line", testTxLine(100), -1},
+		{"first line", line + testTxLine(100), 0},
+		{"last line", head + line, int64(len(head))},
+		// the prefix is split by the start of the last chunk
+		{"across chunks", head + line + testTxLine(exportTailChunkSize-len(line)+3), int64(len(head))},
+		// the line starts a chunk and the newline ends the previous one
+		{"chunk start", head + line + testTxLine(exportTailChunkSize-len(line)), int64(len(head))},
+		{"chunks before", head + line + testTxLine(3*exportTailChunkSize), int64(len(head))},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			file := writeTestFile(t, test.content)
+			defer closeTestFile(file)
+			offset, err := lastBlockLine(file, int64(len(test.content)))
+			if err != nil {
+				t.Fatalf("lastBlockLine error:%s", err)
+			}
+			if offset != test.offset {
+				t.Errorf("offset %d, expected %d", offset, test.offset)
+			}
+		})
+	}
+}
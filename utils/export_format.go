@@ -0,0 +1,389 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/ontio/ontology/common"
+	"github.com/ontio/ontology/core/types"
+)
+
+const (
+	EXPORT_FORMAT_TEXT   = "text"
+	EXPORT_FORMAT_BINARY = "binary"
+)
+
+// Kinds of the errors of decoding a tx entry
+const (
+	TX_ERR_PARSE       = "parse"       // the line cannot be split into hash and tx data
+	TX_ERR_HEX         = "hex"         // the tx data is not valid hex
+	TX_ERR_DESERIALIZE = "deserialize" // the tx data is not a valid tx
+)
+
+// ExportTx is a tx entry of an export file. Err is set if the entry cannot be decoded.
+type ExportTx struct {
+	Line    uint64 // line number in a text export, tx sequence number in a binary archive
+	Raw     string // raw line of a text export, the same line is built for a binary archive tx
+	Hash    string // hash recorded in a text export
+	Tx      *types.Transaction
+	Err     error
+	ErrKind string
+}
+
+// NewExportTx is the entry of a tx taken from a node, with the same line as a text export
+func NewExportTx(line uint64, tx *types.Transaction) *ExportTx {
+	hash := fmt.Sprintf("%x", tx.Hash())
+	return &ExportTx{
+		Line: line,
+		Raw:  fmt.Sprintf("%s %x\n", hash, tx.ToArray()),
+		Hash: hash,
+		Tx:   tx,
+	}
+}
+
+// ExportBlock is a block record of an export file
+type ExportBlock struct {
+	Height    uint32
+	Timestamp uint32 // timestamp of the source block, 0 if the file does not record it
+	TxNum     int    // tx count recorded in the block record
+	Txs       []*ExportTx
+}
+
+// ExportPosition is the position after a block record of an export file, where
+// NewExportReaderAt can continue reading the file
+type ExportPosition struct {
+	Offset  int64          // offset in the decompressed file
+	Line    uint64         // lines of a text export or txs of a binary archive before Offset
+	Trailer ArchiveTrailer // totals of the archive block records before Offset
+}
+
+// ExportReader reads the block records of an export file
+type ExportReader interface {
+	Format() string
+	Compression() string
+	// Header returns nil for a text export
+	Header() *ArchiveHeader
+	// ReadBlock returns io.EOF after the last block. After a *BlockLineError the next
+	// ReadBlock skips the tx lines of the malformed block line.
+	ReadBlock() (*ExportBlock, error)
+	// Position returns the position after the last block returned by ReadBlock
+	Position() *ExportPosition
+	// Close releases the decompressor, it does not close the underlying reader
+	Close() error
+}
+
+// BlockLineError is a malformed block line of a text export
+type BlockLineError struct {
+	Line uint64
+	Err  error
+}
+
+func (this *BlockLineError) Error() string {
+	return fmt.Sprintf("line %d: %s", this.Line, this.Err)
+}
+
+// ExportWriter writes the block records of an export file
+type ExportWriter interface {
+	WriteBlock(header *types.Header, txs []*types.Transaction) error
+	Flush() error
+	// Close flushes the file and ends it, it does not close the underlying writer
+	Close() error
+}
+
+func CheckExportFormat(format string) error {
+	switch format {
+	case EXPORT_FORMAT_TEXT, EXPORT_FORMAT_BINARY:
+		return nil
+	}
+	return fmt.Errorf("unknown export format %s, should be %s or %s", format, EXPORT_FORMAT_TEXT, EXPORT_FORMAT_BINARY)
+}
+
+// NewExportReader detects the compression and the format of an export file by their magic
+func NewExportReader(r io.Reader) (ExportReader, error) {
+	stream, compression, err := NewDecompressReader(r)
+	if err != nil {
+		return nil, err
+	}
+	source := &exportSource{
+		compression: compression,
+		stream:      stream,
+	}
+	reader := bufio.NewReader(stream)
+	magic, err := reader.Peek(len(TX_ARCHIVE_MAGIC))
+	if err == nil && string(magic) == TX_ARCHIVE_MAGIC {
+		archive, err := newArchiveReader(reader, source)
+		if err != nil {
+			stream.Close()
+			return nil, err
+		}
+		return archive, nil
+	}
+	if first, err := reader.Peek(1); err == nil && first[0] == '{' {
+		return &rejectFileReader{exportSource: source, reader: reader}, nil
+	}
+	return &textExportReader{exportSource: source, reader: reader}, nil
+}
+
+// NewExportReaderAt continues reading an export file at a position returned by
+// ExportReader.Position. An uncompressed file is read from the position directly, a
+// compressed one is read from the start and the blocks before the position are skipped.
+func NewExportReaderAt(file *os.File, pos *ExportPosition) (ExportReader, error) {
+	compression, err := FileCompression(file)
+	if err != nil {
+		return nil, err
+	}
+	if compression != COMPRESS_NONE || pos.Offset == 0 {
+		return skipExportReader(file, pos)
+	}
+	isArchive, err := IsArchiveFile(file)
+	if err != nil {
+		return nil, err
+	}
+	first := make([]byte, 1)
+	_, err = file.ReadAt(first, 0)
+	if err != nil {
+		return nil, fmt.Errorf("read export file error:%s", err)
+	}
+	_, err = file.Seek(pos.Offset, io.SeekStart)
+	if err != nil {
+		return nil, fmt.Errorf("seek export file to offset %d error:%s", pos.Offset, err)
+	}
+	source := &exportSource{
+		compression: COMPRESS_NONE,
+		stream:      ioutil.NopCloser(file),
+	}
+	reader := bufio.NewReader(file)
+	if first[0] == '{' {
+		return &rejectFileReader{exportSource: source, reader: reader, line: pos.Line, offset: pos.Offset}, nil
+	}
+	if !isArchive {
+		return &textExportReader{exportSource: source, reader: reader, line: pos.Line, offset: pos.Offset}, nil
+	}
+	header, err := ReadArchiveHeader(io.NewSectionReader(file, 0, pos.Offset))
+	if err != nil {
+		return nil, err
+	}
+	trailer := pos.Trailer
+	return &archiveReader{
+		exportSource: source,
+		reader:       &countingReader{reader: reader, count: pos.Offset},
+		header:       header,
+		trailer:      &trailer,
+		txIndex:      pos.Line,
+	}, nil
+}
+
+func skipExportReader(file *os.File, pos *ExportPosition) (ExportReader, error) {
+	_, err := file.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, fmt.Errorf("seek export file error:%s", err)
+	}
+	reader, err := NewExportReader(file)
+	if err != nil {
+		return nil, err
+	}
+	for reader.Position().Offset < pos.Offset {
+		_, err = reader.ReadBlock()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			reader.Close()
+			return nil, err
+		}
+	}
+	if reader.Position().Offset != pos.Offset {
+		reader.Close()
+		return nil, fmt.Errorf("offset %d is not the end of a block record", pos.Offset)
+	}
+	return reader, nil
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	reader io.Reader
+	count  int64
+}
+
+func (this *countingReader) Read(p []byte) (int, error) {
+	n, err := this.reader.Read(p)
+	this.count += int64(n)
+	return n, err
+}
+
+// exportSource is the decompressed stream shared by the export readers
+type exportSource struct {
+	compression string
+	stream      io.ReadCloser
+}
+
+func (this *exportSource) Compression() string {
+	return this.compression
+}
+
+func (this *exportSource) Close() error {
+	return this.stream.Close()
+}
+
+type textExportWriter struct {
+	writer *bufio.Writer
+}
+
+func NewTextExportWriter(w io.Writer) ExportWriter {
+	return &textExportWriter{writer: bufio.NewWriter(w)}
+}
+
+func (this *textExportWriter) WriteBlock(header *types.Header, txs []*types.Transaction) error {
+	_, err := this.writer.WriteString(fmt.Sprintf("Block %d num %d time %d\n", header.Height, len(txs), header.Timestamp))
+	if err != nil {
+		return fmt.Errorf("failed to write block line at block height %d", header.Height)
+	}
+	for _, tx := range txs {
+		txHex := hex.EncodeToString(tx.ToArray())
+		_, err = this.writer.WriteString(fmt.Sprintf("%x %s\n", tx.Hash(), txHex))
+		if err != nil {
+			return fmt.Errorf("failed to write tx data %x at block height %d", tx.Hash(), header.Height)
+		}
+	}
+	return nil
+}
+
+func (this *textExportWriter) Flush() error {
+	return this.writer.Flush()
+}
+
+func (this *textExportWriter) Close() error {
+	return this.writer.Flush()
+}
+
+type textExportReader struct {
+	*exportSource
+	reader *bufio.Reader
+	line   uint64
+	offset int64
+	next   string // block line read ahead
+	skip   bool   // the tx lines up to the next block line belong to a malformed block line
+}
+
+func (this *textExportReader) Format() string {
+	return EXPORT_FORMAT_TEXT
+}
+
+func (this *textExportReader) Header() *ArchiveHeader {
+	return nil
+}
+
+func (this *textExportReader) Position() *ExportPosition {
+	if this.next == "" {
+		return &ExportPosition{Offset: this.offset, Line: this.line}
+	}
+	return &ExportPosition{Offset: this.offset - int64(len(this.next)), Line: this.line - 1}
+}
+
+func (this *textExportReader) ReadBlock() (*ExportBlock, error) {
+	blockLine := this.next
+	this.next = ""
+	for blockLine == "" || (this.skip && !strings.HasPrefix(blockLine, string(blockLinePrefix))) {
+		line, err := this.readLine()
+		if err != nil {
+			return nil, err
+		}
+		blockLine = line
+	}
+	this.skip = false
+	if !strings.HasPrefix(blockLine, string(blockLinePrefix)) {
+		return nil, fmt.Errorf("line %d: tx line before the first block line", this.line)
+	}
+	block, err := ParseBlockLine(blockLine)
+	if err != nil {
+		this.skip = true
+		return nil, &BlockLineError{Line: this.line, Err: err}
+	}
+	for {
+		line, err := this.readLine()
+		if err == io.EOF {
+			return block, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(line, string(blockLinePrefix)) {
+			this.next = line
+			return block, nil
+		}
+		block.Txs = append(block.Txs, decodeTxLine(this.line, line))
+	}
+}
+
+// readLine returns a torn last line without error, io.EOF only comes alone
+func (this *textExportReader) readLine() (string, error) {
+	line, err := this.reader.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", err
+	}
+	this.line++
+	this.offset += int64(len(line))
+	return line, nil
+}
+
+func decodeTxLine(lineNum uint64, line string) *ExportTx {
+	etx := &ExportTx{
+		Line: lineNum,
+		Raw:  line,
+	}
+	content := strings.TrimRight(line, "\r\n")
+	index := strings.Index(content, " ")
+	if index < 0 {
+		etx.Err = fmt.Errorf("failed to split tx %s", content)
+		etx.ErrKind = TX_ERR_PARSE
+		return etx
+	}
+	etx.Hash = content[:index]
+	data, err := common.HexToBytes(content[index+1:])
+	if err != nil {
+		etx.Err = fmt.Errorf("failed to convert from hex to bytes %s", content)
+		etx.ErrKind = TX_ERR_HEX
+		return etx
+	}
+	etx.decode(data)
+	return etx
+}
+
+func (this *ExportTx) decode(data []byte) {
+	this.Tx, this.Err = deserializeTx(data)
+	if this.Err != nil {
+		this.ErrKind = TX_ERR_DESERIALIZE
+	}
+}
+
+func deserializeTx(data []byte) (*types.Transaction, error) {
+	tx := &types.Transaction{}
+	if err := tx.Deserialize(bytes.NewReader(data)); err != nil {
+		return nil, fmt.Errorf("failed to deserialize tx %x", data)
+	}
+	return tx, nil
+}
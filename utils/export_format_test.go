@@ -0,0 +1,151 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package utils
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/ontio/ontology/core/types"
+)
+
+// writeTestExport returns an export file of the blocks in format and compression
+func writeTestExport(format, compression string, blocks []*testBlock) ([]byte, error) {
+	buf := bytes.NewBuffer(nil)
+	out, err := NewCompressWriter(buf, compression)
+	if err != nil {
+		return nil, err
+	}
+	var writer ExportWriter
+	if format == EXPORT_FORMAT_TEXT {
+		writer = NewTextExportWriter(out)
+	} else {
+		err = WriteArchiveHeader(out, testArchiveHeader)
+		if err != nil {
+			return nil, err
+		}
+		writer = NewArchiveWriter(out, TX_ARCHIVE_VERSION, nil)
+	}
+	for _, block := range blocks {
+		header := &types.Header{Height: block.height, Timestamp: testBlockTime(block.height)}
+		err = writer.WriteBlock(header, block.txs)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = writer.Close()
+	if err == nil {
+		err = out.Close()
+	}
+	return buf.Bytes(), err
+}
+
+func TestNewExportReaderAt(t *testing.T) {
+	blocks := newTestBlocks([]uint32{10, 11, 12, 13}, []int{2, 0, 3, 1})
+	for _, format := range []string{EXPORT_FORMAT_TEXT, EXPORT_FORMAT_BINARY} {
+		for _, compression := range []string{COMPRESS_NONE, COMPRESS_GZIP, COMPRESS_ZSTD} {
+			t.Run(format+"/"+compression, func(t *testing.T) {
+				data, err := writeTestExport(format, compression, blocks)
+				if err != nil {
+					t.Fatalf("write export error:%s", err)
+				}
+				file := writeTestFile(t, string(data))
+				defer closeTestFile(file)
+
+				reader, err := NewExportReader(bytes.NewReader(data))
+				if err != nil {
+					t.Fatalf("NewExportReader error:%s", err)
+				}
+				defer reader.Close()
+				if reader.Format() != format || reader.Compression() != compression {
+					t.Fatalf("format %s compression %s, expected %s %s", reader.Format(), reader.Compression(),
+						format, compression)
+				}
+				// the position before the first block and after each block
+				positions := []*ExportPosition{reader.Position()}
+				for range blocks {
+					_, err = reader.ReadBlock()
+					if err != nil {
+						t.Fatalf("ReadBlock error:%s", err)
+					}
+					positions = append(positions, reader.Position())
+				}
+
+				for i, pos := range positions {
+					readerAt, err := NewExportReaderAt(file, pos)
+					if err != nil {
+						t.Fatalf("NewExportReaderAt %+v error:%s", *pos, err)
+					}
+					err = checkTestBlocks(readerAt, blocks[i:])
+					readerAt.Close()
+					if err != nil {
+						t.Errorf("read at %+v: %s", *pos, err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestNewExportReaderAtInvalidOffset(t *testing.T) {
+	blocks := newTestBlocks([]uint32{10, 11}, []int{2, 1})
+	data, err := writeTestExport(EXPORT_FORMAT_TEXT, COMPRESS_GZIP, blocks)
+	if err != nil {
+		t.Fatalf("write export error:%s", err)
+	}
+	file := writeTestFile(t, string(data))
+	defer closeTestFile(file)
+	// a compressed file is read from the start, an offset inside a record is rejected
+	_, err = NewExportReaderAt(file, &ExportPosition{Offset: 5, Line: 1})
+	if err == nil {
+		t.Fatalf("no error for an offset inside a block record")
+	}
+}
+
+func TestTextExportReaderMalformedBlockLine(t *testing.T) {
+	blocks := newTestBlocks([]uint32{10, 11, 12}, []int{2, 1, 1})
+	data, err := writeTestExport(EXPORT_FORMAT_TEXT, COMPRESS_NONE, blocks)
+	if err != nil {
+		t.Fatalf("write export error:%s", err)
+	}
+	// the block line of block 11 is on line 4
+	data = bytes.Replace(data, []byte("Block 11 num 1"), []byte("Block 11 nums 1"), 1)
+	reader, err := NewExportReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("NewExportReader error:%s", err)
+	}
+	defer reader.Close()
+	block, err := reader.ReadBlock()
+	if err != nil || block.Height != 10 {
+		t.Fatalf("ReadBlock returned %v error %v, expected block 10", block, err)
+	}
+	_, err = reader.ReadBlock()
+	if lineErr, ok := err.(*BlockLineError); !ok || lineErr.Line != 4 {
+		t.Fatalf("ReadBlock error %v, expected a block line error at line 4", err)
+	}
+	// the tx of the malformed block line is skipped
+	block, err = reader.ReadBlock()
+	if err != nil || block.Height != 12 || len(block.Txs) != 1 || block.Txs[0].Line != 7 {
+		t.Fatalf("ReadBlock returned %v error %v, expected block 12", block, err)
+	}
+	if _, err = reader.ReadBlock(); err != io.EOF {
+		t.Errorf("ReadBlock after the last block returned %v, expected EOF", err)
+	}
+}
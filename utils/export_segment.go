@@ -0,0 +1,171 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const EXPORT_MANIFEST_SUFFIX = ".manifest"
+
+// SegmentPolicy decides when a followed export starts a new segment file
+type SegmentPolicy struct {
+	MaxSize   int64         // bytes written to a segment, 0 means no limit
+	MaxBlocks uint32        // blocks in a segment, 0 means no limit
+	Window    time.Duration // a segment holds the blocks produced in one window of this length, 0 means no window
+	Retain    time.Duration // segments older than this before the latest block are removed, 0 keeps all
+}
+
+// ExportSegment is a file of a followed export. Its heights and times are those of the
+// exported blocks, so a filtered segment may hold fewer blocks than its height range.
+type ExportSegment struct {
+	File        string `json:"File"`
+	StartHeight uint32 `json:"StartHeight"`
+	EndHeight   uint32 `json:"EndHeight"` // the end block is not included
+	StartTime   uint32 `json:"StartTime"` // unix seconds of the first block
+	EndTime     uint32 `json:"EndTime"`   // unix seconds of the last block
+	Blocks      uint64 `json:"Blocks"`
+	Txs         uint64 `json:"Txs"`
+	Size        int64  `json:"Size"`
+	Complete    bool   `json:"Complete"` // false for the segment being written
+}
+
+// Add records a block exported into the segment
+func (this *ExportSegment) Add(height, timestamp uint32, txNum int) {
+	if this.Blocks == 0 {
+		this.StartTime = timestamp
+	}
+	this.Blocks++
+	this.Txs += uint64(txNum)
+	this.EndTime = timestamp
+	this.EndHeight = height + 1
+}
+
+// ShouldRotate returns true if the segment is full before a block produced at timestamp
+func (this *SegmentPolicy) ShouldRotate(segment *ExportSegment, timestamp uint32) bool {
+	if segment.Blocks == 0 {
+		return false
+	}
+	if this.MaxSize > 0 && segment.Size >= this.MaxSize {
+		return true
+	}
+	if this.MaxBlocks > 0 && segment.Blocks >= uint64(this.MaxBlocks) {
+		return true
+	}
+	// windows are aligned to the unix epoch, so daily segments start at 00:00 UTC
+	if window := uint32(this.Window / time.Second); window > 0 && timestamp/window != segment.StartTime/window {
+		return true
+	}
+	return false
+}
+
+// ExportManifest lists the segments of a followed export in height order
+type ExportManifest struct {
+	Format      string           `json:"Format"`
+	Compression string           `json:"Compression"`
+	NextHeight  uint32           `json:"NextHeight"` // height after the last exported block, kept when the segments expire
+	Segments    []*ExportSegment `json:"Segments"`
+	file        string
+}
+
+func ManifestFile(exportFile string) string {
+	return exportFile + EXPORT_MANIFEST_SUFFIX
+}
+
+func NewExportManifest(exportFile, format, compression string) *ExportManifest {
+	return &ExportManifest{
+		Format:      format,
+		Compression: compression,
+		file:        ManifestFile(exportFile),
+	}
+}
+
+// LoadExportManifest returns nil if the export has no manifest
+func LoadExportManifest(exportFile string) (*ExportManifest, error) {
+	manifest := &ExportManifest{file: ManifestFile(exportFile)}
+	found, err := readJSONFile(manifest.file, manifest)
+	if err != nil || !found {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// Save replaces the manifest at once, so a reader never sees a torn manifest
+func (this *ExportManifest) Save() error {
+	return writeJSONFileAtomic(this.file, this)
+}
+
+// Last returns the last segment, nil if there is none
+func (this *ExportManifest) Last() *ExportSegment {
+	if len(this.Segments) == 0 {
+		return nil
+	}
+	return this.Segments[len(this.Segments)-1]
+}
+
+// DropLast removes the last segment and its file
+func (this *ExportManifest) DropLast() error {
+	last := this.Last()
+	if last == nil {
+		return nil
+	}
+	err := os.Remove(last.File)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("remove segment:%s error:%s", last.File, err)
+	}
+	this.Segments = this.Segments[:len(this.Segments)-1]
+	return nil
+}
+
+// Expire removes the complete segments whose last block is older than retain before
+// latestTime, and their files. It returns the removed segments.
+func (this *ExportManifest) Expire(latestTime uint32, retain time.Duration) ([]*ExportSegment, error) {
+	if retain <= 0 {
+		return nil, nil
+	}
+	var expired []*ExportSegment
+	for len(this.Segments) > 0 {
+		segment := this.Segments[0]
+		if !segment.Complete || int64(segment.EndTime)+int64(retain/time.Second) >= int64(latestTime) {
+			break
+		}
+		err := os.Remove(segment.File)
+		if err != nil && !os.IsNotExist(err) {
+			return expired, fmt.Errorf("remove segment:%s error:%s", segment.File, err)
+		}
+		this.Segments = this.Segments[1:]
+		expired = append(expired, segment)
+	}
+	return expired, nil
+}
+
+// SegmentFileName names the segment starting at height after the export file, like
+// txs-0000012345.dat.gz for txs.dat.gz
+func SegmentFileName(exportFile string, height uint32) string {
+	dir, name := filepath.Split(exportFile)
+	ext := ""
+	if i := strings.Index(name, "."); i > 0 {
+		name, ext = name[:i], name[i:]
+	}
+	return fmt.Sprintf("%s%s-%010d%s", dir, name, height, ext)
+}
@@ -0,0 +1,179 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestShouldRotate(t *testing.T) {
+	// a segment of blocks 100-109 produced from 12:00:00 to 12:00:54 UTC
+	segment := &ExportSegment{StartHeight: 100, EndHeight: 110, StartTime: 1530619200, EndTime: 1530619254,
+		Blocks: 10, Size: 5000}
+	next := uint32(1530619260)
+	tests := []struct {
+		name      string
+		policy    SegmentPolicy
+		segment   *ExportSegment
+		timestamp uint32
+		rotate    bool
+	}{
+		{"no limit", SegmentPolicy{}, segment, next, false},
+		{"below the size", SegmentPolicy{MaxSize: 5001}, segment, next, false},
+		{"size", SegmentPolicy{MaxSize: 5000}, segment, next, true},
+		{"below the blocks", SegmentPolicy{MaxBlocks: 11}, segment, next, false},
+		{"blocks", SegmentPolicy{MaxBlocks: 10}, segment, next, true},
+		{"same hour", SegmentPolicy{Window: time.Hour}, segment, 1530622799, false},
+		{"next hour", SegmentPolicy{Window: time.Hour}, segment, 1530622800, true},
+		{"next day", SegmentPolicy{Window: 24 * time.Hour}, segment, 1530662400, true},
+		{"same day", SegmentPolicy{Window: 24 * time.Hour}, segment, 1530662399, false},
+		{"one of the limits", SegmentPolicy{MaxSize: 1 << 20, MaxBlocks: 10}, segment, next, true},
+		// an empty segment takes the block whatever its limits
+		{"empty segment", SegmentPolicy{MaxSize: 1, MaxBlocks: 1, Window: time.Second}, &ExportSegment{}, next, false},
+	}
+	for _, test := range tests {
+		if rotate := test.policy.ShouldRotate(test.segment, test.timestamp); rotate != test.rotate {
+			t.Errorf("%s: rotate %v, expected %v", test.name, rotate, test.rotate)
+		}
+	}
+}
+
+func TestExportSegmentAdd(t *testing.T) {
+	segment := &ExportSegment{StartHeight: 100, EndHeight: 100}
+	segment.Add(100, 1530619200, 2)
+	segment.Add(103, 1530619218, 0)
+	expected := ExportSegment{StartHeight: 100, EndHeight: 104, StartTime: 1530619200, EndTime: 1530619218,
+		Blocks: 2, Txs: 2}
+	if *segment != expected {
+		t.Errorf("segment %+v, expected %+v", *segment, expected)
+	}
+}
+
+func TestSegmentFileName(t *testing.T) {
+	tests := []struct {
+		exportFile string
+		height     uint32
+		fileName   string
+	}{
+		{"txs.dat", 12345, "txs-0000012345.dat"},
+		{"txs.dat.gz", 0, "txs-0000000000.dat.gz"},
+		{"txs", 7, "txs-0000000007"},
+		{"/data/export/txs.tar.zst", 4294967295, "/data/export/txs-4294967295.tar.zst"},
+		{"./out.v2/txs.dat", 1, "./out.v2/txs-0000000001.dat"},
+		{".txs", 1, ".txs-0000000001"},
+	}
+	for _, test := range tests {
+		if fileName := SegmentFileName(test.exportFile, test.height); fileName != test.fileName {
+			t.Errorf("%s at %d: %s, expected %s", test.exportFile, test.height, fileName, test.fileName)
+		}
+	}
+}
+
+func TestExpireSegments(t *testing.T) {
+	dir, err := ioutil.TempDir("", "txreplay-test")
+	if err != nil {
+		t.Fatalf("TempDir error:%s", err)
+	}
+	defer os.RemoveAll(dir)
+	exportFile := filepath.Join(dir, "txs.dat")
+	manifest := NewExportManifest(exportFile, EXPORT_FORMAT_TEXT, COMPRESS_NONE)
+	// hourly segments ending at 01:00, 02:00 and 03:00 and the segment being written
+	for i, endTime := range []uint32{3600, 7200, 10800, 14400} {
+		segment := &ExportSegment{
+			File:     SegmentFileName(exportFile, uint32(i*100)),
+			EndTime:  endTime,
+			Complete: i < 3,
+		}
+		err = ioutil.WriteFile(segment.File, []byte("Block 0 num 0 time 0\n"), 0664)
+		if err != nil {
+			t.Fatalf("WriteFile error:%s", err)
+		}
+		manifest.Segments = append(manifest.Segments, segment)
+	}
+	// the third segment file is already removed
+	os.Remove(manifest.Segments[2].File)
+
+	expire := func(latestTime uint32, retain time.Duration, expired int, left int) {
+		segments, err := manifest.Expire(latestTime, retain)
+		if err != nil {
+			t.Fatalf("Expire error:%s", err)
+		}
+		if len(segments) != expired || len(manifest.Segments) != left {
+			t.Fatalf("expire at %d: %d segments expired %d left, expected %d and %d", latestTime,
+				len(segments), len(manifest.Segments), expired, left)
+		}
+		for _, segment := range segments {
+			if _, err = os.Stat(segment.File); !os.IsNotExist(err) {
+				t.Errorf("expired segment %s is not removed", segment.File)
+			}
+		}
+	}
+	expire(1000000, 0, 0, 4)
+	expire(3600+7200, 2*time.Hour, 0, 4)
+	expire(3600+7200+1, 2*time.Hour, 1, 3)
+	expire(1000000, time.Hour, 2, 1)
+	// the segment being written is kept
+	expire(1000000, time.Second, 0, 1)
+	if _, err = os.Stat(manifest.Segments[0].File); err != nil {
+		t.Errorf("segment being written: %s", err)
+	}
+}
+
+func TestExportManifestSave(t *testing.T) {
+	dir, err := ioutil.TempDir("", "txreplay-test")
+	if err != nil {
+		t.Fatalf("TempDir error:%s", err)
+	}
+	defer os.RemoveAll(dir)
+	exportFile := filepath.Join(dir, "txs.dat.gz")
+	manifest, err := LoadExportManifest(exportFile)
+	if err != nil || manifest != nil {
+		t.Fatalf("LoadExportManifest of no manifest returned %v error %v", manifest, err)
+	}
+	manifest = NewExportManifest(exportFile, EXPORT_FORMAT_TEXT, COMPRESS_GZIP)
+	manifest.NextHeight = 210
+	manifest.Segments = []*ExportSegment{
+		{File: SegmentFileName(exportFile, 100), StartHeight: 100, EndHeight: 200, Blocks: 40, Complete: true},
+		{File: SegmentFileName(exportFile, 200), StartHeight: 200, EndHeight: 210, Blocks: 3},
+	}
+	err = manifest.Save()
+	if err != nil {
+		t.Fatalf("Save error:%s", err)
+	}
+	loaded, err := LoadExportManifest(exportFile)
+	if err != nil {
+		t.Fatalf("LoadExportManifest error:%s", err)
+	}
+	if loaded.Format != manifest.Format || loaded.Compression != manifest.Compression ||
+		loaded.NextHeight != 210 || len(loaded.Segments) != 2 {
+		t.Fatalf("loaded manifest %+v, expected %+v", *loaded, *manifest)
+	}
+	for i, segment := range loaded.Segments {
+		if *segment != *manifest.Segments[i] {
+			t.Errorf("segment %d %+v, expected %+v", i, *segment, *manifest.Segments[i])
+		}
+	}
+	if last := loaded.Last(); last == nil || last.StartHeight != 200 {
+		t.Errorf("last segment %v, expected the segment of 200", last)
+	}
+}
@@ -0,0 +1,61 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package utils
+
+import (
+	"fmt"
+	"os"
+)
+
+const IMPORT_JOURNAL_FILE_NAME = "tximport.journal"
+
+// ImportProgress is the point of the import file up to which every tx is packed or rejected
+type ImportProgress struct {
+	Position  ExportPosition `json:"Position"`  // position after the last source block processed as a whole
+	SourceTxs int            `json:"SourceTxs"` // txs of the next source block already processed
+	TotalTxs  int            `json:"TotalTxs"`  // txs decoded before this point
+	ErrNum    int            `json:"ErrNum"`    // txs rejected before this point
+}
+
+// ImportJournal records the progress of an import in the ledger directory. It is
+// saved after each block added to the ledger, so it always describes the ledger.
+type ImportJournal struct {
+	ImportProgress
+	File         string `json:"File"`
+	SourceHeight uint32 `json:"SourceHeight"` // source block of the last packed tx
+	BlockHeight  uint32 `json:"BlockHeight"`  // last block added to the ledger
+	PackedTxs    int    `json:"PackedTxs"`
+	path         string
+}
+
+func NewImportJournal(ledgerDir, file string) *ImportJournal {
+	return &ImportJournal{
+		File: file,
+		path: fmt.Sprintf("%s%s%s", ledgerDir, string(os.PathSeparator), IMPORT_JOURNAL_FILE_NAME),
+	}
+}
+
+// Load reads the saved journal, it returns false if there is none
+func (this *ImportJournal) Load() (bool, error) {
+	return readJSONFile(this.path, this)
+}
+
+func (this *ImportJournal) Save() error {
+	return writeJSONFileAtomic(this.path, this)
+}
@@ -0,0 +1,74 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/ontio/ontology/common"
+)
+
+// readJSONFile decodes the JSON file at path into v, it returns false if there is no file
+func readJSONFile(path string, v interface{}) (bool, error) {
+	if !common.FileExisted(path) {
+		return false, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return false, fmt.Errorf("ioutil.ReadFile:%s error:%s", path, err)
+	}
+	err = json.Unmarshal(data, v)
+	if err != nil {
+		return false, fmt.Errorf("json.Unmarshal:%s error:%s", path, err)
+	}
+	return true, nil
+}
+
+// writeJSONFileAtomic writes v to a temp file, syncs it to the disk and renames it to path, so
+// a crash or a power loss leaves the old file or the new one, never a torn file
+func writeJSONFileAtomic(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("json.Marshal:%s error:%s", path, err)
+	}
+	tmpFile := path + ".tmp"
+	file, err := os.OpenFile(tmpFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0664)
+	if err != nil {
+		return fmt.Errorf("open file:%s error:%s", tmpFile, err)
+	}
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("write file:%s error:%s", tmpFile, err)
+	}
+	err = os.Rename(tmpFile, path)
+	if err != nil {
+		return fmt.Errorf("rename file:%s error:%s", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package utils
+
+import (
+	"fmt"
+	"os"
+)
+
+const MIRROR_JOURNAL_FILE_NAME = "txmirror.journal"
+
+// MirrorJournal records the progress of a mirror in the ledger directory. It is saved after
+// each block added to the ledger, and at times while the source blocks have no txs.
+type MirrorJournal struct {
+	Source      string `json:"Source"`
+	NetworkId   uint32 `json:"NetworkId"`   // network of the source node
+	NextHeight  uint32 `json:"NextHeight"`  // source block to mirror next
+	SourceTxs   int    `json:"SourceTxs"`   // txs of the next source block already processed
+	BlockHeight uint32 `json:"BlockHeight"` // last block added to the ledger
+	MirroredTxs int    `json:"MirroredTxs"`
+	ErrNum      int    `json:"ErrNum"`
+	path        string
+}
+
+func NewMirrorJournal(ledgerDir string) *MirrorJournal {
+	return &MirrorJournal{
+		path: fmt.Sprintf("%s%s%s", ledgerDir, string(os.PathSeparator), MIRROR_JOURNAL_FILE_NAME),
+	}
+}
+
+// Load reads the saved journal, it returns false if there is none
+func (this *MirrorJournal) Load() (bool, error) {
+	return readJSONFile(this.path, this)
+}
+
+func (this *MirrorJournal) Save() error {
+	return writeJSONFileAtomic(this.path, this)
+}
@@ -0,0 +1,439 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package utils
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ontio/ontology/common"
+	"github.com/ontio/ontology/core/types"
+)
+
+const (
+	HEALTH_WINDOW       = 20               // latest requests of an endpoint its health is judged on
+	HEALTH_MIN_REQUESTS = 5                // requests in the window before an endpoint can be ejected
+	EJECT_COOLDOWN      = 30 * time.Second // time an ejected endpoint is left out
+)
+
+// HealthPolicy decides when an endpoint is ejected
+type HealthPolicy struct {
+	MaxErrorRate float64       // ratio of failed requests in the window, 0 means no limit
+	MaxLatency   time.Duration // average latency of the requests in the window, 0 means no limit
+	CrossCheck   uint32        // compare the block hash of every CrossCheck heights on all endpoints, 0 means never
+}
+
+// EndpointStats is the request counts of an endpoint
+type EndpointStats struct {
+	Addr       string
+	Requests   uint64
+	Errors     uint64
+	AvgLatency time.Duration
+	Ejections  uint64
+	Ejected    bool
+}
+
+type requestSample struct {
+	failed  bool
+	latency time.Duration
+}
+
+type endpoint struct {
+	client       *RpcClient
+	inflight     int
+	window       []requestSample
+	next         int // index of the oldest sample in a full window
+	requests     uint64
+	errors       uint64
+	totalLatency time.Duration
+	ejections    uint64
+	ejectedUntil time.Time
+}
+
+func (this *endpoint) add(sample requestSample) {
+	this.requests++
+	this.totalLatency += sample.latency
+	if sample.failed {
+		this.errors++
+	}
+	if len(this.window) < HEALTH_WINDOW {
+		this.window = append(this.window, sample)
+		return
+	}
+	this.window[this.next] = sample
+	this.next = (this.next + 1) % HEALTH_WINDOW
+}
+
+// unhealthy returns why the endpoint breaks the policy, or ""
+func (this *endpoint) unhealthy(policy *HealthPolicy) string {
+	if len(this.window) < HEALTH_MIN_REQUESTS {
+		return ""
+	}
+	var failed int
+	var latency time.Duration
+	for _, sample := range this.window {
+		if sample.failed {
+			failed++
+		}
+		latency += sample.latency
+	}
+	errorRate := float64(failed) / float64(len(this.window))
+	if policy.MaxErrorRate > 0 && errorRate > policy.MaxErrorRate {
+		return fmt.Sprintf("error rate %.2f", errorRate)
+	}
+	avgLatency := latency / time.Duration(len(this.window))
+	if policy.MaxLatency > 0 && avgLatency > policy.MaxLatency {
+		return fmt.Sprintf("latency %s", avgLatency)
+	}
+	return ""
+}
+
+// MultiRpcBlockSource spreads the block requests over the rpc servers of several nodes. An
+// endpoint breaking the HealthPolicy is ejected for a while, and the block hash at sampled
+// heights is compared on all endpoints, so a lagging or forked node cannot slip wrong
+// blocks into an export.
+type MultiRpcBlockSource struct {
+	ctx       context.Context
+	policy    HealthPolicy
+	lock      sync.Mutex
+	endpoints []*endpoint
+}
+
+func NewMultiRpcBlockSource(ctx context.Context, clients []*RpcClient, policy *HealthPolicy) *MultiRpcBlockSource {
+	source := &MultiRpcBlockSource{
+		ctx:    ctx,
+		policy: *policy,
+	}
+	for _, client := range clients {
+		source.endpoints = append(source.endpoints, &endpoint{client: client})
+	}
+	return source
+}
+
+func (this *MultiRpcBlockSource) Name() string {
+	addrs := make([]string, 0, len(this.endpoints))
+	for _, ep := range this.endpoints {
+		addrs = append(addrs, ep.client.Addr())
+	}
+	return strings.Join(addrs, ",")
+}
+
+// GetNetworkId checks that every endpoint is on the same network
+func (this *MultiRpcBlockSource) GetNetworkId() (uint32, error) {
+	var networkId uint32
+	for i, ep := range this.endpoints {
+		id, err := ep.client.GetNetworkId(this.ctx)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %s", ep.client.Addr(), err)
+		}
+		if i == 0 {
+			networkId = id
+		} else if id != networkId {
+			return 0, fmt.Errorf("%s is on network %d but %s is on network %d", ep.client.Addr(), id,
+				this.endpoints[0].client.Addr(), networkId)
+		}
+	}
+	return networkId, nil
+}
+
+// GetBlockCount returns the highest block count of the endpoints, so a lagging node does not
+// cut the export short. The blocks only some nodes have are fetched from them.
+func (this *MultiRpcBlockSource) GetBlockCount() (uint32, error) {
+	var count uint32
+	var lastErr error
+	for _, ep := range this.endpoints {
+		num, err := ep.client.GetBlockCount(this.ctx)
+		if err != nil {
+			lastErr = fmt.Errorf("%s: %s", ep.client.Addr(), err)
+			continue
+		}
+		if num > count {
+			count = num
+		}
+	}
+	if count == 0 {
+		return 0, lastErr
+	}
+	return count, nil
+}
+
+func (this *MultiRpcBlockSource) GetBlock(height uint32) (*types.Block, error) {
+	var block *types.Block
+	ep, err := this.fetch(func(client *RpcClient) error {
+		blockData, err := client.GetBlockData(this.ctx, height)
+		if err != nil {
+			return fmt.Errorf("Get block:%d error:%s", height, err)
+		}
+		block, err = deserializeBlock(blockData)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return this.checkBlock(height, block, ep)
+}
+
+// GetHeader is not cross-checked, the headers only guide the search of a height by time
+func (this *MultiRpcBlockSource) GetHeader(height uint32) (*types.Header, error) {
+	var header *types.Header
+	_, err := this.fetch(func(client *RpcClient) error {
+		var err error
+		header, err = client.GetHeader(this.ctx, height)
+		if err != nil {
+			return fmt.Errorf("Get header:%d error:%s", height, err)
+		}
+		return nil
+	})
+	return header, err
+}
+
+// GetBlocks gets the blocks from one endpoint in a batch request
+func (this *MultiRpcBlockSource) GetBlocks(heights []uint32) ([]*types.Block, error) {
+	var blocks []*types.Block
+	ep, err := this.fetch(func(client *RpcClient) error {
+		blocksData, err := client.GetBlocksData(this.ctx, heights)
+		if err != nil {
+			return err
+		}
+		blocks, err = deserializeBlocks(heights, blocksData)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i, height := range heights {
+		blocks[i], err = this.checkBlock(height, blocks[i], ep)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return blocks, nil
+}
+
+// GetBlockByHash cross-checks the block at its height whatever the height is, as the block
+// of a hash may be on the fork of one node only
+func (this *MultiRpcBlockSource) GetBlockByHash(hash common.Uint256) (*types.Block, error) {
+	var block *types.Block
+	ep, err := this.fetch(func(client *RpcClient) error {
+		blockData, err := client.GetBlockData(this.ctx, hash.ToHexString())
+		if err != nil {
+			return fmt.Errorf("Get block:%s error:%s", hash.ToHexString(), err)
+		}
+		block, err = deserializeBlock(blockData)
+		if err != nil {
+			return err
+		}
+		if blockHash := block.Hash(); blockHash != hash {
+			return fmt.Errorf("Get block:%s returned block %s", hash.ToHexString(), blockHash.ToHexString())
+		}
+		return nil
+	})
+	if err != nil || this.policy.CrossCheck == 0 {
+		return block, err
+	}
+	height := block.Header.Height
+	checked, err := this.crossCheck(height, block, ep)
+	if err != nil {
+		return nil, err
+	}
+	if checked.Hash() != hash {
+		return nil, fmt.Errorf("block %s is not the block %d of the majority of the endpoints", hash.ToHexString(), height)
+	}
+	return block, nil
+}
+
+// checkBlock cross-checks the block got from ep at the sampled heights
+func (this *MultiRpcBlockSource) checkBlock(height uint32, block *types.Block, ep *endpoint) (*types.Block, error) {
+	if this.policy.CrossCheck != 0 && height%this.policy.CrossCheck == 0 {
+		return this.crossCheck(height, block, ep)
+	}
+	return block, nil
+}
+
+func (this *MultiRpcBlockSource) Close() error {
+	return nil
+}
+
+// fetch runs the request on the healthy endpoint with the fewest requests in flight, and
+// on the next ones if it fails. It returns the endpoint that succeeded.
+func (this *MultiRpcBlockSource) fetch(request func(client *RpcClient) error) (*endpoint, error) {
+	tried := make(map[*endpoint]bool)
+	var lastErr error
+	for len(tried) < len(this.endpoints) {
+		ep := this.pick(tried)
+		tried[ep] = true
+		start := time.Now()
+		err := request(ep.client)
+		this.done(ep, requestSample{failed: err != nil, latency: time.Since(start)})
+		if err == nil {
+			return ep, nil
+		}
+		if this.ctx.Err() != nil {
+			return nil, this.ctx.Err()
+		}
+		lastErr = fmt.Errorf("%s: %s", ep.client.Addr(), err)
+	}
+	return nil, lastErr
+}
+
+// pick returns an endpoint not tried yet. If every such endpoint is ejected, the one ejected
+// earliest is given another chance.
+func (this *MultiRpcBlockSource) pick(tried map[*endpoint]bool) *endpoint {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	now := time.Now()
+	var best, ejected *endpoint
+	for _, ep := range this.endpoints {
+		if tried[ep] {
+			continue
+		}
+		if now.Before(ep.ejectedUntil) {
+			if ejected == nil || ep.ejectedUntil.Before(ejected.ejectedUntil) {
+				ejected = ep
+			}
+			continue
+		}
+		if best == nil || ep.inflight < best.inflight {
+			best = ep
+		}
+	}
+	if best == nil {
+		best = ejected
+	}
+	best.inflight++
+	return best
+}
+
+func (this *MultiRpcBlockSource) done(ep *endpoint, sample requestSample) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	ep.inflight--
+	ep.add(sample)
+	if reason := ep.unhealthy(&this.policy); reason != "" {
+		this.eject(ep, reason)
+	}
+}
+
+// eject leaves the endpoint out for EJECT_COOLDOWN, its window is cleared so it comes back on probation.
+// An endpoint already ejected keeps its cooldown.
+func (this *MultiRpcBlockSource) eject(ep *endpoint, reason string) {
+	if time.Now().Before(ep.ejectedUntil) {
+		return
+	}
+	fmt.Printf("Eject endpoint %s for %s: %s\n", ep.client.Addr(), EJECT_COOLDOWN, reason)
+	ep.ejections++
+	ep.ejectedUntil = time.Now().Add(EJECT_COOLDOWN)
+	ep.window = ep.window[:0]
+	ep.next = 0
+}
+
+// crossCheck compares the hash of the block with the block hashes of the other endpoints at
+// the height. The hash of the majority wins and the endpoints with another hash are ejected.
+func (this *MultiRpcBlockSource) crossCheck(height uint32, block *types.Block, source *endpoint) (*types.Block, error) {
+	votes := map[common.Uint256][]*endpoint{block.Hash(): {source}}
+	answered := 1
+	for _, ep := range this.endpoints {
+		if ep == source {
+			continue
+		}
+		hash, err := ep.client.GetBlockHash(this.ctx, height)
+		if err != nil {
+			// a lagging node may not have the block yet, it has no vote
+			continue
+		}
+		votes[hash] = append(votes[hash], ep)
+		answered++
+	}
+	if len(votes) == 1 {
+		return block, nil
+	}
+	var majority common.Uint256
+	found := false
+	for hash, eps := range votes {
+		if len(eps)*2 > answered {
+			majority = hash
+			found = true
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("endpoints disagree on the hash of block %d: %s", height, formatVotes(votes))
+	}
+	this.lock.Lock()
+	for hash, eps := range votes {
+		if hash == majority {
+			continue
+		}
+		for _, ep := range eps {
+			this.eject(ep, fmt.Sprintf("block %d hash %s differs from the majority %s", height,
+				hash.ToHexString(), majority.ToHexString()))
+		}
+	}
+	this.lock.Unlock()
+	if block.Hash() == majority {
+		return block, nil
+	}
+	// the block came from the minority, fetch it again from the majority
+	blockData, err := votes[majority][0].client.GetBlockData(this.ctx, height)
+	if err != nil {
+		return nil, fmt.Errorf("Get block:%d error:%s", height, err)
+	}
+	block, err = deserializeBlock(blockData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read block at height %d err %v", height, err)
+	}
+	if block.Hash() != majority {
+		return nil, fmt.Errorf("block %d from %s does not match its hash", height, votes[majority][0].client.Addr())
+	}
+	return block, nil
+}
+
+func formatVotes(votes map[common.Uint256][]*endpoint) string {
+	var items []string
+	for hash, eps := range votes {
+		for _, ep := range eps {
+			items = append(items, fmt.Sprintf("%s:%s", ep.client.Addr(), hash.ToHexString()))
+		}
+	}
+	return strings.Join(items, ", ")
+}
+
+// Stats returns the request counts of every endpoint
+func (this *MultiRpcBlockSource) Stats() []*EndpointStats {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	stats := make([]*EndpointStats, 0, len(this.endpoints))
+	now := time.Now()
+	for _, ep := range this.endpoints {
+		stat := &EndpointStats{
+			Addr:      ep.client.Addr(),
+			Requests:  ep.requests,
+			Errors:    ep.errors,
+			Ejections: ep.ejections,
+			Ejected:   now.Before(ep.ejectedUntil),
+		}
+		if ep.requests != 0 {
+			stat.AvgLatency = ep.totalLatency / time.Duration(ep.requests)
+		}
+		stats = append(stats, stat)
+	}
+	return stats
+}
@@ -0,0 +1,289 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package utils
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testNode is a rpc server of a chain which can be made to fail
+type testNode struct {
+	*testRpcServer
+	chain   *testChain
+	failing int32
+}
+
+func newTestNode(chain *testChain) *testNode {
+	node := &testNode{chain: chain}
+	handle := testChainHandler(chain)
+	node.testRpcServer = newTestRpcServer(func(req *JsonRpcRequest) *JsonRpcResponse {
+		if atomic.LoadInt32(&node.failing) != 0 {
+			return nil
+		}
+		return handle(req)
+	})
+	return node
+}
+
+func (this *testNode) fail(failing bool) {
+	if failing {
+		atomic.StoreInt32(&this.failing, 1)
+	} else {
+		atomic.StoreInt32(&this.failing, 0)
+	}
+}
+
+// newTestMultiSource returns a source of the nodes, the requests are not retried
+func newTestMultiSource(policy *HealthPolicy, nodes ...*testNode) *MultiRpcBlockSource {
+	clients := make([]*RpcClient, 0, len(nodes))
+	for _, node := range nodes {
+		clients = append(clients, NewRpcClient(node.URL, &RpcConfig{}))
+	}
+	return NewMultiRpcBlockSource(context.Background(), clients, policy)
+}
+
+func closeTestNodes(nodes ...*testNode) {
+	for _, node := range nodes {
+		node.Close()
+	}
+}
+
+// newTestFork returns a chain with the blocks of chain up to height and other blocks after
+func newTestFork(chain *testChain, height uint32) *testChain {
+	fork := newTestChain(uint32(len(chain.blocks)))
+	for _, block := range fork.blocks[height:] {
+		block.Header.Timestamp++
+	}
+	return fork
+}
+
+func getTestBlocks(t *testing.T, source BlockSource, heights ...uint32) {
+	for _, height := range heights {
+		block, err := source.GetBlock(height)
+		if err != nil {
+			t.Fatalf("GetBlock %d error:%s", height, err)
+		}
+		if block.Header.Height != height {
+			t.Fatalf("GetBlock %d returned block %d", height, block.Header.Height)
+		}
+	}
+}
+
+func checkTestEjected(t *testing.T, source *MultiRpcBlockSource, ejected ...bool) {
+	for i, stat := range source.Stats() {
+		if stat.Ejected != ejected[i] {
+			t.Fatalf("endpoint %d ejected %v after %d requests %d errors, expected %v", i, stat.Ejected,
+				stat.Requests, stat.Errors, ejected[i])
+		}
+	}
+}
+
+func TestMultiSourceErrorRate(t *testing.T) {
+	chain := newTestChain(10)
+	bad, good := newTestNode(chain), newTestNode(chain)
+	defer closeTestNodes(bad, good)
+	bad.fail(true)
+	source := newTestMultiSource(&HealthPolicy{MaxErrorRate: 0.5}, bad, good)
+	// an idle source picks the first endpoint, the failed requests go on to the next one
+	for i := 0; i < HEALTH_MIN_REQUESTS-1; i++ {
+		getTestBlocks(t, source, 1)
+		checkTestEjected(t, source, false, false)
+	}
+	getTestBlocks(t, source, 1)
+	checkTestEjected(t, source, true, false)
+	getTestBlocks(t, source, 2, 3)
+	stats := source.Stats()
+	if stats[0].Requests != HEALTH_MIN_REQUESTS || stats[0].Errors != HEALTH_MIN_REQUESTS || stats[0].Ejections != 1 {
+		t.Errorf("bad endpoint stats %+v", *stats[0])
+	}
+	if stats[1].Requests != HEALTH_MIN_REQUESTS+2 || stats[1].Errors != 0 || stats[1].Ejections != 0 {
+		t.Errorf("good endpoint stats %+v", *stats[1])
+	}
+}
+
+func TestMultiSourceWindow(t *testing.T) {
+	chain := newTestChain(10)
+	flaky, good := newTestNode(chain), newTestNode(chain)
+	defer closeTestNodes(flaky, good)
+	source := newTestMultiSource(&HealthPolicy{MaxErrorRate: 0.5}, flaky, good)
+	for i := 0; i < HEALTH_WINDOW; i++ {
+		getTestBlocks(t, source, 1)
+	}
+	// the errors are counted over the latest HEALTH_WINDOW requests, not over all requests
+	flaky.fail(true)
+	for i := 0; i < HEALTH_WINDOW/2; i++ {
+		getTestBlocks(t, source, 1)
+		checkTestEjected(t, source, false, false)
+	}
+	getTestBlocks(t, source, 1)
+	checkTestEjected(t, source, true, false)
+}
+
+func TestMultiSourceLatency(t *testing.T) {
+	chain := newTestChain(10)
+	slow := newTestNode(chain)
+	fast := newTestNode(newTestChain(10))
+	defer closeTestNodes(slow, fast)
+	chain.delay = func(height uint32) time.Duration {
+		return 20 * time.Millisecond
+	}
+	source := newTestMultiSource(&HealthPolicy{MaxLatency: 10 * time.Millisecond}, slow, fast)
+	for i := 0; i < HEALTH_MIN_REQUESTS; i++ {
+		getTestBlocks(t, source, 1)
+	}
+	checkTestEjected(t, source, true, false)
+	getTestBlocks(t, source, 2)
+	if stats := source.Stats(); stats[1].Requests != 1 {
+		t.Errorf("fast endpoint got %d requests, expected 1", stats[1].Requests)
+	}
+}
+
+func TestMultiSourceCooldown(t *testing.T) {
+	chain := newTestChain(10)
+	bad, good := newTestNode(chain), newTestNode(chain)
+	defer closeTestNodes(bad, good)
+	bad.fail(true)
+	source := newTestMultiSource(&HealthPolicy{MaxErrorRate: 0.5}, bad, good)
+	for i := 0; i < HEALTH_MIN_REQUESTS; i++ {
+		getTestBlocks(t, source, 1)
+	}
+	ep := source.endpoints[0]
+	if cooldown := time.Until(ep.ejectedUntil); cooldown < EJECT_COOLDOWN-time.Second || cooldown > EJECT_COOLDOWN {
+		t.Fatalf("ejected for %s, expected %s", cooldown, EJECT_COOLDOWN)
+	}
+	// the ejected endpoint is left out
+	getTestBlocks(t, source, 1, 2, 3)
+	if stats := source.Stats(); stats[0].Requests != HEALTH_MIN_REQUESTS {
+		t.Fatalf("ejected endpoint got %d requests, expected %d", stats[0].Requests, HEALTH_MIN_REQUESTS)
+	}
+
+	// after the cooldown the endpoint is back on probation, its earlier errors are forgotten
+	ep.ejectedUntil = time.Now().Add(-time.Millisecond)
+	for i := 0; i < HEALTH_MIN_REQUESTS-1; i++ {
+		getTestBlocks(t, source, 1)
+		checkTestEjected(t, source, false, false)
+	}
+	getTestBlocks(t, source, 1)
+	checkTestEjected(t, source, true, false)
+	if stats := source.Stats(); stats[0].Ejections != 2 {
+		t.Errorf("%d ejections, expected 2", stats[0].Ejections)
+	}
+}
+
+func TestMultiSourceAllEjected(t *testing.T) {
+	chain := newTestChain(10)
+	first, second := newTestNode(chain), newTestNode(chain)
+	defer closeTestNodes(first, second)
+	source := newTestMultiSource(&HealthPolicy{MaxErrorRate: 0.5}, first, second)
+	now := time.Now()
+	source.endpoints[0].ejectedUntil = now.Add(2 * time.Second)
+	source.endpoints[1].ejectedUntil = now.Add(time.Second)
+	// the endpoint ejected earliest is given another chance
+	getTestBlocks(t, source, 1)
+	if stats := source.Stats(); stats[0].Requests != 0 || stats[1].Requests != 1 {
+		t.Errorf("endpoints got %d and %d requests, expected 0 and 1", stats[0].Requests, stats[1].Requests)
+	}
+	// the next one if it fails
+	second.fail(true)
+	getTestBlocks(t, source, 1)
+	if stats := source.Stats(); stats[0].Requests != 1 || stats[1].Requests != 2 {
+		t.Errorf("endpoints got %d and %d requests, expected 1 and 2", stats[0].Requests, stats[1].Requests)
+	}
+	first.fail(true)
+	if _, err := source.GetBlock(1); err == nil {
+		t.Errorf("no error with every endpoint failing")
+	}
+}
+
+func TestMultiSourceCrossCheck(t *testing.T) {
+	chain := newTestChain(10)
+	fork := newTestFork(chain, 5)
+	forked, first, second := newTestNode(fork), newTestNode(chain), newTestNode(chain)
+	defer closeTestNodes(forked, first, second)
+	source := newTestMultiSource(&HealthPolicy{CrossCheck: 5}, forked, first, second)
+
+	// the block is only compared at the sampled heights
+	block, err := source.GetBlock(6)
+	if err != nil || block.Hash() != fork.blocks[6].Hash() {
+		t.Fatalf("GetBlock 6 returned %v error %v, expected the block of the fork", block, err)
+	}
+	checkTestEjected(t, source, false, false, false)
+	// the forked block is replaced by the block of the majority and the forked node is ejected
+	block, err = source.GetBlock(5)
+	if err != nil || block.Hash() != chain.blocks[5].Hash() {
+		t.Fatalf("GetBlock 5 returned %v error %v, expected the block of the majority", block, err)
+	}
+	checkTestEjected(t, source, true, false, false)
+	// the heights before the fork agree
+	getTestBlocks(t, source, 0)
+	checkTestEjected(t, source, true, false, false)
+}
+
+func TestMultiSourceCrossCheckNoMajority(t *testing.T) {
+	chain := newTestChain(10)
+	forked, other := newTestNode(newTestFork(chain, 5)), newTestNode(chain)
+	lagging := newTestNode(newTestChain(3))
+	defer closeTestNodes(forked, other, lagging)
+	source := newTestMultiSource(&HealthPolicy{CrossCheck: 5}, forked, other, lagging)
+	// the lagging node does not have the block and has no vote
+	_, err := source.GetBlock(5)
+	if err == nil {
+		t.Fatalf("no error for endpoints disagreeing on a block")
+	}
+	checkTestEjected(t, source, false, false, false)
+
+	// a lagging node does not vote against the others
+	source = newTestMultiSource(&HealthPolicy{CrossCheck: 5}, other, lagging)
+	getTestBlocks(t, source, 5)
+	checkTestEjected(t, source, false, false)
+}
+
+func TestMultiSourceGetBlockByHash(t *testing.T) {
+	chain := newTestChain(10)
+	fork := newTestFork(chain, 5)
+	forked, first, second := newTestNode(fork), newTestNode(chain), newTestNode(chain)
+	defer closeTestNodes(forked, first, second)
+
+	// the forked node does not have the block, the next endpoint has it and the majority agrees
+	source := newTestMultiSource(&HealthPolicy{CrossCheck: 5}, forked, first, second)
+	block, err := source.GetBlockByHash(chain.blocks[7].Hash())
+	if err != nil || block.Hash() != chain.blocks[7].Hash() {
+		t.Fatalf("GetBlockByHash returned %v error %v, expected block 7", block, err)
+	}
+	// the block is checked at a height that is not sampled
+	checkTestEjected(t, source, true, false, false)
+
+	// the block of the fork is not the block of the majority
+	source = newTestMultiSource(&HealthPolicy{CrossCheck: 5}, forked, first, second)
+	_, err = source.GetBlockByHash(fork.blocks[7].Hash())
+	if err == nil {
+		t.Fatalf("no error for a block of the fork")
+	}
+	checkTestEjected(t, source, true, false, false)
+
+	// without cross-checks the block of any endpoint is taken
+	source = newTestMultiSource(&HealthPolicy{}, forked, first, second)
+	block, err = source.GetBlockByHash(fork.blocks[7].Hash())
+	if err != nil || block.Hash() != fork.blocks[7].Hash() {
+		t.Fatalf("GetBlockByHash returned %v error %v, expected block 7 of the fork", block, err)
+	}
+}
@@ -0,0 +1,228 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package utils
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// RateLimiter paces the blocks added by an import
+type RateLimiter interface {
+	// Wait blocks until a block of txNum txs packed from a source block at sourceTime can be
+	// added, it returns the error of ctx if ctx is done first
+	Wait(ctx context.Context, txNum int, sourceTime uint32) error
+	// Target returns the target rates of txs and blocks per second, 0 if there is no target
+	Target() (tps, bps float64)
+	Stop()
+}
+
+// tickerLimiter adds a block per tick, however many txs it has
+type tickerLimiter struct {
+	delay  time.Duration
+	ticker *time.Ticker
+}
+
+// NewTickerLimiter waits the delay between blocks, a delay of 0 never waits
+func NewTickerLimiter(delay time.Duration) RateLimiter {
+	limiter := &tickerLimiter{delay: delay}
+	if delay > 0 {
+		limiter.ticker = time.NewTicker(delay)
+	}
+	return limiter
+}
+
+func (this *tickerLimiter) Wait(ctx context.Context, txNum int, sourceTime uint32) error {
+	if this.ticker == nil {
+		return ctx.Err()
+	}
+	select {
+	case <-this.ticker.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (this *tickerLimiter) Target() (float64, float64) {
+	if this.delay == 0 {
+		return 0, 0
+	}
+	return 0, float64(time.Second) / float64(this.delay)
+}
+
+func (this *tickerLimiter) Stop() {
+	if this.ticker != nil {
+		this.ticker.Stop()
+	}
+}
+
+// tokenBucket refills rate tokens per second up to burst tokens. A block takes a
+// token per tx or a token per block. A block larger than the burst waits for a full
+// bucket and takes the tokens it lacks from the next refills.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	perTx  bool
+	tokens float64
+	last   time.Time
+}
+
+// NewTxRateLimiter adds blocks at tps txs per second. A burst of 0 holds the txs of one second.
+func NewTxRateLimiter(tps float64, burst uint) RateLimiter {
+	return newTokenBucket(tps, burst, true)
+}
+
+// NewBlockRateLimiter adds bps blocks per second. A burst of 0 holds the blocks of one second.
+func NewBlockRateLimiter(bps float64, burst uint) RateLimiter {
+	return newTokenBucket(bps, burst, false)
+}
+
+func newTokenBucket(rate float64, burst uint, perTx bool) *tokenBucket {
+	size := float64(burst)
+	if burst == 0 {
+		size = math.Max(1, rate)
+	}
+	return &tokenBucket{
+		rate:   rate,
+		burst:  size,
+		perTx:  perTx,
+		tokens: size,
+		last:   time.Now(),
+	}
+}
+
+func (this *tokenBucket) refill() {
+	now := time.Now()
+	this.tokens = math.Min(this.burst, this.tokens+now.Sub(this.last).Seconds()*this.rate)
+	this.last = now
+}
+
+func (this *tokenBucket) Wait(ctx context.Context, txNum int, sourceTime uint32) error {
+	need := float64(1)
+	if this.perTx {
+		need = float64(txNum)
+	}
+	this.refill()
+	if lack := math.Min(need, this.burst) - this.tokens; lack > 0 {
+		err := sleepContext(ctx, time.Duration(lack/this.rate*float64(time.Second)))
+		if err != nil {
+			return err
+		}
+		this.refill()
+	}
+	this.tokens -= need
+	return nil
+}
+
+func (this *tokenBucket) Target() (float64, float64) {
+	if this.perTx {
+		return this.rate, 0
+	}
+	return 0, this.rate
+}
+
+func (this *tokenBucket) Stop() {
+}
+
+// cadenceLimiter replays the blocks at the intervals of their source block times divided by factor
+type cadenceLimiter struct {
+	factor    float64
+	start     time.Time
+	first     uint32 // source time of the first block
+	last      uint32 // source time of the last block
+	txs       uint64
+	blocks    uint64
+	hasSource bool
+}
+
+// NewCadenceLimiter replays the source blocks factor times as fast as they were produced
+func NewCadenceLimiter(factor float64) RateLimiter {
+	return &cadenceLimiter{factor: factor}
+}
+
+func (this *cadenceLimiter) Wait(ctx context.Context, txNum int, sourceTime uint32) error {
+	if !this.hasSource {
+		this.hasSource = true
+		this.start = time.Now()
+		this.first = sourceTime
+	}
+	if sourceTime > this.last {
+		this.last = sourceTime
+	}
+	this.txs += uint64(txNum)
+	this.blocks++
+	if sourceTime <= this.first {
+		return ctx.Err()
+	}
+	offset := float64(sourceTime-this.first) / this.factor * float64(time.Second)
+	return sleepContext(ctx, time.Until(this.start.Add(time.Duration(offset))))
+}
+
+// Target is the rates of the source blocks waited so far, sped up by the factor
+func (this *cadenceLimiter) Target() (float64, float64) {
+	if this.last <= this.first {
+		return 0, 0
+	}
+	span := float64(this.last-this.first) / this.factor
+	return float64(this.txs) / span, float64(this.blocks) / span
+}
+
+func (this *cadenceLimiter) Stop() {
+}
+
+// sleepContext sleeps for d, or until ctx is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// RateMeter measures the achieved rates of txs and blocks since it was created
+type RateMeter struct {
+	start  time.Time
+	txs    uint64
+	blocks uint64
+}
+
+func NewRateMeter() *RateMeter {
+	return &RateMeter{start: time.Now()}
+}
+
+func (this *RateMeter) Add(txNum int) {
+	this.txs += uint64(txNum)
+	this.blocks++
+}
+
+func (this *RateMeter) Rates() (tps, bps float64) {
+	elapsed := time.Since(this.start).Seconds()
+	if elapsed <= 0 {
+		return 0, 0
+	}
+	return float64(this.txs) / elapsed, float64(this.blocks) / elapsed
+}
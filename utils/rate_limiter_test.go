@@ -0,0 +1,119 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package utils
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// limiterWait is a block waited by a limiter test
+type limiterWait struct {
+	txNum      int
+	sourceTime uint32
+}
+
+// the waits are timed with a margin for slow test machines
+const limiterMargin = 30 * time.Millisecond
+
+func TestRateLimiterWait(t *testing.T) {
+	tests := []struct {
+		name    string
+		limiter func() RateLimiter
+		waits   []limiterWait
+		elapsed time.Duration // from the first wait to the end of the last one
+		tps     float64
+		bps     float64
+	}{
+		{"no delay", func() RateLimiter { return NewTickerLimiter(0) },
+			[]limiterWait{{5, 0}, {5, 0}}, 0, 0, 0},
+		{"ticker", func() RateLimiter { return NewTickerLimiter(50 * time.Millisecond) },
+			[]limiterWait{{5, 0}, {5, 0}, {5, 0}}, 150 * time.Millisecond, 0, 20},
+		// the full bucket of 10 txs passes at once, the next 5 txs wait 50ms
+		{"tx burst", func() RateLimiter { return NewTxRateLimiter(100, 10) },
+			[]limiterWait{{4, 0}, {6, 0}, {5, 0}}, 50 * time.Millisecond, 100, 0},
+		// the burst of 0 holds the txs of one second
+		{"tx default burst", func() RateLimiter { return NewTxRateLimiter(20, 0) },
+			[]limiterWait{{20, 0}, {2, 0}}, 100 * time.Millisecond, 20, 0},
+		// a block larger than the burst takes the tokens of the next refills
+		{"tx large block", func() RateLimiter { return NewTxRateLimiter(100, 10) },
+			[]limiterWait{{30, 0}, {1, 0}}, 210 * time.Millisecond, 100, 0},
+		{"blocks", func() RateLimiter { return NewBlockRateLimiter(20, 1) },
+			[]limiterWait{{100, 0}, {100, 0}, {100, 0}}, 100 * time.Millisecond, 0, 20},
+		// 2 seconds of source blocks replayed 10 times as fast
+		{"cadence", func() RateLimiter { return NewCadenceLimiter(10) },
+			[]limiterWait{{1, 1530000000}, {2, 1530000001}, {3, 1530000002}}, 200 * time.Millisecond, 30, 15},
+		// a block with an earlier or the same source time does not wait
+		{"cadence out of order", func() RateLimiter { return NewCadenceLimiter(10) },
+			[]limiterWait{{1, 1530000002}, {1, 1530000001}, {1, 1530000002}}, 0, 0, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limiter := test.limiter()
+			defer limiter.Stop()
+			start := time.Now()
+			for _, wait := range test.waits {
+				err := limiter.Wait(context.Background(), wait.txNum, wait.sourceTime)
+				if err != nil {
+					t.Fatalf("Wait error:%s", err)
+				}
+			}
+			elapsed := time.Since(start)
+			if elapsed < test.elapsed-limiterMargin || elapsed > test.elapsed+limiterMargin {
+				t.Errorf("waited %s, expected %s", elapsed, test.elapsed)
+			}
+			tps, bps := limiter.Target()
+			if tps != test.tps || bps != test.bps {
+				t.Errorf("target tps %.1f bps %.1f, expected %.1f %.1f", tps, bps, test.tps, test.bps)
+			}
+		})
+	}
+}
+
+func TestRateLimiterCancel(t *testing.T) {
+	limiters := map[string]RateLimiter{
+		"ticker":  NewTickerLimiter(time.Hour),
+		"tx":      NewTxRateLimiter(1, 1),
+		"block":   NewBlockRateLimiter(1, 1),
+		"cadence": NewCadenceLimiter(1),
+	}
+	for name, limiter := range limiters {
+		t.Run(name, func(t *testing.T) {
+			defer limiter.Stop()
+			// the first block of a bucket or a cadence passes at once
+			if name != "ticker" {
+				err := limiter.Wait(context.Background(), 1, 1530000000)
+				if err != nil {
+					t.Fatalf("Wait error:%s", err)
+				}
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+			start := time.Now()
+			err := limiter.Wait(ctx, 1, 1530003600)
+			if err != context.DeadlineExceeded {
+				t.Errorf("Wait returned %v, expected %v", err, context.DeadlineExceeded)
+			}
+			if elapsed := time.Since(start); elapsed > 20*time.Millisecond+limiterMargin {
+				t.Errorf("Wait returned after %s, expected 20ms", elapsed)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package utils
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// reasons of rejected txs besides the decode errors TX_ERR_PARSE, TX_ERR_HEX and TX_ERR_DESERIALIZE
+const (
+	REJECT_REASON_DUPLICATE = "duplicate" // the tx is in the ledger or earlier in the file
+	REJECT_REASON_LEDGER    = "ledger"    // the ledger failed to look up the tx
+	REJECT_REASON_VERIFY    = "verify"    // the tx fails the verification of a node
+	REJECT_REASON_EXECUTION = "execution" // the tx is packed but its execution failed
+
+	EXPORT_FORMAT_REJECT = "reject"
+)
+
+// RejectRecord is a line of a reject file. Raw is a tx line of the text export
+// format, so a reject file can be imported again to retry its txs.
+type RejectRecord struct {
+	SourceHeight uint32 `json:"SourceHeight"`
+	SourceTime   uint32 `json:"SourceTime,omitempty"`
+	Line         uint64 `json:"Line"`
+	TxHash       string `json:"TxHash,omitempty"`
+	Reason       string `json:"Reason"`
+	Desc         string `json:"Desc"`
+	Raw          string `json:"Raw"`
+}
+
+// RejectWriter writes one JSON record per line
+type RejectWriter struct {
+	file  *os.File
+	count uint64
+}
+
+func NewRejectWriter(fileName string) (*RejectWriter, error) {
+	file, err := os.OpenFile(fileName, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0664)
+	if err != nil {
+		return nil, fmt.Errorf("Open reject file:%s error:%s", fileName, err)
+	}
+	return &RejectWriter{file: file}, nil
+}
+
+func (this *RejectWriter) Write(record *RejectRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("json.Marshal RejectRecord error:%s", err)
+	}
+	// one write per record, so a crash leaves at most one torn line
+	_, err = this.file.Write(append(data, '\n'))
+	if err != nil {
+		return fmt.Errorf("write reject file error:%s", err)
+	}
+	this.count++
+	return nil
+}
+
+// Count is the number of records written
+func (this *RejectWriter) Count() uint64 {
+	return this.count
+}
+
+func (this *RejectWriter) Close() error {
+	return this.file.Close()
+}
+
+// rejectFileReader reads a reject file as an export file, the records of a source
+// block are returned as one block record
+type rejectFileReader struct {
+	*exportSource
+	reader *bufio.Reader
+	line   uint64
+	offset int64
+	next   *RejectRecord // record read ahead
+	size   int           // length of the line of next
+}
+
+func (this *rejectFileReader) Format() string {
+	return EXPORT_FORMAT_REJECT
+}
+
+func (this *rejectFileReader) Header() *ArchiveHeader {
+	return nil
+}
+
+func (this *rejectFileReader) Position() *ExportPosition {
+	if this.next == nil {
+		return &ExportPosition{Offset: this.offset, Line: this.line}
+	}
+	return &ExportPosition{Offset: this.offset - int64(this.size), Line: this.line - 1}
+}
+
+func (this *rejectFileReader) ReadBlock() (*ExportBlock, error) {
+	record := this.next
+	this.next = nil
+	if record == nil {
+		var err error
+		record, _, err = this.readRecord()
+		if err != nil {
+			return nil, err
+		}
+	}
+	block := &ExportBlock{Height: record.SourceHeight, Timestamp: record.SourceTime}
+	for {
+		block.Txs = append(block.Txs, decodeTxLine(record.Line, record.Raw))
+		block.TxNum++
+		next, size, err := this.readRecord()
+		if err == io.EOF {
+			return block, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if next.SourceHeight != block.Height {
+			this.next = next
+			this.size = size
+			return block, nil
+		}
+		record = next
+	}
+}
+
+func (this *rejectFileReader) readRecord() (*RejectRecord, int, error) {
+	line, err := this.reader.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return nil, 0, err
+	}
+	this.line++
+	this.offset += int64(len(line))
+	record := &RejectRecord{}
+	err = json.Unmarshal([]byte(strings.TrimSpace(line)), record)
+	if err != nil {
+		return nil, 0, fmt.Errorf("line %d: invalid reject record:%s", this.line, err)
+	}
+	return record, len(line), nil
+}
@@ -0,0 +1,107 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package utils
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRejectFileRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "txreplay-test")
+	if err != nil {
+		t.Fatalf("TempDir error:%s", err)
+	}
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "rejects.json")
+
+	blocks := newTestBlocks([]uint32{3, 5, 6}, []int{2, 1, 1})
+	var records []*RejectRecord
+	for _, block := range blocks {
+		for i, tx := range block.txs {
+			records = append(records, &RejectRecord{
+				SourceHeight: block.height,
+				SourceTime:   testBlockTime(block.height),
+				Line:         uint64(block.height*10) + uint64(i),
+				TxHash:       fmt.Sprintf("%x", tx.Hash()),
+				Reason:       REJECT_REASON_VERIFY,
+				Desc:         "verify failed",
+				Raw:          fmt.Sprintf("%x %x\n", tx.Hash(), tx.ToArray()),
+			})
+		}
+	}
+	// the writer appends, a file is continued by the next run
+	for _, part := range [][]*RejectRecord{records[:2], records[2:]} {
+		writer, err := NewRejectWriter(fileName)
+		if err != nil {
+			t.Fatalf("NewRejectWriter error:%s", err)
+		}
+		for _, record := range part {
+			err = writer.Write(record)
+			if err != nil {
+				t.Fatalf("Write error:%s", err)
+			}
+		}
+		if writer.Count() != uint64(len(part)) {
+			t.Errorf("count %d, expected %d", writer.Count(), len(part))
+		}
+		writer.Close()
+	}
+
+	file, err := os.Open(fileName)
+	if err != nil {
+		t.Fatalf("Open error:%s", err)
+	}
+	defer file.Close()
+	reader, err := NewExportReader(file)
+	if err != nil {
+		t.Fatalf("NewExportReader error:%s", err)
+	}
+	defer reader.Close()
+	if reader.Format() != EXPORT_FORMAT_REJECT {
+		t.Fatalf("format %s, expected %s", reader.Format(), EXPORT_FORMAT_REJECT)
+	}
+	// the records of a source block are read back as one block
+	err = checkTestBlocks(reader, blocks)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if _, err = reader.ReadBlock(); err != io.EOF {
+		t.Errorf("ReadBlock after the last record returned %v, expected EOF", err)
+	}
+}
+
+func TestRejectFileInvalidRecord(t *testing.T) {
+	file := writeTestFile(t, "{\"SourceHeight\":3,\"Line\":1,\"Raw\":\"xyz\"}\n{\"SourceHeight\":\n")
+	defer closeTestFile(file)
+	file.Seek(0, io.SeekStart)
+	reader, err := NewExportReader(file)
+	if err != nil {
+		t.Fatalf("NewExportReader error:%s", err)
+	}
+	defer reader.Close()
+	block, err := reader.ReadBlock()
+	if err == nil {
+		t.Fatalf("no error for a torn record after block %d", block.Height)
+	}
+}
@@ -0,0 +1,182 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/ontio/ontology/common"
+	"github.com/ontio/ontology/core/types"
+)
+
+// RestResponse is the response of the RESTful and the WebSocket servers of a node
+type RestResponse struct {
+	Id     interface{}     `json:"Id"`
+	Action string          `json:"Action"`
+	Desc   string          `json:"Desc"`
+	Error  int64           `json:"Error"`
+	Result json.RawMessage `json:"Result"`
+}
+
+// RestClient sends requests to the RESTful server of a node. It is safe for concurrent use.
+type RestClient struct {
+	addr   string
+	config RpcConfig
+	client *http.Client
+}
+
+// NewRestClient connects to the RESTful server at addr like http://127.0.0.1:20334
+func NewRestClient(addr string, config *RpcConfig) *RestClient {
+	return &RestClient{
+		addr:   addr,
+		config: *config,
+		client: &http.Client{Transport: rpcTransport},
+	}
+}
+
+func (this *RestClient) Addr() string {
+	return this.addr
+}
+
+// Get requests the path like /api/v1/block/height and returns the result. A retriable
+// error is retried as by RpcClient.
+func (this *RestClient) Get(ctx context.Context, path string) ([]byte, error) {
+	body, err := withRetries(ctx, &this.config, func() ([]byte, error) {
+		return this.get(ctx, path)
+	})
+	if err != nil {
+		return nil, err
+	}
+	restRsp := &RestResponse{}
+	err = json.Unmarshal(body, restRsp)
+	if err != nil {
+		return nil, fmt.Errorf("json.Unmarshal RestResponse:%s error:%s", body, err)
+	}
+	if restRsp.Error != 0 {
+		return nil, &RpcError{Code: restRsp.Error, Desc: restRsp.Desc}
+	}
+	return restRsp.Result, nil
+}
+
+func (this *RestClient) get(ctx context.Context, path string) ([]byte, error) {
+	ctx, cancel := withTimeout(ctx, &this.config)
+	defer cancel()
+	req, err := http.NewRequest(http.MethodGet, this.addr+path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("new http request error:%s", err)
+	}
+	resp, err := this.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read rest response body error:%s", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, &HttpStatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	return body, nil
+}
+
+// RestBlockSource gets blocks from the RESTful server of a node. Its requests are canceled
+// when the context it is created with is done.
+type RestBlockSource struct {
+	ctx    context.Context
+	client *RestClient
+}
+
+func NewRestBlockSource(ctx context.Context, client *RestClient) *RestBlockSource {
+	return &RestBlockSource{
+		ctx:    ctx,
+		client: client,
+	}
+}
+
+func (this *RestBlockSource) Name() string {
+	return this.client.Addr()
+}
+
+func (this *RestBlockSource) GetNetworkId() (uint32, error) {
+	data, err := this.client.Get(this.ctx, "/api/v1/networkid")
+	if err != nil {
+		return 0, err
+	}
+	networkId := uint32(0)
+	err = json.Unmarshal(data, &networkId)
+	if err != nil {
+		return 0, fmt.Errorf("json.Unmarshal:%s error:%s", data, err)
+	}
+	return networkId, nil
+}
+
+// GetBlockCount returns the current height + 1, as getblockcount of JSON-RPC
+func (this *RestBlockSource) GetBlockCount() (uint32, error) {
+	data, err := this.client.Get(this.ctx, "/api/v1/block/height")
+	if err != nil {
+		return 0, err
+	}
+	height := uint32(0)
+	err = json.Unmarshal(data, &height)
+	if err != nil {
+		return 0, fmt.Errorf("json.Unmarshal:%s error:%s", data, err)
+	}
+	return height + 1, nil
+}
+
+func (this *RestBlockSource) GetBlock(height uint32) (*types.Block, error) {
+	data, err := this.client.Get(this.ctx, fmt.Sprintf("/api/v1/block/details/height/%d?raw=1", height))
+	if err != nil {
+		return nil, fmt.Errorf("Get block:%d error:%s", height, err)
+	}
+	blockData, err := decodeBlockData(data)
+	if err != nil {
+		return nil, fmt.Errorf("Get block:%d error:%s", height, err)
+	}
+	block, err := deserializeBlock(blockData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read block at height %d err %v", height, err)
+	}
+	return block, nil
+}
+
+func (this *RestBlockSource) GetBlockByHash(hash common.Uint256) (*types.Block, error) {
+	data, err := this.client.Get(this.ctx, fmt.Sprintf("/api/v1/block/details/hash/%s?raw=1", hash.ToHexString()))
+	if err != nil {
+		return nil, fmt.Errorf("Get block:%s error:%s", hash.ToHexString(), err)
+	}
+	blockData, err := decodeBlockData(data)
+	if err != nil {
+		return nil, fmt.Errorf("Get block:%s error:%s", hash.ToHexString(), err)
+	}
+	block, err := deserializeBlock(blockData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read block %s err %v", hash.ToHexString(), err)
+	}
+	return block, nil
+}
+
+func (this *RestBlockSource) Close() error {
+	return nil
+}
@@ -0,0 +1,456 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"time"
+
+	"github.com/ontio/ontology/common"
+	"github.com/ontio/ontology/core/types"
+)
+
+const JSON_RPC_VERSION = "2.0"
+
+// the delay between retries doubles up to RPC_MAX_BACKOFF
+const RPC_MAX_BACKOFF = 30 * time.Second
+
+// JsonRpcRequest object in rpc
+type JsonRpcRequest struct {
+	Version string        `json:"jsonrpc"`
+	Id      string        `json:"id"`
+	Method  string        `json:"method"`
+	Params  []interface{} `json:"params"`
+}
+
+// JsonRpcResponse object response for JsonRpcRequest
+type JsonRpcResponse struct {
+	Id     interface{}     `json:"id"`
+	Error  int64           `json:"error"`
+	Desc   string          `json:"desc"`
+	Result json.RawMessage `json:"result"`
+}
+
+// RpcError is an error returned by the rpc server in JsonRpcResponse
+type RpcError struct {
+	Code int64
+	Desc string
+}
+
+func (this *RpcError) Error() string {
+	return fmt.Sprintf("error code:%d desc:%s", this.Code, this.Desc)
+}
+
+// ErrBatchUnsupported is returned by CallBatch when the rpc server does not answer a batch
+// request with an array of responses
+var ErrBatchUnsupported = errors.New("rpc server does not support batch requests")
+
+// HttpStatusError is a response of the rpc server with a status other than 200
+type HttpStatusError struct {
+	StatusCode int
+	Status     string
+}
+
+func (this *HttpStatusError) Error() string {
+	return fmt.Sprintf("http status:%s", this.Status)
+}
+
+// IsRetriable returns true for the errors that may go away if the request is sent again:
+// network errors, timeouts, 5xx responses and 429 Too Many Requests. An error the rpc
+// server returns in JsonRpcResponse is its answer, and is not retried.
+func IsRetriable(err error) bool {
+	switch e := err.(type) {
+	case *url.Error:
+		return true
+	case *HttpStatusError:
+		return e.StatusCode >= 500 || e.StatusCode == http.StatusTooManyRequests
+	}
+	return false
+}
+
+// rpcTransport keeps the connections to the rpc servers alive and shares them between clients
+var rpcTransport = &http.Transport{
+	Proxy: http.ProxyFromEnvironment,
+	DialContext: (&net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}).DialContext,
+	MaxIdleConns:        256,
+	MaxIdleConnsPerHost: 64,
+	IdleConnTimeout:     90 * time.Second,
+}
+
+// RpcConfig sets the timeout and the retries of the requests of an RpcClient
+type RpcConfig struct {
+	Timeout time.Duration // timeout of each attempt of a request, 0 means no timeout
+	Retries uint          // retries of a request after a retriable error
+	Backoff time.Duration // delay before the first retry, doubled for each retry
+}
+
+// RpcClient sends JSON-RPC requests to the rpc server of a node. It is safe for concurrent use.
+type RpcClient struct {
+	addr    string
+	config  RpcConfig
+	client  *http.Client
+	noBatch int32 // set once the server answers a batch request with something else than an array
+}
+
+func NewRpcClient(addr string, config *RpcConfig) *RpcClient {
+	return &RpcClient{
+		addr:   addr,
+		config: *config,
+		client: &http.Client{Transport: rpcTransport},
+	}
+}
+
+// Addr returns the address of the rpc server like http://127.0.0.1:20336
+func (this *RpcClient) Addr() string {
+	return this.addr
+}
+
+// Call sends a request and returns its result. A retriable error is retried with an
+// exponential backoff, the retries stop when ctx is done.
+func (this *RpcClient) Call(ctx context.Context, method string, params []interface{}) ([]byte, error) {
+	rpcReq := &JsonRpcRequest{
+		Version: JSON_RPC_VERSION,
+		Id:      "cli",
+		Method:  method,
+		Params:  params,
+	}
+	data, err := json.Marshal(rpcReq)
+	if err != nil {
+		return nil, fmt.Errorf("JsonRpcRequest json.Marsha error:%s", err)
+	}
+	body, err := this.send(ctx, data)
+	if err != nil {
+		return nil, err
+	}
+	rpcRsp := &JsonRpcResponse{}
+	err = json.Unmarshal(body, rpcRsp)
+	if err != nil {
+		return nil, fmt.Errorf("json.Unmarshal JsonRpcResponse:%s error:%s", body, err)
+	}
+	if rpcRsp.Error != 0 {
+		return nil, &RpcError{Code: rpcRsp.Error, Desc: rpcRsp.Desc}
+	}
+	return rpcRsp.Result, nil
+}
+
+// SupportsBatch returns false once the server answered a batch request with something else than an array
+func (this *RpcClient) SupportsBatch() bool {
+	return atomic.LoadInt32(&this.noBatch) == 0
+}
+
+// CallBatch sends the requests of a method with each of the params in one JSON-RPC batch
+// and returns the responses in the order of the params. It returns ErrBatchUnsupported,
+// and SupportsBatch turns false, if the server cannot answer batches.
+func (this *RpcClient) CallBatch(ctx context.Context, method string, paramsList [][]interface{}) ([]*JsonRpcResponse, error) {
+	rpcReqs := make([]*JsonRpcRequest, 0, len(paramsList))
+	for i, params := range paramsList {
+		rpcReqs = append(rpcReqs, &JsonRpcRequest{
+			Version: JSON_RPC_VERSION,
+			Id:      fmt.Sprintf("cli-%d", i),
+			Method:  method,
+			Params:  params,
+		})
+	}
+	data, err := json.Marshal(rpcReqs)
+	if err != nil {
+		return nil, fmt.Errorf("JsonRpcRequest json.Marsha error:%s", err)
+	}
+	body, err := this.send(ctx, data)
+	// 429 Too Many Requests is a temporary error of a server with batches, it is retried
+	if statusErr, ok := err.(*HttpStatusError); ok && statusErr.StatusCode >= 400 && statusErr.StatusCode < 500 &&
+		statusErr.StatusCode != http.StatusTooManyRequests {
+		this.disableBatch()
+		return nil, ErrBatchUnsupported
+	}
+	if err != nil {
+		return nil, err
+	}
+	// a server without batches fails to decode the array, and answers an error object or nothing
+	var rpcRsps []*JsonRpcResponse
+	err = json.Unmarshal(body, &rpcRsps)
+	if err != nil || len(rpcRsps) != len(rpcReqs) {
+		this.disableBatch()
+		return nil, ErrBatchUnsupported
+	}
+	// the responses of a batch may come in any order
+	byId := make(map[string]*JsonRpcResponse, len(rpcRsps))
+	for _, rpcRsp := range rpcRsps {
+		if rpcRsp != nil {
+			byId[fmt.Sprint(rpcRsp.Id)] = rpcRsp
+		}
+	}
+	results := make([]*JsonRpcResponse, 0, len(rpcReqs))
+	for _, rpcReq := range rpcReqs {
+		rpcRsp, ok := byId[rpcReq.Id]
+		if !ok {
+			this.disableBatch()
+			return nil, ErrBatchUnsupported
+		}
+		results = append(results, rpcRsp)
+	}
+	return results, nil
+}
+
+func (this *RpcClient) disableBatch() {
+	if atomic.CompareAndSwapInt32(&this.noBatch, 0, 1) {
+		fmt.Printf("Rpc server %s does not support batch requests, send single requests\n", this.addr)
+	}
+}
+
+// send posts the data and returns the response body
+func (this *RpcClient) send(ctx context.Context, data []byte) ([]byte, error) {
+	return withRetries(ctx, &this.config, func() ([]byte, error) {
+		return this.post(ctx, data)
+	})
+}
+
+// withRetries runs the request until it succeeds. A retriable error is retried up to
+// config.Retries times with an exponential backoff, the retries stop when ctx is done.
+func withRetries(ctx context.Context, config *RpcConfig, request func() ([]byte, error)) ([]byte, error) {
+	backoff := config.Backoff
+	for attempt := uint(0); ; attempt++ {
+		body, err := request()
+		if err == nil {
+			return body, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if attempt >= config.Retries || !IsRetriable(err) {
+			return nil, err
+		}
+		err = sleepContext(ctx, backoff)
+		if err != nil {
+			return nil, err
+		}
+		backoff *= 2
+		if backoff > RPC_MAX_BACKOFF {
+			backoff = RPC_MAX_BACKOFF
+		}
+	}
+}
+
+// withTimeout bounds an attempt of a request by config.Timeout
+func withTimeout(ctx context.Context, config *RpcConfig) (context.Context, context.CancelFunc) {
+	if config.Timeout > 0 {
+		return context.WithTimeout(ctx, config.Timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+func (this *RpcClient) post(ctx context.Context, data []byte) ([]byte, error) {
+	ctx, cancel := withTimeout(ctx, &this.config)
+	defer cancel()
+	req, err := http.NewRequest(http.MethodPost, this.addr, bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("new http request error:%s", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	// the *url.Error of a failed request is returned as it is for IsRetriable
+	resp, err := this.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// the body is read to the end, so the connection can be reused
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read rpc response body error:%s", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, &HttpStatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	return body, nil
+}
+
+func (this *RpcClient) GetBlockCount(ctx context.Context) (uint32, error) {
+	data, err := this.Call(ctx, "getblockcount", []interface{}{})
+	if err != nil {
+		return 0, err
+	}
+	num := uint32(0)
+	err = json.Unmarshal(data, &num)
+	if err != nil {
+		return 0, fmt.Errorf("json.Unmarshal:%s error:%s", data, err)
+	}
+	return num, nil
+}
+
+func (this *RpcClient) GetBlockData(ctx context.Context, hashOrHeight interface{}) ([]byte, error) {
+	data, err := this.Call(ctx, "getblock", []interface{}{hashOrHeight})
+	if err != nil {
+		return nil, err
+	}
+	return decodeBlockData(data)
+}
+
+// GetBlocksData gets the blocks at the heights with a batch request. The blocks the batch
+// fails to return, or all of them if the server does not support batches, are requested
+// one by one.
+func (this *RpcClient) GetBlocksData(ctx context.Context, heights []uint32) ([][]byte, error) {
+	blocksData := make([][]byte, len(heights))
+	if len(heights) > 1 && this.SupportsBatch() {
+		paramsList := make([][]interface{}, 0, len(heights))
+		for _, height := range heights {
+			paramsList = append(paramsList, []interface{}{height})
+		}
+		rpcRsps, err := this.CallBatch(ctx, "getblock", paramsList)
+		if err != nil && err != ErrBatchUnsupported {
+			return nil, err
+		}
+		for i, rpcRsp := range rpcRsps {
+			if rpcRsp.Error == 0 {
+				blocksData[i], _ = decodeBlockData(rpcRsp.Result)
+			}
+		}
+	}
+	for i, height := range heights {
+		if blocksData[i] != nil {
+			continue
+		}
+		blockData, err := this.GetBlockData(ctx, height)
+		if err != nil {
+			return nil, fmt.Errorf("Get block:%d error:%s", height, err)
+		}
+		blocksData[i] = blockData
+	}
+	return blocksData, nil
+}
+
+func decodeBlockData(data []byte) ([]byte, error) {
+	hexStr := ""
+	err := json.Unmarshal(data, &hexStr)
+	if err != nil {
+		return nil, fmt.Errorf("json.Unmarshal:%s error:%s", data, err)
+	}
+	blockData, err := hex.DecodeString(hexStr)
+	if err != nil {
+		return nil, fmt.Errorf("hex.DecodeString error:%s", err)
+	}
+	return blockData, nil
+}
+
+func (this *RpcClient) GetBlockHash(ctx context.Context, height uint32) (common.Uint256, error) {
+	data, err := this.Call(ctx, "getblockhash", []interface{}{height})
+	if err != nil {
+		return common.Uint256{}, err
+	}
+	hexStr := ""
+	err = json.Unmarshal(data, &hexStr)
+	if err != nil {
+		return common.Uint256{}, fmt.Errorf("json.Unmarshal:%s error:%s", data, err)
+	}
+	hash, err := common.Uint256FromHexString(hexStr)
+	if err != nil {
+		return common.Uint256{}, fmt.Errorf("invalid block hash:%s error:%s", hexStr, err)
+	}
+	return hash, nil
+}
+
+func (this *RpcClient) GetNetworkId(ctx context.Context) (uint32, error) {
+	data, err := this.Call(ctx, "getnetworkid", []interface{}{})
+	if err != nil {
+		return 0, err
+	}
+	networkId := uint32(0)
+	err = json.Unmarshal(data, &networkId)
+	if err != nil {
+		return 0, fmt.Errorf("json.Unmarshal:%s error:%s", data, err)
+	}
+	return networkId, nil
+}
+
+// SendRawTransaction sends a hex encoded tx
+func (this *RpcClient) SendRawTransaction(ctx context.Context, tx string) error {
+	_, err := this.Call(ctx, "sendrawtransaction", []interface{}{tx})
+	return err
+}
+
+// GetBlockHeightByTxHash returns the height of the block with the tx
+func (this *RpcClient) GetBlockHeightByTxHash(ctx context.Context, txHash string) (uint32, error) {
+	data, err := this.Call(ctx, "getblockheightbytxhash", []interface{}{txHash})
+	if err != nil {
+		return 0, err
+	}
+	height := uint32(0)
+	err = json.Unmarshal(data, &height)
+	if err != nil {
+		return 0, fmt.Errorf("json.Unmarshal:%s error:%s", data, err)
+	}
+	return height, nil
+}
+
+// GetHeader returns the header of the block at height. The rpc server has no request for
+// a header, so the block is downloaded, but its txs are not deserialized.
+func (this *RpcClient) GetHeader(ctx context.Context, height uint32) (*types.Header, error) {
+	blockData, err := this.GetBlockData(ctx, height)
+	if err != nil {
+		return nil, err
+	}
+	header := &types.Header{}
+	err = header.Deserialize(bytes.NewReader(blockData))
+	if err != nil {
+		return nil, fmt.Errorf("read header of block %d error:%s", height, err)
+	}
+	return header, nil
+}
+
+// GetBlockTime returns the timestamp of the block at height
+func (this *RpcClient) GetBlockTime(ctx context.Context, height uint32) (uint32, error) {
+	header, err := this.GetHeader(ctx, height)
+	if err != nil {
+		return 0, err
+	}
+	return header.Timestamp, nil
+}
+
+// SmartCodeEvent is the execution result of a tx returned by getsmartcodeevent
+type SmartCodeEvent struct {
+	TxHash      string `json:"TxHash"`
+	State       byte   `json:"State"`
+	GasConsumed uint64 `json:"GasConsumed"`
+}
+
+// GetSmartCodeEvent returns the execution result of a tx, nil if the node has none
+func (this *RpcClient) GetSmartCodeEvent(ctx context.Context, txHash string) (*SmartCodeEvent, error) {
+	data, err := this.Call(ctx, "getsmartcodeevent", []interface{}{txHash})
+	if err != nil {
+		return nil, err
+	}
+	var event *SmartCodeEvent
+	err = json.Unmarshal(data, &event)
+	if err != nil {
+		return nil, fmt.Errorf("json.Unmarshal:%s error:%s", data, err)
+	}
+	return event, nil
+}
@@ -0,0 +1,507 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package utils
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ontio/ontology/common"
+	"github.com/ontio/ontology/core/types"
+)
+
+// testRpcServer is a rpc server answering the requests, single or batched, with handle.
+// A handler returning nil fails the whole http request with status.
+type testRpcServer struct {
+	*httptest.Server
+	lock        sync.Mutex
+	posts       int    // http requests
+	requests    int    // rpc requests, a batch counts each of its requests
+	status      int    // status of the http requests handle fails, 500 if not set
+	batchStatus int    // status of every batch request if set
+	batchBody   string // answer to every batch request if set, like a server without batches
+	reversed    bool   // the responses of a batch are in the reverse order
+}
+
+func newTestRpcServer(handle func(req *JsonRpcRequest) *JsonRpcResponse) *testRpcServer {
+	server := &testRpcServer{}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		var reqs []*JsonRpcRequest
+		batch := len(body) > 0 && body[0] == '['
+		if batch {
+			json.Unmarshal(body, &reqs)
+		} else {
+			req := &JsonRpcRequest{}
+			json.Unmarshal(body, req)
+			reqs = append(reqs, req)
+		}
+		server.lock.Lock()
+		server.posts++
+		server.requests += len(reqs)
+		status := server.status
+		server.lock.Unlock()
+		if batch && server.batchStatus != 0 {
+			w.WriteHeader(server.batchStatus)
+			return
+		}
+		if batch && server.batchBody != "" {
+			w.Write([]byte(server.batchBody))
+			return
+		}
+		var rsps []*JsonRpcResponse
+		for _, req := range reqs {
+			rsp := handle(req)
+			if rsp == nil {
+				if status == 0 {
+					status = http.StatusInternalServerError
+				}
+				w.WriteHeader(status)
+				return
+			}
+			rsp.Id = req.Id
+			rsps = append(rsps, rsp)
+		}
+		if batch {
+			if server.reversed {
+				for i, j := 0, len(rsps)-1; i < j; i, j = i+1, j-1 {
+					rsps[i], rsps[j] = rsps[j], rsps[i]
+				}
+			}
+			json.NewEncoder(w).Encode(rsps)
+		} else {
+			json.NewEncoder(w).Encode(rsps[0])
+		}
+	}))
+	return server
+}
+
+func (this *testRpcServer) counts() (int, int) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	return this.posts, this.requests
+}
+
+// testRpcResult is the response of a request with result
+func testRpcResult(result interface{}) *JsonRpcResponse {
+	data, _ := json.Marshal(result)
+	return &JsonRpcResponse{Result: data}
+}
+
+// testChainHandler answers the requests of the blocks of chain
+func testChainHandler(chain *testChain) func(req *JsonRpcRequest) *JsonRpcResponse {
+	return func(req *JsonRpcRequest) *JsonRpcResponse {
+		var block *types.Block
+		var err error
+		switch req.Method {
+		case "getnetworkid":
+			return testRpcResult(1)
+		case "getblockcount":
+			return testRpcResult(len(chain.blocks))
+		case "getblock", "getblockhash":
+			switch param := req.Params[0].(type) {
+			case float64:
+				block, err = chain.GetBlock(uint32(param))
+			case string:
+				var hash common.Uint256
+				hash, err = common.Uint256FromHexString(param)
+				if err == nil {
+					block, err = chain.GetBlockByHash(hash)
+				}
+			}
+			if err != nil || block == nil {
+				return &JsonRpcResponse{Error: 44001, Desc: "UNKNOWN BLOCK"}
+			}
+		default:
+			return &JsonRpcResponse{Error: 42002, Desc: "INVALID METHOD"}
+		}
+		if req.Method == "getblockhash" {
+			hash := block.Hash()
+			return testRpcResult(hash.ToHexString())
+		}
+		return testRpcResult(hex.EncodeToString(block.ToArray()))
+	}
+}
+
+func TestIsRetriable(t *testing.T) {
+	tests := []struct {
+		err       error
+		retriable bool
+	}{
+		{&url.Error{Op: "Post", URL: "http://127.0.0.1:20336", Err: errors.New("connection refused")}, true},
+		{&HttpStatusError{StatusCode: 500, Status: "500 Internal Server Error"}, true},
+		{&HttpStatusError{StatusCode: 502, Status: "502 Bad Gateway"}, true},
+		{&HttpStatusError{StatusCode: 503, Status: "503 Service Unavailable"}, true},
+		{&HttpStatusError{StatusCode: 429, Status: "429 Too Many Requests"}, true},
+		{&HttpStatusError{StatusCode: 400, Status: "400 Bad Request"}, false},
+		{&HttpStatusError{StatusCode: 404, Status: "404 Not Found"}, false},
+		{&HttpStatusError{StatusCode: 413, Status: "413 Request Entity Too Large"}, false},
+		{&RpcError{Code: 43001, Desc: "INTERNAL ERROR"}, false},
+		{ErrBatchUnsupported, false},
+		{context.Canceled, false},
+		{errors.New("json.Unmarshal error"), false},
+	}
+	for _, test := range tests {
+		if retriable := IsRetriable(test.err); retriable != test.retriable {
+			t.Errorf("%s: retriable %v, expected %v", test.err, retriable, test.retriable)
+		}
+	}
+}
+
+func TestRpcClientRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int // status of the failed attempts
+		failures int // attempts failing before the server answers
+		retries  uint
+		posts    int
+		ok       bool
+	}{
+		{"no failure", 0, 0, 3, 1, true},
+		{"500 retried", 500, 2, 3, 3, true},
+		{"503 retried", 503, 1, 3, 2, true},
+		{"429 retried", 429, 3, 3, 4, true},
+		{"retries used up", 502, 5, 2, 3, false},
+		{"no retries", 500, 1, 0, 1, false},
+		{"400 not retried", 400, 1, 3, 1, false},
+		{"404 not retried", 404, 1, 3, 1, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var attempts int
+			server := newTestRpcServer(func(req *JsonRpcRequest) *JsonRpcResponse {
+				attempts++
+				if attempts <= test.failures {
+					return nil
+				}
+				return testRpcResult(7)
+			})
+			defer server.Close()
+			server.status = test.status
+			client := NewRpcClient(server.URL, &RpcConfig{Retries: test.retries, Backoff: time.Millisecond})
+			count, err := client.GetBlockCount(context.Background())
+			if (err == nil) != test.ok {
+				t.Fatalf("GetBlockCount error %v, expected ok %v", err, test.ok)
+			}
+			if err == nil && count != 7 {
+				t.Errorf("count %d, expected 7", count)
+			}
+			if err != nil {
+				if statusErr, ok := err.(*HttpStatusError); !ok || statusErr.StatusCode != test.status {
+					t.Errorf("error %v, expected status %d", err, test.status)
+				}
+			}
+			if posts, _ := server.counts(); posts != test.posts {
+				t.Errorf("%d attempts, expected %d", posts, test.posts)
+			}
+		})
+	}
+}
+
+func TestRpcClientRpcError(t *testing.T) {
+	server := newTestRpcServer(func(req *JsonRpcRequest) *JsonRpcResponse {
+		return &JsonRpcResponse{Error: 43001, Desc: "INTERNAL ERROR"}
+	})
+	defer server.Close()
+	client := NewRpcClient(server.URL, &RpcConfig{Retries: 3, Backoff: time.Millisecond})
+	_, err := client.GetBlockCount(context.Background())
+	if rpcErr, ok := err.(*RpcError); !ok || rpcErr.Code != 43001 {
+		t.Fatalf("error %v, expected rpc error 43001", err)
+	}
+	// the answer of the server is not retried
+	if posts, _ := server.counts(); posts != 1 {
+		t.Errorf("%d attempts, expected 1", posts)
+	}
+}
+
+func TestRpcClientNetworkError(t *testing.T) {
+	server := newTestRpcServer(func(req *JsonRpcRequest) *JsonRpcResponse {
+		return testRpcResult(7)
+	})
+	addr := server.URL
+	server.Close()
+	var attempts int
+	config := &RpcConfig{Retries: 2, Backoff: time.Millisecond}
+	_, err := withRetries(context.Background(), config, func() ([]byte, error) {
+		attempts++
+		return NewRpcClient(addr, config).post(context.Background(), []byte("{}"))
+	})
+	if _, ok := err.(*url.Error); !ok {
+		t.Fatalf("error %v, expected a *url.Error", err)
+	}
+	if attempts != 3 {
+		t.Errorf("%d attempts, expected 3", attempts)
+	}
+}
+
+func TestWithRetriesBackoff(t *testing.T) {
+	var times []time.Time
+	config := &RpcConfig{Retries: 3, Backoff: 10 * time.Millisecond}
+	_, err := withRetries(context.Background(), config, func() ([]byte, error) {
+		times = append(times, time.Now())
+		return nil, &HttpStatusError{StatusCode: 503, Status: "503 Service Unavailable"}
+	})
+	if err == nil || len(times) != 4 {
+		t.Fatalf("%d attempts error %v, expected 4 attempts and an error", len(times), err)
+	}
+	// the delay doubles from 10ms
+	for i := 1; i < len(times); i++ {
+		delay := times[i].Sub(times[i-1])
+		expected := config.Backoff << uint(i-1)
+		if delay < expected || delay > expected+limiterMargin {
+			t.Errorf("retry %d after %s, expected %s", i, delay, expected)
+		}
+	}
+}
+
+func TestWithRetriesCancel(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	var attempts int
+	start := time.Now()
+	_, err := withRetries(ctx, &RpcConfig{Retries: 10, Backoff: time.Hour}, func() ([]byte, error) {
+		attempts++
+		return nil, &HttpStatusError{StatusCode: 500, Status: "500 Internal Server Error"}
+	})
+	if err != context.DeadlineExceeded {
+		t.Errorf("error %v, expected %v", err, context.DeadlineExceeded)
+	}
+	if attempts != 1 || time.Since(start) > 20*time.Millisecond+limiterMargin {
+		t.Errorf("%d attempts in %s, expected 1 attempt until the deadline", attempts, time.Since(start))
+	}
+}
+
+func TestRpcClientTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := newTestRpcServer(func(req *JsonRpcRequest) *JsonRpcResponse {
+		<-release
+		return testRpcResult(7)
+	})
+	defer server.Close()
+	defer close(release)
+	client := NewRpcClient(server.URL, &RpcConfig{Timeout: 20 * time.Millisecond, Retries: 1, Backoff: time.Millisecond})
+	_, err := client.GetBlockCount(context.Background())
+	// a timed out attempt is a network error and retried
+	if _, ok := err.(*url.Error); !ok {
+		t.Fatalf("error %v, expected a *url.Error", err)
+	}
+	if posts, _ := server.counts(); posts != 2 {
+		t.Errorf("%d attempts, expected 2", posts)
+	}
+}
+
+func TestRpcClientBlocks(t *testing.T) {
+	chain := newTestChain(5)
+	server := newTestRpcServer(testChainHandler(chain))
+	defer server.Close()
+	client := NewRpcClient(server.URL, &RpcConfig{})
+	ctx := context.Background()
+	count, err := client.GetBlockCount(ctx)
+	if err != nil || count != 5 {
+		t.Fatalf("GetBlockCount returned %d error %v, expected 5", count, err)
+	}
+	hash, err := client.GetBlockHash(ctx, 3)
+	if err != nil || hash != chain.blocks[3].Hash() {
+		t.Fatalf("GetBlockHash returned %x error %v", hash, err)
+	}
+	for _, param := range []interface{}{uint32(3), hash.ToHexString()} {
+		data, err := client.GetBlockData(ctx, param)
+		if err != nil {
+			t.Fatalf("GetBlockData %v error:%s", param, err)
+		}
+		if hex.EncodeToString(data) != hex.EncodeToString(chain.blocks[3].ToArray()) {
+			t.Errorf("GetBlockData %v returned another block", param)
+		}
+	}
+	_, err = client.GetBlockData(ctx, uint32(9))
+	if rpcErr, ok := err.(*RpcError); !ok || rpcErr.Code != 44001 {
+		t.Errorf("error %v, expected rpc error 44001", err)
+	}
+}
+
+func TestRpcBlockSource(t *testing.T) {
+	chain := newTestChain(5)
+	server := newTestRpcServer(testChainHandler(chain))
+	defer server.Close()
+	source := NewRpcBlockSource(context.Background(), NewRpcClient(server.URL, &RpcConfig{}))
+	block, err := source.GetBlock(2)
+	if err != nil || block.Hash() != chain.blocks[2].Hash() {
+		t.Fatalf("GetBlock returned %v error %v", block, err)
+	}
+	header, err := source.GetHeader(3)
+	if err != nil || header.Hash() != chain.blocks[3].Hash() {
+		t.Fatalf("GetHeader returned %v error %v", header, err)
+	}
+	block, err = source.GetBlockByHash(chain.blocks[4].Hash())
+	if err != nil || block.Header.Height != 4 {
+		t.Fatalf("GetBlockByHash returned %v error %v", block, err)
+	}
+	_, err = source.GetBlock(5)
+	if err == nil {
+		t.Errorf("no error for a block over the chain")
+	}
+	if source.Name() != server.URL {
+		t.Errorf("name %s, expected %s", source.Name(), server.URL)
+	}
+}
+
+// checkTestBlocksData checks that blocksData are the blocks of chain at the heights
+func checkTestBlocksData(chain *testChain, heights []uint32, blocksData [][]byte) error {
+	if len(blocksData) != len(heights) {
+		return fmt.Errorf("%d blocks, expected %d", len(blocksData), len(heights))
+	}
+	for i, height := range heights {
+		block, err := deserializeBlock(blocksData[i])
+		if err != nil {
+			return fmt.Errorf("block %d: %s", height, err)
+		}
+		if block.Hash() != chain.blocks[height].Hash() {
+			return fmt.Errorf("block %d has height %d", height, block.Header.Height)
+		}
+	}
+	return nil
+}
+
+func TestCallBatch(t *testing.T) {
+	chain := newTestChain(10)
+	server := newTestRpcServer(testChainHandler(chain))
+	defer server.Close()
+	// the responses of a batch may come in any order
+	server.reversed = true
+	client := NewRpcClient(server.URL, &RpcConfig{})
+	heights := []uint32{3, 4, 5, 9}
+	blocksData, err := client.GetBlocksData(context.Background(), heights)
+	if err != nil {
+		t.Fatalf("GetBlocksData error:%s", err)
+	}
+	if err = checkTestBlocksData(chain, heights, blocksData); err != nil {
+		t.Fatalf("%s", err)
+	}
+	if posts, requests := server.counts(); posts != 1 || requests != 4 {
+		t.Errorf("%d http requests %d rpc requests, expected one batch of 4", posts, requests)
+	}
+	if !client.SupportsBatch() {
+		t.Errorf("batches disabled")
+	}
+}
+
+func TestCallBatchFallback(t *testing.T) {
+	heights := []uint32{3, 4, 5}
+	tests := []struct {
+		name        string
+		batchStatus int
+		batchBody   string
+	}{
+		{"error object", 0, `{"jsonrpc":"2.0","id":"","error":42001,"desc":"INVALID PARAMS"}`},
+		{"null", 0, "null"},
+		{"not json", 0, "404 page not found"},
+		{"fewer responses", 0, `[{"id":"cli-0","error":0,"result":""}]`},
+		{"unknown ids", 0, `[{"id":"a","error":0},{"id":"b","error":0},{"id":"c","error":0}]`},
+		{"400", http.StatusBadRequest, ""},
+		{"404", http.StatusNotFound, ""},
+		{"413", http.StatusRequestEntityTooLarge, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			chain := newTestChain(10)
+			server := newTestRpcServer(testChainHandler(chain))
+			defer server.Close()
+			server.batchStatus = test.batchStatus
+			server.batchBody = test.batchBody
+			client := NewRpcClient(server.URL, &RpcConfig{Retries: 2, Backoff: time.Millisecond})
+			_, err := client.CallBatch(context.Background(), "getblock", [][]interface{}{{3}, {4}, {5}})
+			if err != ErrBatchUnsupported {
+				t.Fatalf("CallBatch error %v, expected %v", err, ErrBatchUnsupported)
+			}
+			if client.SupportsBatch() {
+				t.Fatalf("batches still enabled")
+			}
+			// the blocks are requested one by one from now on
+			blocksData, err := client.GetBlocksData(context.Background(), heights)
+			if err != nil {
+				t.Fatalf("GetBlocksData error:%s", err)
+			}
+			if err = checkTestBlocksData(chain, heights, blocksData); err != nil {
+				t.Fatalf("%s", err)
+			}
+			if posts, _ := server.counts(); posts != 4 {
+				t.Errorf("%d http requests, expected the batch and 3 single requests", posts)
+			}
+		})
+	}
+}
+
+func TestCallBatchTooManyRequests(t *testing.T) {
+	chain := newTestChain(10)
+	server := newTestRpcServer(testChainHandler(chain))
+	defer server.Close()
+	server.batchStatus = http.StatusTooManyRequests
+	client := NewRpcClient(server.URL, &RpcConfig{Retries: 2, Backoff: time.Millisecond})
+	_, err := client.CallBatch(context.Background(), "getblock", [][]interface{}{{3}, {4}})
+	if statusErr, ok := err.(*HttpStatusError); !ok || statusErr.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("CallBatch error %v, expected status 429", err)
+	}
+	if posts, _ := server.counts(); posts != 3 {
+		t.Errorf("%d http requests, expected the batch and 2 retries", posts)
+	}
+	if !client.SupportsBatch() {
+		t.Fatalf("batches disabled by a temporary error")
+	}
+	// the batches go on once the server accepts them again
+	server.batchStatus = 0
+	heights := []uint32{3, 4}
+	blocksData, err := client.GetBlocksData(context.Background(), heights)
+	if err != nil {
+		t.Fatalf("GetBlocksData error:%s", err)
+	}
+	if err = checkTestBlocksData(chain, heights, blocksData); err != nil {
+		t.Fatalf("%s", err)
+	}
+	if posts, _ := server.counts(); posts != 4 {
+		t.Errorf("%d http requests, expected a batch after the retries", posts)
+	}
+}
+
+func TestGetBlocksDataMissingBlock(t *testing.T) {
+	chain := newTestChain(10)
+	server := newTestRpcServer(testChainHandler(chain))
+	defer server.Close()
+	client := NewRpcClient(server.URL, &RpcConfig{})
+	// the block the batch fails to return is asked again on its own
+	_, err := client.GetBlocksData(context.Background(), []uint32{8, 9, 10})
+	if err == nil {
+		t.Fatalf("no error for a block over the chain")
+	}
+	if posts, requests := server.counts(); posts != 2 || requests != 4 {
+		t.Errorf("%d http requests %d rpc requests, expected a batch of 3 and a single request", posts, requests)
+	}
+	if !client.SupportsBatch() {
+		t.Errorf("batches disabled by an error of a request in the batch")
+	}
+}
@@ -0,0 +1,309 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/ontio/ontology/common"
+	"github.com/ontio/ontology/core/payload"
+	"github.com/ontio/ontology/core/types"
+	nutils "github.com/ontio/ontology/smartcontract/service/native/utils"
+)
+
+const (
+	NATIVE_INVOKE_NAME = "Ontology.Native.Invoke"
+
+	opPush0     = 0x00
+	opPushBytes = 0x4b // the largest PUSHBYTES opcode
+	opPush1     = 0x51
+	opPush16    = 0x60
+	opAppCall   = 0x67
+	opSysCall   = 0x68
+	opTailCall  = 0x69
+)
+
+var nativeInvokeSuffix = append([]byte{opSysCall, byte(len(NATIVE_INVOKE_NAME))}, NATIVE_INVOKE_NAME...)
+
+var nativeContractNames = map[common.Address]string{
+	nutils.OntContractAddress:        "ont",
+	nutils.OngContractAddress:        "ong",
+	nutils.OntIDContractAddress:      "ontid",
+	nutils.ParamContractAddress:      "param",
+	nutils.AuthContractAddress:       "auth",
+	nutils.GovernanceContractAddress: "governance",
+}
+
+// InvokeTarget is the contract called by the code of an invoke tx
+type InvokeTarget struct {
+	Contract common.Address
+	Native   bool
+	Method   string // only known for native contracts
+}
+
+// NativeContractName returns the short name of a native contract, or its hex address
+func NativeContractName(contract common.Address) string {
+	if name, ok := nativeContractNames[contract]; ok {
+		return name
+	}
+	return contract.ToHexString()
+}
+
+// ParseInvokeCode finds the called contract at the end of an invoke code. Native calls
+// end with "push method, push address, push version, SYSCALL Ontology.Native.Invoke",
+// NeoVM calls end with "APPCALL address" or "TAILCALL address".
+func ParseInvokeCode(code []byte) (*InvokeTarget, bool) {
+	if bytes.HasSuffix(code, nativeInvokeSuffix) {
+		return parseNativeInvoke(code[:len(code)-len(nativeInvokeSuffix)])
+	}
+	if len(code) >= 21 && (code[len(code)-21] == opAppCall || code[len(code)-21] == opTailCall) {
+		contract, err := common.AddressParseFromBytes(code[len(code)-20:])
+		if err != nil {
+			return nil, false
+		}
+		return &InvokeTarget{Contract: contract}, true
+	}
+	return nil, false
+}
+
+func parseNativeInvoke(code []byte) (*InvokeTarget, bool) {
+	// version is pushed with a single opcode
+	if len(code) < 22 {
+		return nil, false
+	}
+	version := code[len(code)-1]
+	if version != opPush0 && (version < opPush1 || version > opPush16) {
+		return nil, false
+	}
+	code = code[:len(code)-1]
+	if code[len(code)-21] != 20 {
+		return nil, false
+	}
+	contract, err := common.AddressParseFromBytes(code[len(code)-20:])
+	if err != nil {
+		return nil, false
+	}
+	target := &InvokeTarget{Contract: contract, Native: true}
+
+	code = code[:len(code)-21]
+	for n := 1; n <= opPushBytes && n < len(code); n++ {
+		pos := len(code) - n - 1
+		if code[pos] == byte(n) && isMethodName(code[pos+1:]) {
+			target.Method = string(code[pos+1:])
+			break
+		}
+	}
+	return target, true
+}
+
+func isMethodName(name []byte) bool {
+	for _, c := range name {
+		if !(c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z') {
+			return false
+		}
+	}
+	return len(name) > 0
+}
+
+// TxTypeName returns the name of a tx type
+func TxTypeName(txType types.TransactionType) string {
+	switch txType {
+	case types.Deploy:
+		return "Deploy"
+	case types.Invoke:
+		return "Invoke"
+	}
+	return fmt.Sprintf("0x%02x", byte(txType))
+}
+
+// Distribution summarizes values like the gas prices of txs or the sizes of blocks
+type Distribution struct {
+	Min    uint64            `json:"Min"`
+	Max    uint64            `json:"Max"`
+	Avg    float64           `json:"Avg"`
+	P50    uint64            `json:"P50"`
+	P90    uint64            `json:"P90"`
+	P99    uint64            `json:"P99"`
+	values map[uint64]uint64 // value -> count
+	count  uint64
+	sum    float64
+}
+
+func newDistribution() *Distribution {
+	return &Distribution{values: make(map[uint64]uint64)}
+}
+
+func (this *Distribution) add(value uint64) {
+	if this.count == 0 || value < this.Min {
+		this.Min = value
+	}
+	if value > this.Max {
+		this.Max = value
+	}
+	this.values[value]++
+	this.count++
+	this.sum += float64(value)
+}
+
+func (this *Distribution) finish() {
+	if this.count == 0 {
+		return
+	}
+	this.Avg = this.sum / float64(this.count)
+	values := make([]uint64, 0, len(this.values))
+	for value := range this.values {
+		values = append(values, value)
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	percentiles := []struct {
+		rank   float64
+		result *uint64
+	}{{0.5, &this.P50}, {0.9, &this.P90}, {0.99, &this.P99}}
+	var seen uint64
+	next := 0
+	for _, value := range values {
+		seen += this.values[value]
+		for next < len(percentiles) && float64(seen) >= percentiles[next].rank*float64(this.count) {
+			*percentiles[next].result = value
+			next++
+		}
+	}
+}
+
+// GasRange holds the gas distributions of the txs in a block range
+type GasRange struct {
+	StartHeight uint32        `json:"StartHeight"`
+	EndHeight   uint32        `json:"EndHeight"`
+	Txs         uint64        `json:"Txs"`
+	GasPrice    *Distribution `json:"GasPrice"`
+	GasLimit    *Distribution `json:"GasLimit"`
+}
+
+// TxAnalysis counts the txs of an export file by type, contract, native method and payer
+type TxAnalysis struct {
+	Blocks        uint64            `json:"Blocks"`
+	Txs           uint64            `json:"Txs"`
+	FirstHeight   uint32            `json:"FirstHeight"`
+	LastHeight    uint32            `json:"LastHeight"`
+	TxTypes       map[string]uint64 `json:"TxTypes"`
+	Contracts     map[string]uint64 `json:"Contracts"`
+	NativeMethods map[string]uint64 `json:"NativeMethods"`
+	Payers        map[string]uint64 `json:"Payers"`
+	Unparsed      uint64            `json:"UnparsedInvokeCodes"`
+	GasRanges     []*GasRange       `json:"GasRanges"`
+	rangeSize     uint32
+	ranges        map[uint32]*GasRange
+}
+
+func NewTxAnalysis(rangeSize uint32) *TxAnalysis {
+	if rangeSize == 0 {
+		rangeSize = 1
+	}
+	return &TxAnalysis{
+		TxTypes:       make(map[string]uint64),
+		Contracts:     make(map[string]uint64),
+		NativeMethods: make(map[string]uint64),
+		Payers:        make(map[string]uint64),
+		rangeSize:     rangeSize,
+		ranges:        make(map[uint32]*GasRange),
+	}
+}
+
+func (this *TxAnalysis) AddBlock(height uint32) {
+	if this.Blocks == 0 || height < this.FirstHeight {
+		this.FirstHeight = height
+	}
+	if height > this.LastHeight {
+		this.LastHeight = height
+	}
+	this.Blocks++
+}
+
+func (this *TxAnalysis) AddTx(height uint32, tx *types.Transaction) {
+	this.Txs++
+	this.TxTypes[TxTypeName(tx.TxType)]++
+	this.Payers[tx.Payer.ToBase58()]++
+	if invoke, ok := tx.Payload.(*payload.InvokeCode); ok {
+		target, ok := ParseInvokeCode(invoke.Code)
+		if !ok {
+			this.Unparsed++
+		} else if target.Native {
+			name := NativeContractName(target.Contract)
+			this.Contracts[name]++
+			method := target.Method
+			if method == "" {
+				method = "<unknown>"
+			}
+			this.NativeMethods[name+"."+method]++
+		} else {
+			this.Contracts[target.Contract.ToHexString()]++
+		}
+	}
+
+	start := height / this.rangeSize * this.rangeSize
+	gasRange, ok := this.ranges[start]
+	if !ok {
+		gasRange = &GasRange{
+			StartHeight: start,
+			EndHeight:   start + this.rangeSize - 1,
+			GasPrice:    newDistribution(),
+			GasLimit:    newDistribution(),
+		}
+		this.ranges[start] = gasRange
+	}
+	gasRange.Txs++
+	gasRange.GasPrice.add(tx.GasPrice)
+	gasRange.GasLimit.add(tx.GasLimit)
+}
+
+// Finish computes the gas distributions, call it after the last tx
+func (this *TxAnalysis) Finish() {
+	this.GasRanges = make([]*GasRange, 0, len(this.ranges))
+	for _, gasRange := range this.ranges {
+		gasRange.GasPrice.finish()
+		gasRange.GasLimit.finish()
+		this.GasRanges = append(this.GasRanges, gasRange)
+	}
+	sort.Slice(this.GasRanges, func(i, j int) bool {
+		return this.GasRanges[i].StartHeight < this.GasRanges[j].StartHeight
+	})
+}
+
+// CountEntry is a key of a count map with its count
+type CountEntry struct {
+	Key   string
+	Count uint64
+}
+
+// SortCounts sorts a count map by count descending
+func SortCounts(counts map[string]uint64) []*CountEntry {
+	entries := make([]*CountEntry, 0, len(counts))
+	for key, count := range counts {
+		entries = append(entries, &CountEntry{Key: key, Count: count})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Count != entries[j].Count {
+			return entries[i].Count > entries[j].Count
+		}
+		return entries[i].Key < entries[j].Key
+	})
+	return entries
+}
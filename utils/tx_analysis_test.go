@@ -0,0 +1,129 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package utils
+
+import (
+	"testing"
+
+	cutils "github.com/ontio/ontology/cmd/utils"
+	"github.com/ontio/ontology/common"
+	nutils "github.com/ontio/ontology/smartcontract/service/native/utils"
+)
+
+func TestParseInvokeCode(t *testing.T) {
+	var from, to, contract common.Address
+	for i := range from {
+		from[i], to[i], contract[i] = byte(i), byte(i+20), byte(i+40)
+	}
+	native := func(contract common.Address, version byte, method string, params ...interface{}) []byte {
+		code, err := cutils.BuildNativeInvokeCode(contract, version, method, params)
+		if err != nil {
+			t.Fatalf("BuildNativeInvokeCode %s error:%s", method, err)
+		}
+		return code
+	}
+	withVersion := func(code []byte, version byte) []byte {
+		code = append([]byte{}, code...)
+		code[len(code)-len(nativeInvokeSuffix)-1] = version
+		return code
+	}
+	transfer := native(nutils.OntContractAddress, 0, "transfer", from, to, "100")
+	tests := []struct {
+		name   string
+		code   []byte
+		target *InvokeTarget
+	}{
+		{"ont transfer", transfer, &InvokeTarget{Contract: nutils.OntContractAddress, Native: true, Method: "transfer"}},
+		{"ong transferFrom", native(nutils.OngContractAddress, 0, "transferFrom", from, from, to, "1"),
+			&InvokeTarget{Contract: nutils.OngContractAddress, Native: true, Method: "transferFrom"}},
+		{"governance without params", native(nutils.GovernanceContractAddress, 0, "commitDpos"),
+			&InvokeTarget{Contract: nutils.GovernanceContractAddress, Native: true, Method: "commitDpos"}},
+		{"version 1", native(nutils.ParamContractAddress, 1, "getGlobalParam", []byte("gasPrice")),
+			&InvokeTarget{Contract: nutils.ParamContractAddress, Native: true, Method: "getGlobalParam"}},
+		{"version 16", withVersion(transfer, opPush16),
+			&InvokeTarget{Contract: nutils.OntContractAddress, Native: true, Method: "transfer"}},
+		// the contract is known, the method is not
+		{"invalid method name", native(nutils.OntContractAddress, 0, "bad-name", from),
+			&InvokeTarget{Contract: nutils.OntContractAddress, Native: true}},
+		{"invalid version", withVersion(transfer, opPush16+1), nil},
+		{"native suffix only", nativeInvokeSuffix, nil},
+		{"appcall", append([]byte{0x00, 0xc1, opAppCall}, contract[:]...), &InvokeTarget{Contract: contract}},
+		{"tailcall", append([]byte{0x00, 0xc1, opTailCall}, contract[:]...), &InvokeTarget{Contract: contract}},
+		{"short appcall", append([]byte{opAppCall}, contract[:19]...), nil},
+		{"no call", []byte{opPush1, opPush1}, nil},
+		{"empty", nil, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			target, ok := ParseInvokeCode(test.code)
+			if ok != (test.target != nil) {
+				t.Fatalf("parsed %v, expected %v", ok, test.target != nil)
+			}
+			if ok && *target != *test.target {
+				t.Errorf("target %+v, expected %+v", *target, *test.target)
+			}
+		})
+	}
+}
+
+// distributionSummary is the comparable part of a Distribution
+type distributionSummary struct {
+	Min, Max      uint64
+	Avg           float64
+	P50, P90, P99 uint64
+}
+
+func TestDistribution(t *testing.T) {
+	oneToHundred := make([]uint64, 0, 100)
+	for i := uint64(100); i > 0; i-- {
+		oneToHundred = append(oneToHundred, i)
+	}
+	tests := []struct {
+		name         string
+		values       []uint64
+		distribution distributionSummary
+	}{
+		{"empty", nil, distributionSummary{}},
+		{"one value", []uint64{7}, distributionSummary{Min: 7, Max: 7, Avg: 7, P50: 7, P90: 7, P99: 7}},
+		{"unordered", []uint64{5, 3, 9, 3}, distributionSummary{Min: 3, Max: 9, Avg: 5, P50: 3, P90: 9, P99: 9}},
+		{"outlier", []uint64{1, 1, 1, 100}, distributionSummary{Min: 1, Max: 100, Avg: 25.75, P50: 1, P90: 100, P99: 100}},
+		{"one to hundred", oneToHundred, distributionSummary{Min: 1, Max: 100, Avg: 50.5, P50: 50, P90: 90, P99: 99}},
+		{"zeros", []uint64{0, 0, 0, 0, 0, 0, 0, 0, 0, 8}, distributionSummary{Min: 0, Max: 8, Avg: 0.8, P50: 0, P90: 0, P99: 8}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			distribution := newDistribution()
+			for _, value := range test.values {
+				distribution.add(value)
+			}
+			distribution.finish()
+			result := distributionSummary{
+				Min: distribution.Min,
+				Max: distribution.Max,
+				Avg: distribution.Avg,
+				P50: distribution.P50,
+				P90: distribution.P90,
+				P99: distribution.P99,
+			}
+			if result != test.distribution {
+				t.Errorf("distribution %+v, expected %+v", result, test.distribution)
+			}
+		})
+	}
+}
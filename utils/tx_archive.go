@@ -0,0 +1,440 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+
+	"github.com/ontio/ontology/common"
+	"github.com/ontio/ontology/common/serialization"
+	"github.com/ontio/ontology/core/types"
+)
+
+// Binary tx archive layout, integers are little endian:
+//
+//	header:  magic(8) | version(4) | length(4) | header fields | crc32(4)
+//	block:   0x01 | height(4) | tx num(4) | timestamp(4) | length(4) | var bytes txs | crc32(4)
+//	trailer: 0x02 | block count(8) | tx count(8) | first height(4) | last height(4) | crc32(4)
+//
+// The crc32 of a record covers every byte of the record before it. Version 1 block
+// records have no timestamp.
+const (
+	TX_ARCHIVE_MAGIC   = "ONTTXARC"
+	TX_ARCHIVE_VERSION = 2
+
+	ARCHIVE_RECORD_BLOCK   = byte(0x01)
+	ARCHIVE_RECORD_TRAILER = byte(0x02)
+
+	archiveTrailerLen      = 1 + 8 + 8 + 4 + 4
+	maxArchiveRecordLength = 256 * 1024 * 1024
+)
+
+// ArchiveHeader describes where and when a binary archive was exported
+type ArchiveHeader struct {
+	Version     uint32
+	NetworkId   uint32
+	GenesisHash common.Uint256 // identifies the source chain
+	Source      string         // node the blocks were exported from
+	StartHeight uint32
+	EndHeight   uint32 // the end block is not included
+	CreateTime  uint64 // unix seconds
+}
+
+// ArchiveTrailer holds the totals of the block records in a binary archive
+type ArchiveTrailer struct {
+	BlockCount  uint64
+	TxCount     uint64
+	FirstHeight uint32
+	LastHeight  uint32
+}
+
+func (this *ArchiveTrailer) add(height uint32, txNum int) {
+	if this.BlockCount == 0 {
+		this.FirstHeight = height
+	}
+	this.BlockCount++
+	this.TxCount += uint64(txNum)
+	this.LastHeight = height
+}
+
+// archiveBlockHeadLen is the length of a block record before the txs
+func archiveBlockHeadLen(version uint32) int64 {
+	if version == 1 {
+		return 1 + 4 + 4 + 4
+	}
+	return 1 + 4 + 4 + 4 + 4
+}
+
+// WriteArchiveHeader writes the header of a new archive in TX_ARCHIVE_VERSION
+func WriteArchiveHeader(w io.Writer, header *ArchiveHeader) error {
+	buf := bytes.NewBuffer(nil)
+	serialization.WriteUint32(buf, header.NetworkId)
+	buf.Write(header.GenesisHash[:])
+	serialization.WriteString(buf, header.Source)
+	serialization.WriteUint32(buf, header.StartHeight)
+	serialization.WriteUint32(buf, header.EndHeight)
+	serialization.WriteUint64(buf, header.CreateTime)
+
+	head := bytes.NewBuffer(nil)
+	head.WriteString(TX_ARCHIVE_MAGIC)
+	serialization.WriteUint32(head, TX_ARCHIVE_VERSION)
+	serialization.WriteUint32(head, uint32(buf.Len()))
+	head.Write(buf.Bytes())
+	checksum := crc32.ChecksumIEEE(head.Bytes())
+	serialization.WriteUint32(head, checksum)
+	_, err := w.Write(head.Bytes())
+	if err != nil {
+		return fmt.Errorf("write archive header error:%s", err)
+	}
+	return nil
+}
+
+func ReadArchiveHeader(r io.Reader) (*ArchiveHeader, error) {
+	head := make([]byte, len(TX_ARCHIVE_MAGIC)+4+4)
+	_, err := io.ReadFull(r, head)
+	if err != nil {
+		return nil, fmt.Errorf("read archive header error:%s", err)
+	}
+	if string(head[:len(TX_ARCHIVE_MAGIC)]) != TX_ARCHIVE_MAGIC {
+		return nil, fmt.Errorf("not a tx archive")
+	}
+	reader := bytes.NewReader(head[len(TX_ARCHIVE_MAGIC):])
+	version, _ := serialization.ReadUint32(reader)
+	length, _ := serialization.ReadUint32(reader)
+	if version == 0 || version > TX_ARCHIVE_VERSION {
+		return nil, fmt.Errorf("unsupported tx archive version %d", version)
+	}
+	if length > maxArchiveRecordLength {
+		return nil, fmt.Errorf("invalid archive header length %d", length)
+	}
+	fields := make([]byte, length+4)
+	_, err = io.ReadFull(r, fields)
+	if err != nil {
+		return nil, fmt.Errorf("read archive header error:%s", err)
+	}
+	checksum := crc32.Update(crc32.ChecksumIEEE(head), crc32.IEEETable, fields[:length])
+	expected, _ := serialization.ReadUint32(bytes.NewReader(fields[length:]))
+	if checksum != expected {
+		return nil, fmt.Errorf("archive header checksum mismatch")
+	}
+
+	header := &ArchiveHeader{Version: version}
+	reader = bytes.NewReader(fields[:length])
+	if header.NetworkId, err = serialization.ReadUint32(reader); err != nil {
+		return nil, fmt.Errorf("read archive network id error:%s", err)
+	}
+	if _, err = io.ReadFull(reader, header.GenesisHash[:]); err != nil {
+		return nil, fmt.Errorf("read archive genesis hash error:%s", err)
+	}
+	if header.Source, err = serialization.ReadString(reader); err != nil {
+		return nil, fmt.Errorf("read archive source error:%s", err)
+	}
+	if header.StartHeight, err = serialization.ReadUint32(reader); err != nil {
+		return nil, fmt.Errorf("read archive start height error:%s", err)
+	}
+	if header.EndHeight, err = serialization.ReadUint32(reader); err != nil {
+		return nil, fmt.Errorf("read archive end height error:%s", err)
+	}
+	if header.CreateTime, err = serialization.ReadUint64(reader); err != nil {
+		return nil, fmt.Errorf("read archive create time error:%s", err)
+	}
+	return header, nil
+}
+
+type archiveWriter struct {
+	writer  *bufio.Writer
+	version uint32
+	trailer *ArchiveTrailer
+}
+
+// NewArchiveWriter writes block records of version after the archive header. trailer holds
+// the totals of the records already in the archive when an export is resumed.
+func NewArchiveWriter(w io.Writer, version uint32, trailer *ArchiveTrailer) ExportWriter {
+	if trailer == nil {
+		trailer = &ArchiveTrailer{}
+	}
+	return &archiveWriter{
+		writer:  bufio.NewWriter(w),
+		version: version,
+		trailer: trailer,
+	}
+}
+
+func (this *archiveWriter) WriteBlock(header *types.Header, txs []*types.Transaction) error {
+	payload := bytes.NewBuffer(nil)
+	for _, tx := range txs {
+		err := serialization.WriteVarBytes(payload, tx.ToArray())
+		if err != nil {
+			return fmt.Errorf("failed to write tx data %x at block height %d", tx.Hash(), header.Height)
+		}
+	}
+	head := bytes.NewBuffer(make([]byte, 0, archiveBlockHeadLen(this.version)))
+	head.WriteByte(ARCHIVE_RECORD_BLOCK)
+	serialization.WriteUint32(head, header.Height)
+	serialization.WriteUint32(head, uint32(len(txs)))
+	if this.version > 1 {
+		serialization.WriteUint32(head, header.Timestamp)
+	}
+	serialization.WriteUint32(head, uint32(payload.Len()))
+	checksum := crc32.Update(crc32.ChecksumIEEE(head.Bytes()), crc32.IEEETable, payload.Bytes())
+
+	_, err := this.writer.Write(head.Bytes())
+	if err == nil {
+		_, err = this.writer.Write(payload.Bytes())
+	}
+	if err == nil {
+		err = serialization.WriteUint32(this.writer, checksum)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write block record at block height %d error:%s", header.Height, err)
+	}
+	this.trailer.add(header.Height, len(txs))
+	return nil
+}
+
+func (this *archiveWriter) Flush() error {
+	return this.writer.Flush()
+}
+
+func (this *archiveWriter) Close() error {
+	buf := bytes.NewBuffer(make([]byte, 0, archiveTrailerLen+4))
+	buf.WriteByte(ARCHIVE_RECORD_TRAILER)
+	serialization.WriteUint64(buf, this.trailer.BlockCount)
+	serialization.WriteUint64(buf, this.trailer.TxCount)
+	serialization.WriteUint32(buf, this.trailer.FirstHeight)
+	serialization.WriteUint32(buf, this.trailer.LastHeight)
+	serialization.WriteUint32(buf, crc32.ChecksumIEEE(buf.Bytes()))
+	_, err := this.writer.Write(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("write archive trailer error:%s", err)
+	}
+	return this.writer.Flush()
+}
+
+type archiveReader struct {
+	*exportSource
+	reader  *countingReader
+	header  *ArchiveHeader
+	trailer *ArchiveTrailer
+	txIndex uint64
+}
+
+func newArchiveReader(r io.Reader, source *exportSource) (*archiveReader, error) {
+	reader := &countingReader{reader: r}
+	header, err := ReadArchiveHeader(reader)
+	if err != nil {
+		return nil, err
+	}
+	return &archiveReader{
+		exportSource: source,
+		reader:       reader,
+		header:       header,
+		trailer:      &ArchiveTrailer{},
+	}, nil
+}
+
+func (this *archiveReader) Format() string {
+	return EXPORT_FORMAT_BINARY
+}
+
+func (this *archiveReader) Header() *ArchiveHeader {
+	return this.header
+}
+
+func (this *archiveReader) Position() *ExportPosition {
+	return &ExportPosition{Offset: this.reader.count, Line: this.txIndex, Trailer: *this.trailer}
+}
+
+func (this *archiveReader) ReadBlock() (*ExportBlock, error) {
+	recordType := make([]byte, 1)
+	_, err := io.ReadFull(this.reader, recordType)
+	if err == io.EOF {
+		return nil, fmt.Errorf("archive is truncated after %d blocks, trailer is missing", this.trailer.BlockCount)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read archive record error:%s", err)
+	}
+	switch recordType[0] {
+	case ARCHIVE_RECORD_BLOCK:
+		return this.readBlock()
+	case ARCHIVE_RECORD_TRAILER:
+		err = this.readTrailer()
+		if err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+	return nil, fmt.Errorf("unknown archive record type %d after block %d", recordType[0], this.trailer.LastHeight)
+}
+
+func (this *archiveReader) readBlock() (*ExportBlock, error) {
+	head := make([]byte, archiveBlockHeadLen(this.header.Version))
+	head[0] = ARCHIVE_RECORD_BLOCK
+	_, err := io.ReadFull(this.reader, head[1:])
+	if err != nil {
+		return nil, fmt.Errorf("read block record error:%s", err)
+	}
+	reader := bytes.NewReader(head[1:])
+	height, _ := serialization.ReadUint32(reader)
+	txNum, _ := serialization.ReadUint32(reader)
+	var timestamp uint32
+	if this.header.Version > 1 {
+		timestamp, _ = serialization.ReadUint32(reader)
+	}
+	length, _ := serialization.ReadUint32(reader)
+	if length > maxArchiveRecordLength {
+		return nil, fmt.Errorf("invalid record length %d at block height %d", length, height)
+	}
+	payload := make([]byte, length+4)
+	_, err = io.ReadFull(this.reader, payload)
+	if err != nil {
+		return nil, fmt.Errorf("read block record at block height %d error:%s", height, err)
+	}
+	checksum := crc32.Update(crc32.ChecksumIEEE(head), crc32.IEEETable, payload[:length])
+	expected, _ := serialization.ReadUint32(bytes.NewReader(payload[length:]))
+	if checksum != expected {
+		return nil, fmt.Errorf("checksum mismatch at block height %d", height)
+	}
+
+	block := &ExportBlock{
+		Height:    height,
+		Timestamp: timestamp,
+		TxNum:     int(txNum),
+		Txs:       make([]*ExportTx, 0, txNum),
+	}
+	reader = bytes.NewReader(payload[:length])
+	for reader.Len() > 0 {
+		data, err := serialization.ReadVarBytes(reader)
+		if err != nil {
+			return nil, fmt.Errorf("read tx data at block height %d error:%s", height, err)
+		}
+		this.txIndex++
+		etx := &ExportTx{Line: this.txIndex}
+		etx.decode(data)
+		if etx.Tx != nil {
+			etx.Hash = fmt.Sprintf("%x", etx.Tx.Hash())
+		}
+		// the same tx line as a text export, the hash is left empty if the tx cannot be decoded
+		etx.Raw = fmt.Sprintf("%s %x\n", etx.Hash, data)
+		block.Txs = append(block.Txs, etx)
+	}
+	this.trailer.add(height, len(block.Txs))
+	return block, nil
+}
+
+func (this *archiveReader) readTrailer() error {
+	buf := make([]byte, archiveTrailerLen+4)
+	buf[0] = ARCHIVE_RECORD_TRAILER
+	_, err := io.ReadFull(this.reader, buf[1:])
+	if err != nil {
+		return fmt.Errorf("read archive trailer error:%s", err)
+	}
+	reader := bytes.NewReader(buf[1:])
+	trailer := &ArchiveTrailer{}
+	trailer.BlockCount, _ = serialization.ReadUint64(reader)
+	trailer.TxCount, _ = serialization.ReadUint64(reader)
+	trailer.FirstHeight, _ = serialization.ReadUint32(reader)
+	trailer.LastHeight, _ = serialization.ReadUint32(reader)
+	expected, _ := serialization.ReadUint32(reader)
+	if crc32.ChecksumIEEE(buf[:archiveTrailerLen]) != expected {
+		return fmt.Errorf("archive trailer checksum mismatch")
+	}
+	if *trailer != *this.trailer {
+		return fmt.Errorf("archive trailer mismatch, trailer has %d blocks %d txs, archive has %d blocks %d txs",
+			trailer.BlockCount, trailer.TxCount, this.trailer.BlockCount, this.trailer.TxCount)
+	}
+	return nil
+}
+
+// FindArchiveTail walks the block records of a binary archive and finds the end of
+// the last complete one whose checksum matches. It returns the totals of the complete records for the new trailer.
+func FindArchiveTail(file *os.File) (*ExportTail, *ArchiveTrailer, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, nil, fmt.Errorf("stat archive error:%s", err)
+	}
+	size := info.Size()
+	section := io.NewSectionReader(file, 0, size)
+	header, err := ReadArchiveHeader(section)
+	if err != nil {
+		return nil, nil, err
+	}
+	offset, err := section.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, nil, fmt.Errorf("seek archive error:%s", err)
+	}
+
+	tail := &ExportTail{Offset: offset, Version: header.Version}
+	trailer := &ArchiveTrailer{}
+	headLen := archiveBlockHeadLen(header.Version)
+	head := make([]byte, headLen)
+	for offset+headLen <= size {
+		_, err = file.ReadAt(head, offset)
+		if err != nil {
+			return nil, nil, fmt.Errorf("read archive at offset %d error:%s", offset, err)
+		}
+		if head[0] != ARCHIVE_RECORD_BLOCK {
+			// a trailer or garbage, new records are written over it
+			break
+		}
+		reader := bytes.NewReader(head[1:])
+		height, _ := serialization.ReadUint32(reader)
+		txNum, _ := serialization.ReadUint32(reader)
+		if header.Version > 1 {
+			serialization.ReadUint32(reader)
+		}
+		length, _ := serialization.ReadUint32(reader)
+		end := offset + headLen + int64(length) + 4
+		if length > maxArchiveRecordLength || end > size {
+			break
+		}
+		// a record with an intact length but a torn or corrupted body ends the archive too
+		payload := make([]byte, length+4)
+		_, err = file.ReadAt(payload, offset+headLen)
+		if err != nil {
+			return nil, nil, fmt.Errorf("read archive at offset %d error:%s", offset+headLen, err)
+		}
+		checksum := crc32.Update(crc32.ChecksumIEEE(head), crc32.IEEETable, payload[:length])
+		expected, _ := serialization.ReadUint32(bytes.NewReader(payload[length:]))
+		if checksum != expected {
+			break
+		}
+		trailer.add(height, int(txNum))
+		offset = end
+		tail.NextHeight = height + 1
+		tail.Offset = offset
+		tail.Found = true
+	}
+	return tail, trailer, nil
+}
+
+// IsArchiveFile checks the magic at the start of the file
+func IsArchiveFile(file *os.File) (bool, error) {
+	magic := make([]byte, len(TX_ARCHIVE_MAGIC))
+	n, err := file.ReadAt(magic, 0)
+	if err != nil && err != io.EOF {
+		return false, fmt.Errorf("read file magic error:%s", err)
+	}
+	return n == len(magic) && string(magic) == TX_ARCHIVE_MAGIC, nil
+}
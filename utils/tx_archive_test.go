@@ -0,0 +1,280 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/ontio/ontology/core/payload"
+	"github.com/ontio/ontology/core/types"
+)
+
+// testBlock is a source block of the export tests
+type testBlock struct {
+	height uint32
+	txs    []*types.Transaction
+}
+
+func newTestTx(nonce uint32) *types.Transaction {
+	return &types.Transaction{
+		TxType:   types.Invoke,
+		Nonce:    nonce,
+		GasPrice: 500,
+		GasLimit: 20000,
+		Payload:  &payload.InvokeCode{Code: []byte{0x00, 0xc1, byte(nonce)}},
+		Sigs:     []*types.Sig{},
+	}
+}
+
+// newTestBlocks returns blocks of the heights with the tx counts
+func newTestBlocks(heights []uint32, txNums []int) []*testBlock {
+	blocks := make([]*testBlock, 0, len(heights))
+	for i, height := range heights {
+		block := &testBlock{height: height}
+		for j := 0; j < txNums[i]; j++ {
+			block.txs = append(block.txs, newTestTx(height*100+uint32(j)))
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks
+}
+
+var testArchiveHeader = &ArchiveHeader{
+	Version:     TX_ARCHIVE_VERSION,
+	NetworkId:   1,
+	Source:      "http://127.0.0.1:20336",
+	StartHeight: 10,
+	EndHeight:   13,
+	CreateTime:  1530000000,
+}
+
+// writeTestArchive writes an archive of the blocks and returns the end offset of each
+// block record. The trailer is only written if close is set.
+func writeTestArchive(w *bytes.Buffer, blocks []*testBlock, close bool) ([]int, error) {
+	err := WriteArchiveHeader(w, testArchiveHeader)
+	if err != nil {
+		return nil, err
+	}
+	writer := NewArchiveWriter(w, TX_ARCHIVE_VERSION, nil)
+	ends := make([]int, 0, len(blocks))
+	for _, block := range blocks {
+		header := &types.Header{Height: block.height, Timestamp: testBlockTime(block.height)}
+		err = writer.WriteBlock(header, block.txs)
+		if err == nil {
+			err = writer.Flush()
+		}
+		if err != nil {
+			return nil, err
+		}
+		ends = append(ends, w.Len())
+	}
+	if close {
+		err = writer.Close()
+	}
+	return ends, err
+}
+
+// checkTestBlocks reads the blocks from reader and checks them against blocks
+func checkTestBlocks(reader ExportReader, blocks []*testBlock) error {
+	for _, expected := range blocks {
+		block, err := reader.ReadBlock()
+		if err != nil {
+			return fmt.Errorf("read block %d error:%s", expected.height, err)
+		}
+		if block.Height != expected.height || block.TxNum != len(expected.txs) || len(block.Txs) != len(expected.txs) {
+			return fmt.Errorf("block %d with %d txs, expected block %d with %d txs", block.Height,
+				len(block.Txs), expected.height, len(expected.txs))
+		}
+		if block.Timestamp != testBlockTime(expected.height) {
+			return fmt.Errorf("block %d time %d, expected %d", block.Height, block.Timestamp, testBlockTime(expected.height))
+		}
+		for i, etx := range block.Txs {
+			if etx.Err != nil {
+				return fmt.Errorf("block %d tx %d error:%s", block.Height, i, etx.Err)
+			}
+			if etx.Tx.Hash() != expected.txs[i].Hash() {
+				return fmt.Errorf("block %d tx %d hash %x, expected %x", block.Height, i, etx.Tx.Hash(), expected.txs[i].Hash())
+			}
+			if raw := NewExportTx(0, expected.txs[i]).Raw; etx.Raw != raw {
+				return fmt.Errorf("block %d tx %d raw %q, expected %q", block.Height, i, etx.Raw, raw)
+			}
+		}
+	}
+	block, err := reader.ReadBlock()
+	if err != io.EOF {
+		return fmt.Errorf("read after the last block returned %v, %v, expected io.EOF", block, err)
+	}
+	return nil
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	blocks := newTestBlocks([]uint32{10, 11, 12}, []int{2, 0, 3})
+	buf := bytes.NewBuffer(nil)
+	_, err := writeTestArchive(buf, blocks, true)
+	if err != nil {
+		t.Fatalf("write archive error:%s", err)
+	}
+	reader, err := NewExportReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("NewExportReader error:%s", err)
+	}
+	defer reader.Close()
+	if reader.Format() != EXPORT_FORMAT_BINARY {
+		t.Fatalf("format %s, expected %s", reader.Format(), EXPORT_FORMAT_BINARY)
+	}
+	if *reader.Header() != *testArchiveHeader {
+		t.Fatalf("header %+v, expected %+v", *reader.Header(), *testArchiveHeader)
+	}
+	err = checkTestBlocks(reader, blocks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if position := reader.Position(); position.Line != 5 || position.Trailer.BlockCount != 3 || position.Trailer.TxCount != 5 {
+		t.Fatalf("position %+v after the trailer", *position)
+	}
+}
+
+func TestArchiveChecksum(t *testing.T) {
+	blocks := newTestBlocks([]uint32{10, 11}, []int{2, 1})
+	buf := bytes.NewBuffer(nil)
+	ends, err := writeTestArchive(buf, blocks, true)
+	if err != nil {
+		t.Fatalf("write archive error:%s", err)
+	}
+	// a byte of each part of the archive
+	for _, offset := range []int{len(TX_ARCHIVE_MAGIC) + 8, ends[0] - 10, ends[1] - 1, buf.Len() - 10} {
+		data := append([]byte{}, buf.Bytes()...)
+		data[offset] ^= 0xff
+		reader, err := NewExportReader(bytes.NewReader(data))
+		if err == nil {
+			err = checkTestBlocks(reader, blocks)
+			reader.Close()
+		}
+		if err == nil {
+			t.Errorf("no error for the byte at offset %d changed", offset)
+		}
+	}
+}
+
+func TestFindArchiveTail(t *testing.T) {
+	blocks := newTestBlocks([]uint32{10, 11, 12}, []int{2, 0, 3})
+	buf := bytes.NewBuffer(nil)
+	ends, err := writeTestArchive(buf, blocks, true)
+	if err != nil {
+		t.Fatalf("write archive error:%s", err)
+	}
+	archive := buf.Bytes()
+	header := bytes.NewBuffer(nil)
+	err = WriteArchiveHeader(header, testArchiveHeader)
+	if err != nil {
+		t.Fatalf("write archive header error:%s", err)
+	}
+	headerEnd := header.Len()
+	corrupt := func(offset int) []byte {
+		data := append([]byte{}, archive[:ends[2]]...)
+		data[offset] ^= 0xff
+		return data
+	}
+	complete := &ExportTail{NextHeight: 13, Offset: int64(ends[2]), Found: true, Version: TX_ARCHIVE_VERSION}
+	beforeLast := &ExportTail{NextHeight: 12, Offset: int64(ends[1]), Found: true, Version: TX_ARCHIVE_VERSION}
+	tests := []struct {
+		name    string
+		data    []byte
+		tail    *ExportTail
+		trailer ArchiveTrailer
+	}{
+		{"header only", archive[:headerEnd],
+			&ExportTail{Offset: int64(headerEnd), Version: TX_ARCHIVE_VERSION}, ArchiveTrailer{}},
+		{"with trailer", archive, complete, ArchiveTrailer{BlockCount: 3, TxCount: 5, FirstHeight: 10, LastHeight: 12}},
+		{"without trailer", archive[:ends[2]], complete,
+			ArchiveTrailer{BlockCount: 3, TxCount: 5, FirstHeight: 10, LastHeight: 12}},
+		{"torn trailer", archive[:len(archive)-3], complete,
+			ArchiveTrailer{BlockCount: 3, TxCount: 5, FirstHeight: 10, LastHeight: 12}},
+		{"torn block head", archive[:ends[1]+5], beforeLast,
+			ArchiveTrailer{BlockCount: 2, TxCount: 2, FirstHeight: 10, LastHeight: 11}},
+		{"torn block body", archive[:ends[2]-3], beforeLast,
+			ArchiveTrailer{BlockCount: 2, TxCount: 2, FirstHeight: 10, LastHeight: 11}},
+		{"corrupted block body", corrupt(ends[2] - 10), beforeLast,
+			ArchiveTrailer{BlockCount: 2, TxCount: 2, FirstHeight: 10, LastHeight: 11}},
+		{"corrupted block length", corrupt(ends[1] + int(archiveBlockHeadLen(TX_ARCHIVE_VERSION)) - 1), beforeLast,
+			ArchiveTrailer{BlockCount: 2, TxCount: 2, FirstHeight: 10, LastHeight: 11}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			file := writeTestFile(t, string(test.data))
+			defer closeTestFile(file)
+			tail, trailer, err := FindArchiveTail(file)
+			if err != nil {
+				t.Fatalf("FindArchiveTail error:%s", err)
+			}
+			if *tail != *test.tail {
+				t.Errorf("tail %+v, expected %+v", *tail, *test.tail)
+			}
+			if *trailer != test.trailer {
+				t.Errorf("trailer %+v, expected %+v", *trailer, test.trailer)
+			}
+		})
+	}
+}
+
+func TestResumeFinishedArchive(t *testing.T) {
+	blocks := newTestBlocks([]uint32{10, 11, 12}, []int{2, 0, 3})
+	buf := bytes.NewBuffer(nil)
+	_, err := writeTestArchive(buf, blocks, true)
+	if err != nil {
+		t.Fatalf("write archive error:%s", err)
+	}
+	file := writeTestFile(t, buf.String())
+	defer closeTestFile(file)
+	// a resume up to the end height of the archive drops its trailer and writes it back
+	tail, trailer, err := FindArchiveTail(file)
+	if err != nil {
+		t.Fatalf("FindArchiveTail error:%s", err)
+	}
+	err = file.Truncate(tail.Offset)
+	if err == nil {
+		_, err = file.Seek(tail.Offset, io.SeekStart)
+	}
+	if err != nil {
+		t.Fatalf("truncate archive error:%s", err)
+	}
+	err = NewArchiveWriter(file, tail.Version, trailer).Close()
+	if err != nil {
+		t.Fatalf("write trailer error:%s", err)
+	}
+	_, err = file.Seek(0, io.SeekStart)
+	if err != nil {
+		t.Fatalf("seek archive error:%s", err)
+	}
+	reader, err := NewExportReader(file)
+	if err != nil {
+		t.Fatalf("NewExportReader error:%s", err)
+	}
+	defer reader.Close()
+	err = checkTestBlocks(reader, blocks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if position := reader.Position(); position.Trailer != *trailer || position.Trailer.BlockCount != 3 {
+		t.Fatalf("trailer %+v, expected %+v", position.Trailer, *trailer)
+	}
+}
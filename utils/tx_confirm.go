@@ -0,0 +1,302 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ontio/ontology/smartcontract/event"
+)
+
+// states of a sent tx
+const (
+	TX_STATE_SENT        = "sent"        // accepted by the node, the confirmation is not tracked
+	TX_STATE_REJECTED    = "rejected"    // rejected by the node
+	TX_STATE_SUCCESS     = "success"     // packed in a block and executed successfully
+	TX_STATE_FAILED      = "failed"      // packed in a block but the execution failed
+	TX_STATE_INCLUDED    = "included"    // packed in a block, the node has no execution result
+	TX_STATE_TIMEOUT     = "timeout"     // not packed before the confirmation timeout
+	TX_STATE_UNCONFIRMED = "unconfirmed" // still waiting for a block when the tracking was interrupted
+)
+
+// TxResult is a line of a result file
+type TxResult struct {
+	TxHash      string `json:"TxHash"`
+	Endpoint    string `json:"Endpoint"`
+	SentTime    int64  `json:"SentTime"` // unix time in ms
+	State       string `json:"State"`
+	Reason      string `json:"Reason,omitempty"` // reason of a rejection
+	Desc        string `json:"Desc,omitempty"`
+	Height      uint32 `json:"Height,omitempty"`
+	LatencyMs   int64  `json:"LatencyMs,omitempty"` // from sending to the timestamp of the block with the tx
+	GasConsumed uint64 `json:"GasConsumed,omitempty"`
+	sentAt      time.Time
+}
+
+func NewTxResult(txHash string, sentAt time.Time, result *SendResult) *TxResult {
+	txResult := &TxResult{
+		TxHash:   txHash,
+		Endpoint: result.Endpoint,
+		SentTime: sentAt.UnixNano() / int64(time.Millisecond),
+		State:    TX_STATE_SENT,
+		sentAt:   sentAt,
+	}
+	if result.Reason != "" {
+		txResult.State = TX_STATE_REJECTED
+		txResult.Reason = result.Reason
+		txResult.Desc = result.Err.Error()
+	}
+	return txResult
+}
+
+// ResultWriter writes one JSON record per line, it is safe for concurrent use
+type ResultWriter struct {
+	lock sync.Mutex
+	file *os.File
+}
+
+func NewResultWriter(fileName string) (*ResultWriter, error) {
+	file, err := os.OpenFile(fileName, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0664)
+	if err != nil {
+		return nil, fmt.Errorf("Open result file:%s error:%s", fileName, err)
+	}
+	return &ResultWriter{file: file}, nil
+}
+
+func (this *ResultWriter) Write(result *TxResult) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("json.Marshal TxResult error:%s", err)
+	}
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	_, err = this.file.Write(append(data, '\n'))
+	if err != nil {
+		return fmt.Errorf("write result file error:%s", err)
+	}
+	return nil
+}
+
+func (this *ResultWriter) Close() error {
+	return this.file.Close()
+}
+
+// ConfirmStats summarizes the confirmations of the tracked txs
+type ConfirmStats struct {
+	States  map[string]uint64 // state -> tx count
+	Latency *Distribution     // latency in ms of the txs packed in blocks
+}
+
+// ConfirmTracker polls the nodes for the blocks and the execution results of the sent txs
+type ConfirmTracker struct {
+	ctx        context.Context
+	clients    map[string]*RpcClient // address -> client
+	interval   time.Duration
+	timeout    time.Duration
+	routineNum uint
+	onResult   func(*TxResult)
+	lock       sync.Mutex
+	pending    map[string]*TxResult
+	blockTimes map[uint32]uint32 // height -> timestamp of the blocks with tracked txs
+	stats      *ConfirmStats
+	closing    chan struct{}
+	done       chan struct{}
+}
+
+// NewConfirmTracker polls the pending txs every interval with routineNum routines and gives
+// up a tx after timeout. onResult is called with the final result of every tracked tx. The
+// polling stops when ctx is done.
+func NewConfirmTracker(ctx context.Context, clients []*RpcClient, interval, timeout time.Duration, routineNum uint,
+	onResult func(*TxResult)) *ConfirmTracker {
+	if routineNum == 0 {
+		routineNum = 1
+	}
+	clientMap := make(map[string]*RpcClient, len(clients))
+	for _, client := range clients {
+		clientMap[client.Addr()] = client
+	}
+	tracker := &ConfirmTracker{
+		ctx:        ctx,
+		clients:    clientMap,
+		interval:   interval,
+		timeout:    timeout,
+		routineNum: routineNum,
+		onResult:   onResult,
+		pending:    make(map[string]*TxResult),
+		blockTimes: make(map[uint32]uint32),
+		stats: &ConfirmStats{
+			States:  make(map[string]uint64),
+			Latency: newDistribution(),
+		},
+		closing: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go tracker.run()
+	return tracker
+}
+
+// Track starts tracking a tx accepted by a node
+func (this *ConfirmTracker) Track(result *TxResult) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.pending[result.TxHash] = result
+}
+
+// Pending returns the number of txs waiting for a block
+func (this *ConfirmTracker) Pending() int {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	return len(this.pending)
+}
+
+// Close waits until every tracked tx is confirmed or timed out, or until the context is
+// done, and returns the stats. The txs still pending when the context is done are finished
+// as unconfirmed, so every tracked tx gets a result.
+func (this *ConfirmTracker) Close() *ConfirmStats {
+	close(this.closing)
+	<-this.done
+	this.lock.Lock()
+	results := make([]*TxResult, 0, len(this.pending))
+	for _, result := range this.pending {
+		results = append(results, result)
+	}
+	this.lock.Unlock()
+	for _, result := range results {
+		result.State = TX_STATE_UNCONFIRMED
+		this.finish(result)
+	}
+	this.stats.Latency.finish()
+	return this.stats
+}
+
+func (this *ConfirmTracker) run() {
+	defer close(this.done)
+	ticker := time.NewTicker(this.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-this.ctx.Done():
+			return
+		}
+		this.poll()
+		select {
+		case <-this.closing:
+			if this.Pending() == 0 {
+				return
+			}
+		default:
+		}
+	}
+}
+
+func (this *ConfirmTracker) poll() {
+	this.lock.Lock()
+	results := make([]*TxResult, 0, len(this.pending))
+	for _, result := range this.pending {
+		results = append(results, result)
+	}
+	this.lock.Unlock()
+
+	jobs := make(chan *TxResult)
+	wg := &sync.WaitGroup{}
+	for i := uint(0); i < this.routineNum; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for result := range jobs {
+				this.check(result)
+			}
+		}()
+	}
+	for _, result := range results {
+		jobs <- result
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// check asks the node that accepted the tx, so the result does not depend on the block sync of other nodes
+func (this *ConfirmTracker) check(result *TxResult) {
+	client := this.clients[result.Endpoint]
+	height, err := client.GetBlockHeightByTxHash(this.ctx, result.TxHash)
+	if err != nil {
+		if this.ctx.Err() == nil && time.Since(result.sentAt) > this.timeout {
+			result.State = TX_STATE_TIMEOUT
+			this.finish(result)
+		}
+		return
+	}
+	// the block time, not the time of the poll, so the latency does not depend on the poll interval
+	blockTime, err := this.blockTime(client, height)
+	if err != nil {
+		return
+	}
+	result.Height = height
+	result.LatencyMs = int64(blockTime)*1000 - result.sentAt.UnixNano()/int64(time.Millisecond)
+	// the block time is in seconds and the clocks of the nodes may be behind
+	if result.LatencyMs < 0 {
+		result.LatencyMs = 0
+	}
+	result.State = TX_STATE_INCLUDED
+	notify, err := client.GetSmartCodeEvent(this.ctx, result.TxHash)
+	if err == nil && notify != nil {
+		result.GasConsumed = notify.GasConsumed
+		if notify.State == event.CONTRACT_STATE_FAIL {
+			result.State = TX_STATE_FAILED
+		} else {
+			result.State = TX_STATE_SUCCESS
+		}
+	}
+	this.finish(result)
+}
+
+// blockTime returns the timestamp of a block, the txs of a block get it once
+func (this *ConfirmTracker) blockTime(client *RpcClient, height uint32) (uint32, error) {
+	this.lock.Lock()
+	blockTime, ok := this.blockTimes[height]
+	this.lock.Unlock()
+	if ok {
+		return blockTime, nil
+	}
+	blockTime, err := client.GetBlockTime(this.ctx, height)
+	if err != nil {
+		return 0, err
+	}
+	this.lock.Lock()
+	this.blockTimes[height] = blockTime
+	this.lock.Unlock()
+	return blockTime, nil
+}
+
+func (this *ConfirmTracker) finish(result *TxResult) {
+	this.lock.Lock()
+	delete(this.pending, result.TxHash)
+	this.stats.States[result.State]++
+	if result.State != TX_STATE_TIMEOUT && result.State != TX_STATE_UNCONFIRMED {
+		this.stats.Latency.add(uint64(result.LatencyMs))
+	}
+	this.lock.Unlock()
+	this.onResult(result)
+}
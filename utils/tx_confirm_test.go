@@ -0,0 +1,89 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package utils
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ontio/ontology/smartcontract/event"
+)
+
+func TestConfirmTrackerLatency(t *testing.T) {
+	chain := newTestChain(10)
+	heights := map[string]uint32{"tx1": 7, "tx2": 7, "tx3": 8}
+	var lock sync.Mutex
+	blockRequests := 0
+	handleBlock := testChainHandler(chain)
+	server := newTestRpcServer(func(req *JsonRpcRequest) *JsonRpcResponse {
+		switch req.Method {
+		case "getblockheightbytxhash":
+			height, ok := heights[req.Params[0].(string)]
+			if !ok {
+				return &JsonRpcResponse{Error: 44001, Desc: "UNKNOWN TRANSACTION"}
+			}
+			return testRpcResult(height)
+		case "getsmartcodeevent":
+			return testRpcResult(&SmartCodeEvent{TxHash: req.Params[0].(string), State: event.CONTRACT_STATE_SUCCESS})
+		case "getblock":
+			lock.Lock()
+			blockRequests++
+			lock.Unlock()
+		}
+		return handleBlock(req)
+	})
+	defer server.Close()
+	client := NewRpcClient(server.URL, &RpcConfig{})
+	var results []*TxResult
+	tracker := NewConfirmTracker(context.Background(), []*RpcClient{client}, 10*time.Millisecond, time.Hour, 1,
+		func(result *TxResult) {
+			lock.Lock()
+			results = append(results, result)
+			lock.Unlock()
+		})
+	blockTime := func(height uint32) time.Time {
+		return time.Unix(int64(testBlockTime(height)), 0)
+	}
+	// the polls run long after the blocks, the latency is taken from the block times
+	sent := map[string]time.Time{
+		"tx1": blockTime(7).Add(-3 * time.Second),
+		"tx2": blockTime(7).Add(-1500 * time.Millisecond),
+		"tx3": blockTime(8).Add(500 * time.Millisecond), // the clock of the node is behind
+	}
+	expected := map[string]int64{"tx1": 3000, "tx2": 1500, "tx3": 0}
+	for txHash, sentAt := range sent {
+		tracker.Track(NewTxResult(txHash, sentAt, &SendResult{Endpoint: server.URL}))
+	}
+	stats := tracker.Close()
+	if len(results) != len(sent) || stats.States[TX_STATE_SUCCESS] != uint64(len(sent)) {
+		t.Fatalf("%d results states %v, expected %d successful txs", len(results), stats.States, len(sent))
+	}
+	for _, result := range results {
+		if result.Height != heights[result.TxHash] || result.LatencyMs != expected[result.TxHash] {
+			t.Errorf("%s in block %d latency %dms, expected block %d latency %dms", result.TxHash, result.Height,
+				result.LatencyMs, heights[result.TxHash], expected[result.TxHash])
+		}
+	}
+	// the time of a block is asked once for all its txs polled by a routine
+	if blockRequests != 2 {
+		t.Errorf("%d block requests, expected 2", blockRequests)
+	}
+}
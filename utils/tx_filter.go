@@ -0,0 +1,161 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package utils
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ontio/ontology/common"
+	"github.com/ontio/ontology/core/payload"
+	"github.com/ontio/ontology/core/types"
+)
+
+// TxFilter matches the txs to export. A tx matches if it matches every condition that
+// is set, and it matches a list condition if it matches any item of the list.
+type TxFilter struct {
+	Contracts   map[common.Address]bool
+	Payers      map[common.Address]bool
+	Signers     map[common.Address]bool
+	TxTypes     map[types.TransactionType]bool
+	MinGasPrice uint64
+	MaxGasPrice uint64 // 0 means no limit
+}
+
+func NewTxFilter() *TxFilter {
+	return &TxFilter{
+		Contracts: make(map[common.Address]bool),
+		Payers:    make(map[common.Address]bool),
+		Signers:   make(map[common.Address]bool),
+		TxTypes:   make(map[types.TransactionType]bool),
+	}
+}
+
+// IsEmpty returns true if the filter matches every tx
+func (this *TxFilter) IsEmpty() bool {
+	return len(this.Contracts) == 0 && len(this.Payers) == 0 && len(this.Signers) == 0 &&
+		len(this.TxTypes) == 0 && this.MinGasPrice == 0 && this.MaxGasPrice == 0
+}
+
+func (this *TxFilter) Match(tx *types.Transaction) bool {
+	if len(this.TxTypes) != 0 && !this.TxTypes[tx.TxType] {
+		return false
+	}
+	if tx.GasPrice < this.MinGasPrice || (this.MaxGasPrice != 0 && tx.GasPrice > this.MaxGasPrice) {
+		return false
+	}
+	if len(this.Payers) != 0 && !this.Payers[tx.Payer] {
+		return false
+	}
+	if len(this.Contracts) != 0 {
+		contract, ok := TxContract(tx)
+		if !ok || !this.Contracts[contract] {
+			return false
+		}
+	}
+	if len(this.Signers) != 0 && !this.matchSigner(tx) {
+		return false
+	}
+	return true
+}
+
+func (this *TxFilter) matchSigner(tx *types.Transaction) bool {
+	for _, sig := range tx.Sigs {
+		var signer common.Address
+		if len(sig.PubKeys) == 1 {
+			signer = types.AddressFromPubKey(sig.PubKeys[0])
+		} else {
+			var err error
+			signer, err = types.AddressFromMultiPubKeys(sig.PubKeys, int(sig.M))
+			if err != nil {
+				continue
+			}
+		}
+		if this.Signers[signer] {
+			return true
+		}
+	}
+	return false
+}
+
+// TxContract returns the contract invoked by an invoke tx, or the contract deployed by a deploy tx
+func TxContract(tx *types.Transaction) (common.Address, bool) {
+	switch code := tx.Payload.(type) {
+	case *payload.InvokeCode:
+		target, ok := ParseInvokeCode(code.Code)
+		if !ok {
+			return common.Address{}, false
+		}
+		return target.Contract, true
+	case *payload.DeployCode:
+		return common.AddressFromVmCode(code.Code), true
+	}
+	return common.Address{}, false
+}
+
+// ParseAddress parses a base58 address, a hex address or the name of a native contract
+func ParseAddress(value string) (common.Address, error) {
+	for contract, name := range nativeContractNames {
+		if value == name {
+			return contract, nil
+		}
+	}
+	if address, err := common.AddressFromBase58(value); err == nil {
+		return address, nil
+	}
+	address, err := common.AddressFromHexString(value)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("invalid address %s", value)
+	}
+	return address, nil
+}
+
+// ParseAddressList parses a comma separated list of addresses
+func ParseAddressList(value string) (map[common.Address]bool, error) {
+	addresses := make(map[common.Address]bool)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		address, err := ParseAddress(item)
+		if err != nil {
+			return nil, err
+		}
+		addresses[address] = true
+	}
+	return addresses, nil
+}
+
+// ParseTxTypeList parses a comma separated list of tx types, deploy or invoke
+func ParseTxTypeList(value string) (map[types.TransactionType]bool, error) {
+	txTypes := make(map[types.TransactionType]bool)
+	for _, item := range strings.Split(value, ",") {
+		switch strings.ToLower(strings.TrimSpace(item)) {
+		case "":
+		case "deploy":
+			txTypes[types.Deploy] = true
+		case "invoke":
+			txTypes[types.Invoke] = true
+		default:
+			return nil, fmt.Errorf("invalid tx type %s, should be deploy or invoke", item)
+		}
+	}
+	return txTypes, nil
+}
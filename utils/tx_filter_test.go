@@ -0,0 +1,198 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package utils
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ontio/ontology-crypto/keypair"
+	cutils "github.com/ontio/ontology/cmd/utils"
+	"github.com/ontio/ontology/common"
+	"github.com/ontio/ontology/core/payload"
+	"github.com/ontio/ontology/core/types"
+	nutils "github.com/ontio/ontology/smartcontract/service/native/utils"
+)
+
+func newTestPubKey(t *testing.T) keypair.PublicKey {
+	_, pubKey, err := keypair.GenerateKeyPair(keypair.PK_ECDSA, keypair.P256)
+	if err != nil {
+		t.Fatalf("GenerateKeyPair error:%s", err)
+	}
+	return pubKey
+}
+
+func TestTxFilterMatch(t *testing.T) {
+	var payer, other common.Address
+	for i := range payer {
+		payer[i], other[i] = byte(i), byte(i+1)
+	}
+	keys := []keypair.PublicKey{newTestPubKey(t), newTestPubKey(t), newTestPubKey(t)}
+	signer := types.AddressFromPubKey(keys[0])
+	multiSigner, err := types.AddressFromMultiPubKeys(keys[1:], 2)
+	if err != nil {
+		t.Fatalf("AddressFromMultiPubKeys error:%s", err)
+	}
+
+	code, err := cutils.BuildNativeInvokeCode(nutils.OntContractAddress, 0, "transfer",
+		[]interface{}{payer, other, "1"})
+	if err != nil {
+		t.Fatalf("BuildNativeInvokeCode error:%s", err)
+	}
+	invoke := newTestTx(1)
+	invoke.Payer = payer
+	invoke.GasPrice = 500
+	invoke.Payload = &payload.InvokeCode{Code: code}
+	invoke.Sigs = []*types.Sig{{PubKeys: keys[:1], M: 1}}
+
+	deployCode := []byte{0x51, 0x52, 0x53}
+	deploy := newTestTx(2)
+	deploy.TxType = types.Deploy
+	deploy.Payer = other
+	deploy.GasPrice = 0
+	deploy.Payload = &payload.DeployCode{Code: deployCode}
+	deploy.Sigs = []*types.Sig{{PubKeys: keys[1:], M: 2}}
+
+	unknown := newTestTx(3)
+	unknown.Payload = &payload.InvokeCode{Code: []byte{0x51}}
+
+	tests := []struct {
+		name    string
+		filter  TxFilter
+		matched []bool // invoke, deploy, unknown
+	}{
+		{"empty", TxFilter{}, []bool{true, true, true}},
+		{"invoke type", TxFilter{TxTypes: map[types.TransactionType]bool{types.Invoke: true}}, []bool{true, false, true}},
+		{"both types", TxFilter{TxTypes: map[types.TransactionType]bool{types.Invoke: true, types.Deploy: true}},
+			[]bool{true, true, true}},
+		{"min gas price", TxFilter{MinGasPrice: 1}, []bool{true, false, true}},
+		{"max gas price", TxFilter{MaxGasPrice: 499}, []bool{false, true, false}},
+		{"gas price range", TxFilter{MinGasPrice: 500, MaxGasPrice: 500}, []bool{true, false, true}},
+		{"payer", TxFilter{Payers: map[common.Address]bool{other: true}}, []bool{false, true, false}},
+		{"native contract", TxFilter{Contracts: map[common.Address]bool{nutils.OntContractAddress: true}},
+			[]bool{true, false, false}},
+		{"deployed contract", TxFilter{Contracts: map[common.Address]bool{common.AddressFromVmCode(deployCode): true}},
+			[]bool{false, true, false}},
+		{"signer", TxFilter{Signers: map[common.Address]bool{signer: true}}, []bool{true, false, false}},
+		{"multi signer", TxFilter{Signers: map[common.Address]bool{multiSigner: true, payer: true}},
+			[]bool{false, true, false}},
+		{"all conditions", TxFilter{
+			TxTypes:     map[types.TransactionType]bool{types.Invoke: true},
+			Payers:      map[common.Address]bool{payer: true},
+			Contracts:   map[common.Address]bool{nutils.OntContractAddress: true},
+			Signers:     map[common.Address]bool{signer: true},
+			MinGasPrice: 500,
+		}, []bool{true, false, false}},
+		{"one condition fails", TxFilter{
+			Payers:  map[common.Address]bool{payer: true},
+			Signers: map[common.Address]bool{multiSigner: true},
+		}, []bool{false, false, false}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for i, tx := range []*types.Transaction{invoke, deploy, unknown} {
+				if matched := test.filter.Match(tx); matched != test.matched[i] {
+					t.Errorf("tx %d matched %v, expected %v", i, matched, test.matched[i])
+				}
+			}
+		})
+	}
+}
+
+func TestTxFilterIsEmpty(t *testing.T) {
+	if !NewTxFilter().IsEmpty() {
+		t.Errorf("new filter is not empty")
+	}
+	filter := NewTxFilter()
+	filter.MaxGasPrice = 1
+	if filter.IsEmpty() {
+		t.Errorf("filter with a max gas price is empty")
+	}
+}
+
+func TestParseAddressList(t *testing.T) {
+	var address common.Address
+	for i := range address {
+		address[i] = byte(i + 1)
+	}
+	tests := []struct {
+		value     string
+		addresses []common.Address
+		ok        bool
+	}{
+		{"", nil, true},
+		{" , ", nil, true},
+		{address.ToBase58(), []common.Address{address}, true},
+		{address.ToHexString(), []common.Address{address}, true},
+		{"ont, ong", []common.Address{nutils.OntContractAddress, nutils.OngContractAddress}, true},
+		{"governance," + address.ToBase58() + ",", []common.Address{nutils.GovernanceContractAddress, address}, true},
+		{"ONT", nil, false},
+		{"ont,xyz", nil, false},
+		{address.ToHexString()[2:], nil, false},
+	}
+	for _, test := range tests {
+		addresses, err := ParseAddressList(test.value)
+		if (err == nil) != test.ok {
+			t.Errorf("%q: error %v, expected ok %v", test.value, err, test.ok)
+			continue
+		}
+		if !test.ok {
+			continue
+		}
+		expected := make(map[common.Address]bool)
+		for _, address := range test.addresses {
+			expected[address] = true
+		}
+		if !reflect.DeepEqual(addresses, expected) {
+			t.Errorf("%q: addresses %v, expected %v", test.value, addresses, expected)
+		}
+	}
+}
+
+func TestParseTxTypeList(t *testing.T) {
+	tests := []struct {
+		value   string
+		txTypes []types.TransactionType
+		ok      bool
+	}{
+		{"", nil, true},
+		{"invoke", []types.TransactionType{types.Invoke}, true},
+		{"Deploy, INVOKE", []types.TransactionType{types.Deploy, types.Invoke}, true},
+		{"deploy,,deploy", []types.TransactionType{types.Deploy}, true},
+		{"invoke,bookkeeping", nil, false},
+		{"d1", nil, false},
+	}
+	for _, test := range tests {
+		txTypes, err := ParseTxTypeList(test.value)
+		if (err == nil) != test.ok {
+			t.Errorf("%q: error %v, expected ok %v", test.value, err, test.ok)
+			continue
+		}
+		if !test.ok {
+			continue
+		}
+		expected := make(map[types.TransactionType]bool)
+		for _, txType := range test.txTypes {
+			expected[txType] = true
+		}
+		if !reflect.DeepEqual(txTypes, expected) {
+			t.Errorf("%q: tx types %v, expected %v", test.value, txTypes, expected)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package utils
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/ontio/ontology/core/types"
+	ontErrors "github.com/ontio/ontology/errors"
+)
+
+// reasons of the txs rejected by a node
+const (
+	SEND_REJECT_DUPLICATE = "duplicate" // the tx is in the tx pool or the ledger of the node
+	SEND_REJECT_GAS       = "gas"       // the gas limit or price is too low, or the payer cannot pay the gas
+	SEND_REJECT_SIGNATURE = "signature" // the signatures of the tx fail the verification
+	SEND_REJECT_INVALID   = "invalid"   // the tx is malformed or invalid
+	SEND_REJECT_POOL_FULL = "poolfull"  // the tx pool of the node is full
+	SEND_REJECT_NETWORK   = "network"   // the node cannot be reached
+	SEND_REJECT_OTHER     = "other"
+)
+
+// ClassifySendError returns the reason of a failed sendrawtransaction, and whether
+// sending the tx again may succeed
+func ClassifySendError(err error) (string, bool) {
+	rpcErr, ok := err.(*RpcError)
+	if !ok {
+		return SEND_REJECT_NETWORK, IsRetriable(err)
+	}
+	switch ontErrors.ErrCode(rpcErr.Code) {
+	case ontErrors.ErrDuplicatedTx, ontErrors.ErrDuplicateInput, ontErrors.ErrTxHashDuplicate:
+		return SEND_REJECT_DUPLICATE, false
+	case ontErrors.ErrGasPrice:
+		return SEND_REJECT_GAS, false
+	case ontErrors.ErrVerifySignature:
+		return SEND_REJECT_SIGNATURE, false
+	case ontErrors.ErrTxPoolFull:
+		return SEND_REJECT_POOL_FULL, true
+	case ontErrors.ErrTransactionPayload, ontErrors.ErrTransactionContracts, ontErrors.ErrAttributeProgram:
+		return SEND_REJECT_INVALID, false
+	}
+	// the tx pool rejects some txs with ErrUnknown and a description only
+	desc := strings.ToLower(rpcErr.Desc)
+	switch {
+	case strings.Contains(desc, "duplicate"):
+		return SEND_REJECT_DUPLICATE, false
+	case strings.Contains(desc, "gas"), strings.Contains(desc, "balance"):
+		return SEND_REJECT_GAS, false
+	case strings.Contains(desc, "signature"):
+		return SEND_REJECT_SIGNATURE, false
+	case strings.Contains(desc, "invalid"):
+		return SEND_REJECT_INVALID, false
+	}
+	return SEND_REJECT_OTHER, false
+}
+
+// ParseEndpoints splits a comma separated list of rpc addresses like host:port or http://host:port
+func ParseEndpoints(value string) ([]string, error) {
+	var endpoints []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !strings.Contains(item, "://") {
+			item = "http://" + item
+		}
+		endpoints = append(endpoints, item)
+	}
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("no rpc endpoint in %s", value)
+	}
+	return endpoints, nil
+}
+
+// SendResult is the result of sending a tx
+type SendResult struct {
+	Endpoint string // endpoint of the last attempt
+	Attempts int
+	Reason   string // reason of the rejection, empty if the tx is accepted
+	Err      error
+}
+
+// TxSender sends txs to the rpc endpoints of nodes in turn
+type TxSender struct {
+	clients    []*RpcClient
+	retries    int
+	retryDelay time.Duration
+	next       uint64
+}
+
+func NewTxSender(clients []*RpcClient, retries uint, retryDelay time.Duration) *TxSender {
+	return &TxSender{
+		clients:    clients,
+		retries:    int(retries),
+		retryDelay: retryDelay,
+	}
+}
+
+// Send sends a tx by sendrawtransaction. A transient error is retried on the next endpoint
+// after a delay growing with the attempts, until ctx is done. The clients should not retry
+// themselves, or the retries multiply. Send is safe for concurrent use.
+func (this *TxSender) Send(ctx context.Context, tx *types.Transaction) *SendResult {
+	txHex := hex.EncodeToString(tx.ToArray())
+	result := &SendResult{}
+	for {
+		client := this.clients[atomic.AddUint64(&this.next, 1)%uint64(len(this.clients))]
+		result.Endpoint = client.Addr()
+		result.Attempts++
+		result.Err = client.SendRawTransaction(ctx, txHex)
+		if result.Err == nil {
+			result.Reason = ""
+			return result
+		}
+		var transient bool
+		result.Reason, transient = ClassifySendError(result.Err)
+		if !transient || result.Attempts > this.retries {
+			return result
+		}
+		if sleepContext(ctx, this.retryDelay*time.Duration(result.Attempts)) != nil {
+			return result
+		}
+	}
+}
@@ -0,0 +1,143 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package utils
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	ontErrors "github.com/ontio/ontology/errors"
+)
+
+func TestClassifySendError(t *testing.T) {
+	rpcError := func(code ontErrors.ErrCode, desc string) error {
+		return &RpcError{Code: int64(code), Desc: desc}
+	}
+	tests := []struct {
+		name      string
+		err       error
+		reason    string
+		transient bool
+	}{
+		{"duplicated tx", rpcError(ontErrors.ErrDuplicatedTx, ""), SEND_REJECT_DUPLICATE, false},
+		{"duplicate input", rpcError(ontErrors.ErrDuplicateInput, ""), SEND_REJECT_DUPLICATE, false},
+		{"duplicate hash", rpcError(ontErrors.ErrTxHashDuplicate, ""), SEND_REJECT_DUPLICATE, false},
+		{"gas price", rpcError(ontErrors.ErrGasPrice, ""), SEND_REJECT_GAS, false},
+		{"signature", rpcError(ontErrors.ErrVerifySignature, ""), SEND_REJECT_SIGNATURE, false},
+		{"pool full", rpcError(ontErrors.ErrTxPoolFull, ""), SEND_REJECT_POOL_FULL, true},
+		{"payload", rpcError(ontErrors.ErrTransactionPayload, ""), SEND_REJECT_INVALID, false},
+		{"contracts", rpcError(ontErrors.ErrTransactionContracts, ""), SEND_REJECT_INVALID, false},
+		{"attribute program", rpcError(ontErrors.ErrAttributeProgram, ""), SEND_REJECT_INVALID, false},
+		// the code wins over the description
+		{"code and description", rpcError(ontErrors.ErrTxPoolFull, "duplicated transaction"), SEND_REJECT_POOL_FULL, true},
+		{"duplicate description", rpcError(ontErrors.ErrUnknown, "Duplicated Transaction detected"), SEND_REJECT_DUPLICATE, false},
+		{"gas description", rpcError(ontErrors.ErrUnknown, "gasLimit insufficient"), SEND_REJECT_GAS, false},
+		{"balance description", rpcError(ontErrors.ErrUnknown, "payer has not enough Balance"), SEND_REJECT_GAS, false},
+		{"signature description", rpcError(ontErrors.ErrUnknown, "verify Signature failed"), SEND_REJECT_SIGNATURE, false},
+		{"invalid description", rpcError(ontErrors.ErrUnknown, "INVALID TRANSACTION"), SEND_REJECT_INVALID, false},
+		{"other description", rpcError(ontErrors.ErrUnknown, "internal error"), SEND_REJECT_OTHER, false},
+		{"no description", rpcError(ontErrors.ErrNoCode, ""), SEND_REJECT_OTHER, false},
+		{"unknown code", &RpcError{Code: 43001, Desc: "INTERNAL ERROR"}, SEND_REJECT_OTHER, false},
+		{"network", &url.Error{Op: "Post", URL: "http://127.0.0.1:20336", Err: errors.New("connection refused")},
+			SEND_REJECT_NETWORK, true},
+		{"server error", &HttpStatusError{StatusCode: 503, Status: "503 Service Unavailable"}, SEND_REJECT_NETWORK, true},
+		{"client error", &HttpStatusError{StatusCode: 400, Status: "400 Bad Request"}, SEND_REJECT_NETWORK, false},
+	}
+	for _, test := range tests {
+		reason, transient := ClassifySendError(test.err)
+		if reason != test.reason || transient != test.transient {
+			t.Errorf("%s: reason %s transient %v, expected %s %v", test.name, reason, transient, test.reason, test.transient)
+		}
+	}
+}
+
+func TestTxSenderRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures int // requests failing with 503 before the tx is accepted
+		retries  uint
+		attempts int
+		reason   string
+	}{
+		{"accepted", 0, 2, 1, ""},
+		{"accepted after retries", 2, 2, 3, ""},
+		{"retries used up", 5, 2, 3, SEND_REJECT_NETWORK},
+		{"no retries", 1, 0, 1, SEND_REJECT_NETWORK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var requests int
+			handle := func(req *JsonRpcRequest) *JsonRpcResponse {
+				requests++
+				if requests <= test.failures {
+					return nil
+				}
+				return testRpcResult("")
+			}
+			first, second := newTestRpcServer(handle), newTestRpcServer(handle)
+			defer first.Close()
+			defer second.Close()
+			first.status = http.StatusServiceUnavailable
+			second.status = http.StatusServiceUnavailable
+			// the send clients do not retry, every attempt of the sender is one request
+			config := &RpcConfig{Backoff: time.Millisecond}
+			sender := NewTxSender([]*RpcClient{NewRpcClient(first.URL, config), NewRpcClient(second.URL, config)},
+				test.retries, time.Millisecond)
+			result := sender.Send(context.Background(), newTestTx(1))
+			if result.Attempts != test.attempts || result.Reason != test.reason {
+				t.Errorf("%d attempts reason %q, expected %d %q", result.Attempts, result.Reason, test.attempts, test.reason)
+			}
+			firstPosts, _ := first.counts()
+			secondPosts, _ := second.counts()
+			if firstPosts+secondPosts != test.attempts || (test.attempts > 1 && (firstPosts == 0 || secondPosts == 0)) {
+				t.Errorf("%d and %d requests, expected %d on both endpoints", firstPosts, secondPosts, test.attempts)
+			}
+		})
+	}
+}
+
+func TestParseEndpoints(t *testing.T) {
+	tests := []struct {
+		value     string
+		endpoints []string
+	}{
+		{"127.0.0.1:20336", []string{"http://127.0.0.1:20336"}},
+		{"http://a:20336, https://b:443,c:1", []string{"http://a:20336", "https://b:443", "http://c:1"}},
+		{"a:1,,", []string{"http://a:1"}},
+		{" , ", nil},
+		{"", nil},
+	}
+	for _, test := range tests {
+		endpoints, err := ParseEndpoints(test.value)
+		if test.endpoints == nil {
+			if err == nil {
+				t.Errorf("%q: no error", test.value)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(endpoints, test.endpoints) {
+			t.Errorf("%q: endpoints %v error %v, expected %v", test.value, endpoints, err, test.endpoints)
+		}
+	}
+}
@@ -20,14 +20,11 @@ package utils
 
 import (
 	"bytes"
-	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"math"
-	"net/http"
 	//"os"
-	"strings"
 	"time"
 
 	//"github.com/ontio/ontology-crypto/keypair"
@@ -43,107 +40,6 @@ import (
 	"github.com/ontio/ontology/smartcontract/service/native/governance"
 )
 
-var (
-	ip   string
-	port uint
-)
-
-const JSON_RPC_VERSION = "2.0"
-
-//JsonRpcRequest object in rpc
-type JsonRpcRequest struct {
-	Version string        `json:"jsonrpc"`
-	Id      string        `json:"id"`
-	Method  string        `json:"method"`
-	Params  []interface{} `json:"params"`
-}
-
-//JsonRpcResponse object response for JsonRpcRequest
-type JsonRpcResponse struct {
-	Error  int64           `json:"error"`
-	Desc   string          `json:"desc"`
-	Result json.RawMessage `json:"result"`
-}
-
-func SetIPPort(hostIP string, hostPort uint) {
-	ip = hostIP
-	port = hostPort
-}
-
-func rpcAddress() string {
-	address := fmt.Sprintf("http://%s:%d", ip, port)
-	return address
-}
-
-func sendRpcRequest(method string, params []interface{}) ([]byte, error) {
-	rpcReq := &JsonRpcRequest{
-		Version: JSON_RPC_VERSION,
-		Id:      "cli",
-		Method:  method,
-		Params:  params,
-	}
-	data, err := json.Marshal(rpcReq)
-	if err != nil {
-		return nil, fmt.Errorf("JsonRpcRequest json.Marsha error:%s", err)
-	}
-
-	addr := rpcAddress()
-	resp, err := http.Post(addr, "application/json", strings.NewReader(string(data)))
-	if err != nil {
-		return nil, fmt.Errorf("http post request:%s error:%s", data, err)
-	}
-	defer resp.Body.Close()
-
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("read rpc response body error:%s", err)
-	}
-	rpcRsp := &JsonRpcResponse{}
-	err = json.Unmarshal(body, rpcRsp)
-	if err != nil {
-		return nil, fmt.Errorf("json.Unmarshal JsonRpcResponse:%s error:%s", body, err)
-	}
-	if rpcRsp.Error != 0 {
-		return nil, fmt.Errorf("error code:%d desc:%s", rpcRsp.Error, rpcRsp.Desc)
-	}
-	return rpcRsp.Result, nil
-}
-
-func GetBlockCount() (uint32, error) {
-	data, err := sendRpcRequest("getblockcount", []interface{}{})
-	if err != nil {
-		return 0, err
-	}
-	num := uint32(0)
-	err = json.Unmarshal(data, &num)
-	if err != nil {
-		return 0, fmt.Errorf("json.Unmarshal:%s ss error:%s", data, err)
-	}
-	return num, nil
-}
-
-func GetBlockData(hashOrHeight interface{}) ([]byte, error) {
-	data, err := sendRpcRequest("getblock", []interface{}{hashOrHeight})
-	if err != nil {
-		return nil, err
-	}
-	hexStr := ""
-	err = json.Unmarshal(data, &hexStr)
-	if err != nil {
-		return nil, fmt.Errorf("json.Unmarshal sff error:%s", err)
-	}
-	blockData, err := hex.DecodeString(hexStr)
-	if err != nil {
-		return nil, fmt.Errorf("hex.DecodeString error:%s", err)
-	}
-	return blockData, nil
-}
-
-func SendRawTransaction(tx string) error {
-	_, err := sendRpcRequest("sendrawtransaction", []interface{}{tx})
-	return err
-}
-
 func initVbftBlock(block *types.Block) (*vbft.Block, error) {
 	if block == nil {
 		return nil, fmt.Errorf("nil block in initVbftBlock")
@@ -181,13 +77,18 @@ func getConsensusPayload(blk *types.Block) ([]byte, error) {
 	return consensusPayload, nil
 }
 
+// ConstructBlock builds and signs the next block of preBlock. The block is stamped with
+// timestamp, or with the current time if timestamp is 0, and always after preBlock.
 func ConstructBlock(accounts []*account.Account, ldg *ledger.Ledger, blkNum uint32,
-	preBlock *types.Block, txs []*types.Transaction) (*types.Block, error) {
+	preBlock *types.Block, txs []*types.Transaction, timestamp uint32) (*types.Block, error) {
 	consensusPayload, err := getConsensusPayload(preBlock)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get consensus payload %v", err)
 	}
-	blockTimestamp := uint32(time.Now().Unix())
+	blockTimestamp := timestamp
+	if blockTimestamp == 0 {
+		blockTimestamp = uint32(time.Now().Unix())
+	}
 	if preBlock.Header.Timestamp >= blockTimestamp {
 		blockTimestamp = preBlock.Header.Timestamp + 1
 	}
@@ -321,11 +222,16 @@ func InitAccounts() ([]*account.Account, error) {
 	return getDefaultAccounts(walletCfg)
 }
 
+// LedgerDir is the directory of the ledger opened by InitLedger
+func LedgerDir(networkId int) string {
+	networkName := config.GetNetworkName(uint32(networkId))
+	return fmt.Sprintf("./Chain/%s", networkName)
+}
+
 func InitLedger(cfg *config.OntologyConfig, networkId int) (*ledger.Ledger, error) {
 	var err error
 
-	networkName := config.GetNetworkName(uint32(networkId))
-	dbDir := fmt.Sprintf("./Chain/%s", networkName)
+	dbDir := LedgerDir(networkId)
 
 	ledger.DefLedger, err = ledger.NewLedger(dbDir)
 	if err != nil {
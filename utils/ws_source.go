@@ -0,0 +1,457 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/ontio/ontology/common"
+	"github.com/ontio/ontology/core/types"
+)
+
+const (
+	WS_API_VERSION         = "1.0.0"
+	WS_HEARTBEAT_INTERVAL  = 30 * time.Second // the node closes a websocket session idle for a few minutes
+	WS_SUBSCRIBE_QUEUE_LEN = 256              // blocks pushed to a subscriber not reading yet
+	WS_ACTION_PUSH_BLOCK   = "sendrawblock"   // action of the blocks pushed to a subscriber
+)
+
+var errWsClosed = errors.New("websocket connection closed")
+
+type wsCall struct {
+	action string
+	seq    uint64
+	reply  chan *RestResponse // closed without a reply if the connection is lost
+}
+
+// WsClient sends requests to the WebSocket server of a node over one connection, and
+// receives the blocks pushed to a subscriber. A lost connection fails the pending
+// requests with a retriable error and is dialed again by the next request, or at once
+// if the client is subscribed. It is safe for concurrent use.
+type WsClient struct {
+	addr      string
+	config    RpcConfig
+	lock      sync.Mutex // guards the fields below
+	writeLock sync.Mutex // a websocket connection takes one writer at a time
+	conn      *websocket.Conn
+	calls     map[string]*wsCall
+	seq       uint64
+	blocks    chan *types.Block // nil until SubscribeBlocks
+	closed    bool
+	quit      chan struct{}
+}
+
+// NewWsClient connects to the WebSocket server at addr like ws://127.0.0.1:20335
+func NewWsClient(addr string, config *RpcConfig) *WsClient {
+	return &WsClient{
+		addr:   addr,
+		config: *config,
+		calls:  make(map[string]*wsCall),
+		quit:   make(chan struct{}),
+	}
+}
+
+func (this *WsClient) Addr() string {
+	return this.addr
+}
+
+// Call sends the action with the params and returns the result. A retriable error is
+// retried as by RpcClient.
+func (this *WsClient) Call(ctx context.Context, action string, params map[string]interface{}) ([]byte, error) {
+	return withRetries(ctx, &this.config, func() ([]byte, error) {
+		return this.request(ctx, action, params)
+	})
+}
+
+func (this *WsClient) request(ctx context.Context, action string, params map[string]interface{}) ([]byte, error) {
+	conn, err := this.connect()
+	if err != nil {
+		return nil, err
+	}
+	seq := atomic.AddUint64(&this.seq, 1)
+	id := fmt.Sprintf("cli-%d", seq)
+	call := &wsCall{action: action, seq: seq, reply: make(chan *RestResponse, 1)}
+	this.lock.Lock()
+	this.calls[id] = call
+	this.lock.Unlock()
+	defer this.removeCall(id)
+
+	msg := map[string]interface{}{
+		"Action":  action,
+		"Version": WS_API_VERSION,
+		"Id":      id,
+	}
+	for key, value := range params {
+		msg[key] = value
+	}
+	err = this.write(conn, msg)
+	if err != nil {
+		this.drop(conn)
+		return nil, &url.Error{Op: "write", URL: this.addr, Err: err}
+	}
+
+	attemptCtx, cancel := withTimeout(ctx, &this.config)
+	defer cancel()
+	select {
+	case rsp, ok := <-call.reply:
+		if !ok {
+			return nil, &url.Error{Op: "read", URL: this.addr, Err: errWsClosed}
+		}
+		if rsp.Error != 0 {
+			return nil, &RpcError{Code: rsp.Error, Desc: rsp.Desc}
+		}
+		return rsp.Result, nil
+	case <-attemptCtx.Done():
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		// a timeout is a network error, as the timeout of an http request
+		return nil, &url.Error{Op: "read", URL: this.addr, Err: attemptCtx.Err()}
+	}
+}
+
+func (this *WsClient) removeCall(id string) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	delete(this.calls, id)
+}
+
+// SubscribeBlocks asks the node to push every new block. The blocks come in the returned
+// channel until Close. Blocks pushed while the receiver lags behind by
+// WS_SUBSCRIBE_QUEUE_LEN blocks, or while the connection is down, are missed, so the
+// receiver has to fill the gaps in the heights itself.
+func (this *WsClient) SubscribeBlocks(ctx context.Context) (<-chan *types.Block, error) {
+	this.lock.Lock()
+	if this.blocks == nil {
+		this.blocks = make(chan *types.Block, WS_SUBSCRIBE_QUEUE_LEN)
+	}
+	blocks := this.blocks
+	this.lock.Unlock()
+	_, err := this.Call(ctx, "subscribe", subscribeParams())
+	if err != nil {
+		return nil, fmt.Errorf("subscribe blocks error:%s", err)
+	}
+	return blocks, nil
+}
+
+func subscribeParams() map[string]interface{} {
+	return map[string]interface{}{
+		"SubscribeRawBlock":     true,
+		"SubscribeJsonBlock":    false,
+		"SubscribeEvent":        false,
+		"SubscribeBlockTxHashs": false,
+	}
+}
+
+// connect returns the connection, it dials the server if there is none
+func (this *WsClient) connect() (*websocket.Conn, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if this.closed {
+		return nil, errWsClosed
+	}
+	if this.conn != nil {
+		return this.conn, nil
+	}
+	dialer := &websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: this.config.Timeout,
+	}
+	conn, _, err := dialer.Dial(this.addr, nil)
+	if err != nil {
+		return nil, &url.Error{Op: "dial", URL: this.addr, Err: err}
+	}
+	this.conn = conn
+	done := make(chan struct{})
+	go this.readLoop(conn, done)
+	go this.heartbeat(conn, done)
+	if this.blocks != nil {
+		// the subscription is lost with the old connection, the answer is not waited for
+		msg := subscribeParams()
+		msg["Action"] = "subscribe"
+		msg["Version"] = WS_API_VERSION
+		go this.write(conn, msg)
+	}
+	return conn, nil
+}
+
+func (this *WsClient) write(conn *websocket.Conn, msg map[string]interface{}) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("json.Marshal ws request error:%s", err)
+	}
+	this.writeLock.Lock()
+	defer this.writeLock.Unlock()
+	if this.config.Timeout > 0 {
+		conn.SetWriteDeadline(time.Now().Add(this.config.Timeout))
+	}
+	return conn.WriteMessage(websocket.TextMessage, data)
+}
+
+func (this *WsClient) readLoop(conn *websocket.Conn, done chan struct{}) {
+	defer close(done)
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			this.drop(conn)
+			return
+		}
+		rsp := &RestResponse{}
+		if json.Unmarshal(data, rsp) != nil {
+			continue
+		}
+		if rsp.Action == WS_ACTION_PUSH_BLOCK {
+			this.push(rsp)
+			continue
+		}
+		this.reply(rsp)
+	}
+}
+
+// reply hands the response to its request. A response without the Id of its request goes
+// to the oldest request of the same action.
+func (this *WsClient) reply(rsp *RestResponse) {
+	this.lock.Lock()
+	var call *wsCall
+	id, _ := rsp.Id.(string)
+	if id != "" {
+		call = this.calls[id]
+	} else {
+		for callId, c := range this.calls {
+			if c.action == rsp.Action && (call == nil || c.seq < call.seq) {
+				call = c
+				id = callId
+			}
+		}
+	}
+	if call != nil {
+		delete(this.calls, id)
+	}
+	this.lock.Unlock()
+	if call != nil {
+		call.reply <- rsp
+	}
+}
+
+func (this *WsClient) push(rsp *RestResponse) {
+	blockData, err := decodeBlockData(rsp.Result)
+	if err != nil {
+		return
+	}
+	block, err := deserializeBlock(blockData)
+	if err != nil {
+		return
+	}
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if this.blocks == nil || this.closed {
+		return
+	}
+	select {
+	case this.blocks <- block:
+	default:
+	}
+}
+
+func (this *WsClient) heartbeat(conn *websocket.Conn, done chan struct{}) {
+	ticker := time.NewTicker(WS_HEARTBEAT_INTERVAL)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			err := this.write(conn, map[string]interface{}{"Action": "heartbeat", "Version": WS_API_VERSION})
+			if err != nil {
+				return
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// drop closes a broken connection and fails its pending requests. A subscribed client dials again.
+func (this *WsClient) drop(conn *websocket.Conn) {
+	this.lock.Lock()
+	if this.conn != conn {
+		this.lock.Unlock()
+		return
+	}
+	this.conn = nil
+	calls := this.calls
+	this.calls = make(map[string]*wsCall)
+	resubscribe := this.blocks != nil && !this.closed
+	this.lock.Unlock()
+	conn.Close()
+	for _, call := range calls {
+		close(call.reply)
+	}
+	if resubscribe {
+		go this.reconnect()
+	}
+}
+
+// reconnect dials the server with an exponential backoff until it succeeds or the client is closed
+func (this *WsClient) reconnect() {
+	backoff := this.config.Backoff
+	if backoff <= 0 {
+		backoff = time.Second
+	}
+	for {
+		select {
+		case <-time.After(backoff):
+		case <-this.quit:
+			return
+		}
+		_, err := this.connect()
+		if err == nil || err == errWsClosed {
+			return
+		}
+		backoff *= 2
+		if backoff > RPC_MAX_BACKOFF {
+			backoff = RPC_MAX_BACKOFF
+		}
+	}
+}
+
+// Close closes the connection and the channel of the subscribed blocks
+func (this *WsClient) Close() error {
+	this.lock.Lock()
+	if this.closed {
+		this.lock.Unlock()
+		return nil
+	}
+	this.closed = true
+	close(this.quit)
+	if this.blocks != nil {
+		close(this.blocks)
+	}
+	conn := this.conn
+	this.conn = nil
+	calls := this.calls
+	this.calls = make(map[string]*wsCall)
+	this.lock.Unlock()
+	for _, call := range calls {
+		close(call.reply)
+	}
+	if conn != nil {
+		return conn.Close()
+	}
+	return nil
+}
+
+// WsBlockSource gets blocks from the WebSocket server of a node. Its requests are canceled
+// when the context it is created with is done.
+type WsBlockSource struct {
+	ctx    context.Context
+	client *WsClient
+}
+
+func NewWsBlockSource(ctx context.Context, client *WsClient) *WsBlockSource {
+	return &WsBlockSource{
+		ctx:    ctx,
+		client: client,
+	}
+}
+
+func (this *WsBlockSource) Name() string {
+	return this.client.Addr()
+}
+
+func (this *WsBlockSource) GetNetworkId() (uint32, error) {
+	data, err := this.client.Call(this.ctx, "getnetworkid", nil)
+	if err != nil {
+		return 0, err
+	}
+	networkId := uint32(0)
+	err = json.Unmarshal(data, &networkId)
+	if err != nil {
+		return 0, fmt.Errorf("json.Unmarshal:%s error:%s", data, err)
+	}
+	return networkId, nil
+}
+
+// GetBlockCount returns the current height + 1, as getblockcount of JSON-RPC
+func (this *WsBlockSource) GetBlockCount() (uint32, error) {
+	data, err := this.client.Call(this.ctx, "getblockheight", nil)
+	if err != nil {
+		return 0, err
+	}
+	height := uint32(0)
+	err = json.Unmarshal(data, &height)
+	if err != nil {
+		return 0, fmt.Errorf("json.Unmarshal:%s error:%s", data, err)
+	}
+	return height + 1, nil
+}
+
+func (this *WsBlockSource) GetBlock(height uint32) (*types.Block, error) {
+	data, err := this.client.Call(this.ctx, "getblockbyheight", map[string]interface{}{
+		"Height": fmt.Sprint(height),
+		"Raw":    "1",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Get block:%d error:%s", height, err)
+	}
+	blockData, err := decodeBlockData(data)
+	if err != nil {
+		return nil, fmt.Errorf("Get block:%d error:%s", height, err)
+	}
+	block, err := deserializeBlock(blockData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read block at height %d err %v", height, err)
+	}
+	return block, nil
+}
+
+func (this *WsBlockSource) GetBlockByHash(hash common.Uint256) (*types.Block, error) {
+	data, err := this.client.Call(this.ctx, "getblockbyhash", map[string]interface{}{
+		"Hash": hash.ToHexString(),
+		"Raw":  "1",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Get block:%s error:%s", hash.ToHexString(), err)
+	}
+	blockData, err := decodeBlockData(data)
+	if err != nil {
+		return nil, fmt.Errorf("Get block:%s error:%s", hash.ToHexString(), err)
+	}
+	block, err := deserializeBlock(blockData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read block %s err %v", hash.ToHexString(), err)
+	}
+	return block, nil
+}
+
+// SubscribeBlocks returns the new blocks pushed by the node, see WsClient.SubscribeBlocks
+func (this *WsBlockSource) SubscribeBlocks() (<-chan *types.Block, error) {
+	return this.client.SubscribeBlocks(this.ctx)
+}
+
+func (this *WsBlockSource) Close() error {
+	return this.client.Close()
+}